@@ -2,6 +2,9 @@ package adapter
 
 import (
 	"context"
+	"errors"
+	"strings"
+	"time"
 )
 
 // WebhookPayload represents the structure of the data from Redis.
@@ -12,6 +15,161 @@ type WebhookPayload struct {
 	Data       map[string]interface{} `json:"data"`
 	SecretHash string                 `json:"secretHash"`
 	MetaData   map[string]interface{} `json:"metaData"`
+	Attempts   []DeliveryAttempt      `json:"attempts,omitempty"`
+	// EnqueueID identifies the message of the webhook, whichever broker and instance reads it. It's
+	// set by sendhooks when the webhook is enqueued through the API or the client.
+	EnqueueID string `json:"enqueueId,omitempty"`
+	// IdempotencyKey identifies the webhook for the producer, across its enqueue retries.
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+	// DeliverAt is the RFC 3339 time before which the webhook is not sent.
+	DeliverAt string `json:"deliverAt,omitempty"`
+	// DelaySeconds delays the delivery from the enqueue time. It's turned into DeliverAt when the
+	// webhook is enqueued, or first read when it was written to the broker directly.
+	DelaySeconds int `json:"delaySeconds,omitempty"`
+	// ExpiresAt is the RFC 3339 time after which the webhook is not sent anymore. An undelivered
+	// webhook is then acknowledged with the "expired" status instead of being retried.
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	// OrderingKey delivers the webhooks sharing it one at a time, in the order they are read.
+	OrderingKey string `json:"orderingKey,omitempty"`
+	// Accepted is the RFC 3339 time the webhook passed the duplicate check. It's set by sendhooks
+	// when the webhook is first read, so the retries are not checked again.
+	Accepted string `json:"accepted,omitempty"`
+	// RetryPolicy is the name of the retry policy of the webhook. It replaces the policy of the
+	// endpoint.
+	RetryPolicy string `json:"retryPolicy,omitempty"`
+	// Priority is "high", "normal" or "low". Without it, the webhook is normal.
+	Priority string `json:"priority,omitempty"`
+	// RateLimitReserved tells that the webhook was postponed until the token it reserved in the
+	// rate limiter is due. It's set by sendhooks, and the webhook is then sent without taking
+	// another token.
+	RateLimitReserved bool `json:"rateLimitReserved,omitempty"`
+}
+
+// The priorities of the webhooks.
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+// Priorities lists the priorities, the most urgent first.
+var Priorities = []string{PriorityHigh, PriorityNormal, PriorityLow}
+
+// PriorityLevel returns the priority of the webhook. A webhook without a priority, or with an
+// unknown one, is normal.
+func (p WebhookPayload) PriorityLevel() string {
+	switch p.Priority {
+	case PriorityHigh, PriorityLow:
+		return p.Priority
+	default:
+		return PriorityNormal
+	}
+}
+
+// ResolveDelay turns the DelaySeconds of the webhook into a DeliverAt time counted from now. A
+// DeliverAt already set wins over the delay.
+func (p *WebhookPayload) ResolveDelay(now time.Time) {
+	if p.DelaySeconds > 0 && p.DeliverAt == "" {
+		p.DeliverAt = now.Add(time.Duration(p.DelaySeconds) * time.Second).UTC().Format(time.RFC3339)
+	}
+	p.DelaySeconds = 0
+}
+
+// DeliverLater returns the DeliverAt time of the webhook when it's after now. An invalid DeliverAt
+// is ignored, the webhook is due.
+func (p WebhookPayload) DeliverLater(now time.Time) (time.Time, bool) {
+	deliverAt, err := time.Parse(time.RFC3339, p.DeliverAt)
+	if err != nil || !deliverAt.After(now) {
+		return time.Time{}, false
+	}
+	return deliverAt, true
+}
+
+// DeliverNotBefore moves the DeliverAt time of the webhook to t, unless it's already later. It's
+// used by the brokers that can release a delayed message before it's due.
+func (p *WebhookPayload) DeliverNotBefore(t time.Time) {
+	if _, later := p.DeliverLater(t); !later {
+		p.DeliverAt = t.UTC().Format(time.RFC3339)
+	}
+}
+
+// Expired tells if the webhook expires at t. A webhook without an ExpiresAt time, or with an
+// invalid one, never expires.
+func (p WebhookPayload) Expired(t time.Time) bool {
+	expiresAt, err := time.Parse(time.RFC3339, p.ExpiresAt)
+	return err == nil && !t.Before(expiresAt)
+}
+
+// EnqueueIDOrMessageID returns the enqueue ID of the webhook, or its message ID without one. It
+// identifies the message across its redeliveries, unless the broker gives a new message ID to a
+// redelivered message.
+func (p WebhookPayload) EnqueueIDOrMessageID() string {
+	if p.EnqueueID != "" {
+		return p.EnqueueID
+	}
+	return p.MessageID
+}
+
+// IdempotencyKeyOrID returns the idempotency key of the webhook, or its webhook ID without one.
+// It's stable across the retries and the duplicates of the webhook.
+func (p WebhookPayload) IdempotencyKeyOrID() string {
+	if p.IdempotencyKey != "" {
+		return p.IdempotencyKey
+	}
+	return p.WebhookID
+}
+
+// DeliveryAttempt records a failed delivery attempt. It travels with the payload when a retry is
+// scheduled, so the history survives restarts.
+type DeliveryAttempt struct {
+	Attempted string `json:"attempted"`
+	Error     string `json:"error"`
+}
+
+// DeadLetter is a webhook that exhausted its delivery attempts. The attempt history is kept in
+// the payload.
+type DeadLetter struct {
+	ID        string         `json:"id"`
+	Payload   WebhookPayload `json:"payload"`
+	LastError string         `json:"lastError"`
+	Failed    string         `json:"failed"`
+}
+
+// DeadLetterFilter selects dead letters. Empty fields match every dead letter.
+type DeadLetterFilter struct {
+	ID        string
+	URL       string
+	WebhookID string
+	From      time.Time
+	To        time.Time
+}
+
+// Matches reports whether the dead letter is selected by the filter.
+func (f DeadLetterFilter) Matches(deadLetter DeadLetter) bool {
+	if f.ID != "" && f.ID != deadLetter.ID {
+		return false
+	}
+	if f.URL != "" && f.URL != deadLetter.Payload.URL {
+		return false
+	}
+	if f.WebhookID != "" && f.WebhookID != deadLetter.Payload.WebhookID {
+		return false
+	}
+
+	if !f.From.IsZero() || !f.To.IsZero() {
+		failed, err := time.Parse(time.RFC3339, deadLetter.Failed)
+		if err != nil {
+			return false
+		}
+		if !f.From.IsZero() && failed.Before(f.From) {
+			return false
+		}
+		if !f.To.IsZero() && failed.After(f.To) {
+			return false
+		}
+	}
+
+	return true
 }
 
 type WebhookDeliveryStatus struct {
@@ -35,20 +193,390 @@ type RedisConfig struct {
 	RedisClientKey        string `json:"redisClientKey"`
 	RedisStreamName       string `json:"redisStreamName"`
 	RedisStreamStatusName string `json:"redisStreamStatusName"`
+	RedisConsumerGroup    string `json:"redisConsumerGroup"`
+	RedisConsumerName     string `json:"redisConsumerName"`
+	// RedisClaimMinIdle is the number of seconds a message can stay pending
+	// before another consumer is allowed to reclaim it.
+	RedisClaimMinIdle int `json:"redisClaimMinIdle"`
+	// RedisClaimInterval is the number of seconds between two reclaims of
+	// stale pending messages.
+	RedisClaimInterval int `json:"redisClaimInterval"`
+	// RedisRetrySetName is the sorted set holding the scheduled retries, scored by the time
+	// of the next attempt.
+	RedisRetrySetName string `json:"redisRetrySetName"`
+	// RedisDeadLetterStreamName is the stream receiving the webhooks that exhausted their retries.
+	RedisDeadLetterStreamName string `json:"redisDeadLetterStreamName"`
+}
+
+type KafkaConfig struct {
+	KafkaBrokers         []string `json:"kafkaBrokers"`
+	KafkaTopic           string   `json:"kafkaTopic"`
+	KafkaStatusTopic     string   `json:"kafkaStatusTopic"`
+	KafkaRetryTopic      string   `json:"kafkaRetryTopic"`
+	KafkaDeadLetterTopic string   `json:"kafkaDeadLetterTopic"`
+	KafkaConsumerGroup   string   `json:"kafkaConsumerGroup"`
+	KafkaSsl             string   `json:"kafkaSsl"`
+	KafkaCaCert          string   `json:"kafkaCaCert"`
+	KafkaClientCert      string   `json:"kafkaClientCert"`
+	KafkaClientKey       string   `json:"kafkaClientKey"`
+}
+
+type AmqpConfig struct {
+	AmqpUrl              string `json:"amqpUrl"`
+	AmqpQueue            string `json:"amqpQueue"`
+	AmqpRetryQueue       string `json:"amqpRetryQueue"`
+	AmqpDeadLetterQueue  string `json:"amqpDeadLetterQueue"`
+	AmqpStatusExchange   string `json:"amqpStatusExchange"`
+	AmqpStatusRoutingKey string `json:"amqpStatusRoutingKey"`
+	AmqpSsl              string `json:"amqpSsl"`
+	AmqpCaCert           string `json:"amqpCaCert"`
+	AmqpClientCert       string `json:"amqpClientCert"`
+	AmqpClientKey        string `json:"amqpClientKey"`
+}
+
+type NatsConfig struct {
+	NatsUrl               string `json:"natsUrl"`
+	NatsStream            string `json:"natsStream"`
+	NatsSubject           string `json:"natsSubject"`
+	NatsConsumer          string `json:"natsConsumer"`
+	NatsStatusSubject     string `json:"natsStatusSubject"`
+	NatsDeadLetterSubject string `json:"natsDeadLetterSubject"`
+	NatsSsl               string `json:"natsSsl"`
+	NatsCaCert            string `json:"natsCaCert"`
+	NatsClientCert        string `json:"natsClientCert"`
+	NatsClientKey         string `json:"natsClientKey"`
+}
+
+type PostgresConfig struct {
+	PostgresUrl string `json:"postgresUrl"`
+	// PostgresPollInterval is the number of seconds to wait before polling the outbox again
+	// when it's empty.
+	PostgresPollInterval int `json:"postgresPollInterval"`
+	// PostgresMigrate creates the outbox and status tables on startup when set to "true".
+	PostgresMigrate string `json:"postgresMigrate"`
+}
+
+type LocalConfig struct {
+	LocalPath string `json:"localPath"`
+	// LocalStatusHistory is the number of delivery statuses kept, the oldest ones are deleted first.
+	LocalStatusHistory int `json:"localStatusHistory"`
+}
+
+type HttpConfig struct {
+	// HttpListenAddress enables the HTTP API when set, for example ":8080".
+	HttpListenAddress string `json:"httpListenAddress"`
+	// HttpAuthTokens are the bearer tokens accepted by the API. The API doesn't start without a
+	// token, unless HttpAllowUnauthenticated is set.
+	HttpAuthTokens []string `json:"httpAuthTokens"`
+	// HttpAllowUnauthenticated serves the API without authentication when there is no token and
+	// it's set to "true".
+	HttpAllowUnauthenticated string `json:"httpAllowUnauthenticated"`
+}
+
+type GrpcConfig struct {
+	// GrpcListenAddress enables the gRPC API when set, for example ":9090".
+	GrpcListenAddress string `json:"grpcListenAddress"`
+	// GrpcAuthTokens are the bearer tokens accepted by the API, in the authorization metadata. The
+	// API doesn't start without a token, unless GrpcAllowUnauthenticated is set.
+	GrpcAuthTokens []string `json:"grpcAuthTokens"`
+	// GrpcAllowUnauthenticated serves the API without authentication when there is no token and
+	// it's set to "true".
+	GrpcAllowUnauthenticated string `json:"grpcAllowUnauthenticated"`
+}
+
+// EndpointConfig holds the settings of the webhooks sent to an endpoint.
+type EndpointConfig struct {
+	// EndpointUrl is matched as a prefix of the webhook URLs. The longest matching prefix wins.
+	EndpointUrl string `json:"endpointUrl"`
+	// EndpointSecret signs the webhooks sent to the endpoint, either in the "whsec_<base64>"
+	// format or as a raw string.
+	EndpointSecret string `json:"endpointSecret"`
+	// EndpointKeys are the versions of the endpoint secret, to rotate it without downtime.
+	EndpointKeys []SigningKeyConfig `json:"endpointKeys"`
+	// EndpointRateLimit throttles the webhooks sent to the endpoint. It replaces the rate limit
+	// of the destination host.
+	EndpointRateLimit RateLimitConfig `json:"endpointRateLimit"`
+	// EndpointMaxInFlight caps the requests in flight to the endpoint. It replaces the cap of the
+	// destination host.
+	EndpointMaxInFlight int `json:"endpointMaxInFlight"`
+	// EndpointRetryPolicy is the name of the retry policy of the webhooks sent to the endpoint.
+	EndpointRetryPolicy string `json:"endpointRetryPolicy"`
+}
+
+// CircuitBreakerConfig stops the deliveries to a failing endpoint for a while. The circuit of an
+// endpoint opens when too many requests fail, parks the deliveries during a cool-down, then lets a
+// single probe through: the circuit closes when it succeeds and opens again when it fails.
+type CircuitBreakerConfig struct {
+	// CircuitBreakerFailureRatio is the ratio of failed requests, between 0 and 1, opening the
+	// circuit. Zero disables the circuit breaker.
+	CircuitBreakerFailureRatio float64 `json:"circuitBreakerFailureRatio"`
+	// CircuitBreakerMinRequests is the number of requests in the window before the ratio is
+	// checked. It defaults to 10.
+	CircuitBreakerMinRequests int `json:"circuitBreakerMinRequests"`
+	// CircuitBreakerWindow is the number of seconds over which the requests are counted. It
+	// defaults to 60.
+	CircuitBreakerWindow int `json:"circuitBreakerWindow"`
+	// CircuitBreakerCooldown is the number of seconds the circuit stays open before the probe. It
+	// defaults to 30.
+	CircuitBreakerCooldown int `json:"circuitBreakerCooldown"`
+}
+
+// RateLimitConfig is a token bucket: RateLimitPerSecond tokens are added every second, up to
+// RateLimitBurst tokens, and every request takes one.
+type RateLimitConfig struct {
+	// RateLimitPerSecond is the sustained number of requests per second. Zero disables the limit.
+	RateLimitPerSecond float64 `json:"rateLimitPerSecond"`
+	// RateLimitBurst is the number of requests that can be sent at once. It defaults to the rate,
+	// rounded up.
+	RateLimitBurst int `json:"rateLimitBurst"`
+}
+
+// RetryPolicyConfig is a named retry policy, telling how long to wait after a failed attempt and
+// when to give up.
+type RetryPolicyConfig struct {
+	RetryPolicyName string `json:"retryPolicyName"`
+	// RetryPolicyStrategy is "exponential" (the default), "linear", "fixed" or "schedule". After n
+	// failed attempts, the exponential strategy waits RetryPolicyInitialBackoff * 2^n, the linear
+	// one RetryPolicyInitialBackoff * n, and the fixed one RetryPolicyInitialBackoff, capped at
+	// RetryPolicyMaxBackoff. The schedule one waits the n-th delay of RetryPolicySchedule, used as
+	// written.
+	RetryPolicyStrategy string `json:"retryPolicyStrategy"`
+	// RetryPolicyJitter randomises the delays: "full" waits between zero and the delay, "equal"
+	// between half the delay and the delay. There is no jitter by default.
+	RetryPolicyJitter string `json:"retryPolicyJitter"`
+	// RetryPolicyMaxAttempts is the number of attempts before the webhook is dead-lettered. It
+	// defaults to 5, to one more than the delays of the schedule, or to no limit with a maximum age.
+	RetryPolicyMaxAttempts int `json:"retryPolicyMaxAttempts"`
+	// RetryPolicyInitialBackoff is a number of seconds. It defaults to 1.
+	RetryPolicyInitialBackoff int `json:"retryPolicyInitialBackoff"`
+	// RetryPolicyMaxBackoff is the longest delay of the computed strategies, in seconds. It defaults
+	// to an hour.
+	RetryPolicyMaxBackoff int `json:"retryPolicyMaxBackoff"`
+	// RetryPolicySchedule lists the delays of the schedule strategy, such as "1m" or "2h". The last
+	// one is repeated when there are more attempts than delays.
+	RetryPolicySchedule []string `json:"retryPolicySchedule"`
+	// RetryPolicyMaxAge is the number of seconds after which the webhook is dead-lettered instead of
+	// retried, counted from its first read. Zero means no maximum age.
+	RetryPolicyMaxAge int `json:"retryPolicyMaxAge"`
+}
+
+// ResponseConfig classifies the responses of the receivers. Any 2xx response is a success, a 4xx
+// response fails permanently unless it's retryable, and the other responses are retried.
+type ResponseConfig struct {
+	// ResponseRetryableStatusCodes are the 4xx status codes retried instead of failing
+	// permanently. They default to 408, 409 and 429.
+	ResponseRetryableStatusCodes []int `json:"responseRetryableStatusCodes"`
+	// ResponsePermanentStatusCodes are other status codes failing permanently, such as 501.
+	ResponsePermanentStatusCodes []int `json:"responsePermanentStatusCodes"`
+}
+
+// DeduplicationConfig suppresses the duplicates of a webhook: the first message read with an
+// idempotency key is delivered, the others are acknowledged with a "duplicate" status.
+type DeduplicationConfig struct {
+	// DeduplicationWindow is the number of seconds during which a webhook read again with the same
+	// idempotency key, or webhook ID without one, is a duplicate. Zero disables the deduplication.
+	DeduplicationWindow int `json:"deduplicationWindow"`
+	// DeduplicationStore keeps the webhooks seen in "memory" (the default), or in the "redis" of
+	// the redis section to share them between the instances.
+	DeduplicationStore string `json:"deduplicationStore"`
+}
+
+// PriorityConfig weighs the priorities of the webhooks. During a backlog, each priority gets a share
+// of the deliveries proportional to its weight, so the low priority webhooks still go through.
+type PriorityConfig struct {
+	// PriorityHighWeight defaults to 4.
+	PriorityHighWeight int `json:"priorityHighWeight"`
+	// PriorityNormalWeight defaults to 2.
+	PriorityNormalWeight int `json:"priorityNormalWeight"`
+	// PriorityLowWeight defaults to 1.
+	PriorityLowWeight int `json:"priorityLowWeight"`
+}
+
+// Weight returns the weight of the priority, or its default.
+func (c PriorityConfig) Weight(priority string) int {
+	weight, fallback := c.PriorityNormalWeight, 2
+	switch priority {
+	case PriorityHigh:
+		weight, fallback = c.PriorityHighWeight, 4
+	case PriorityLow:
+		weight, fallback = c.PriorityLowWeight, 1
+	}
+
+	if weight <= 0 {
+		return fallback
+	}
+	return weight
+}
+
+// SigningKeyConfig is a version of a signing key. A version signs the webhooks from KeyActiveFrom
+// until SigningOverlap seconds after the next version became active, so receivers can accept both
+// versions while they roll over.
+type SigningKeyConfig struct {
+	// KeySecret is the secret of an endpoint key.
+	KeySecret string `json:"keySecret"`
+	// KeyPrivateKey is the path of the private key of an asymmetric key.
+	KeyPrivateKey string `json:"keyPrivateKey"`
+	// KeyId identifies an asymmetric key in the published JWKS.
+	KeyId string `json:"keyId"`
+	// KeyActiveFrom is the RFC 3339 time the version starts signing. An empty value means forever.
+	KeyActiveFrom string `json:"keyActiveFrom"`
 }
 
 type Configuration struct {
-	Redis                RedisConfig `json:"redis"`
-	SecretHashHeaderName string      `json:"secretHashHeaderName"`
-	Broker               string      `json:"broker"`
-	NumWorkers           int         `json:"numWorkers"`
-	ChannelSize          int         `json:"channelSize"`
+	Redis     RedisConfig      `json:"redis"`
+	Kafka     KafkaConfig      `json:"kafka"`
+	Amqp      AmqpConfig       `json:"amqp"`
+	Nats      NatsConfig       `json:"nats"`
+	Postgres  PostgresConfig   `json:"postgres"`
+	Local     LocalConfig      `json:"local"`
+	Http      HttpConfig       `json:"http"`
+	Grpc      GrpcConfig       `json:"grpc"`
+	Endpoints []EndpointConfig `json:"endpoints"`
+	// RateLimit throttles the webhooks sent to each destination host.
+	RateLimit RateLimitConfig `json:"rateLimit"`
+	// RateLimitStore keeps the token buckets in "memory" (the default), or in the "redis" of the
+	// redis section to share them between the instances.
+	RateLimitStore string `json:"rateLimitStore"`
+	// CircuitBreaker applies to each endpoint of the endpoints section, and to each destination
+	// host of the other webhooks.
+	CircuitBreaker CircuitBreakerConfig `json:"circuitBreaker"`
+	// MaxInFlight caps the requests in flight across all the destinations, 100 by default. A
+	// negative value means no cap.
+	MaxInFlight int `json:"maxInFlight"`
+	// MaxInFlightPerHost caps the requests in flight to each destination host. Zero means no cap.
+	MaxInFlightPerHost int `json:"maxInFlightPerHost"`
+	// RetryPolicies are the named retry policies, selected by the webhooks or their endpoints.
+	RetryPolicies []RetryPolicyConfig `json:"retryPolicies"`
+	// DefaultRetryPolicy is the name of the policy of the webhooks without one. Without it, the
+	// webhooks get 5 attempts with an exponential backoff from a second.
+	DefaultRetryPolicy string `json:"defaultRetryPolicy"`
+	// Response classifies the responses of the receivers.
+	Response ResponseConfig `json:"response"`
+	// Deduplication suppresses the webhooks enqueued again by the producers.
+	Deduplication DeduplicationConfig `json:"deduplication"`
+	// CancelStore keeps the pending and cancelled webhooks of the kafka and amqp brokers in
+	// "memory" (the default), or in the "redis" of the redis section to share them between the
+	// instances.
+	CancelStore string `json:"cancelStore"`
+	// Priority weighs the priorities of the webhooks.
+	Priority PriorityConfig `json:"priority"`
+	// SigningMode is "standard" (the default) to sign the webhooks with the endpoint secrets,
+	// "asymmetric" to sign them with SigningPrivateKey, or "legacy" to send the secretHash of the
+	// payload in the SecretHashHeaderName header.
+	SigningMode string `json:"signingMode"`
+	// SigningPrivateKey is the path of the Ed25519 or RSA private key, in the PEM format, used in
+	// the asymmetric signing mode.
+	SigningPrivateKey string `json:"signingPrivateKey"`
+	// SigningKeyId identifies the key in the published JWKS. It defaults to the key thumbprint.
+	SigningKeyId string `json:"signingKeyId"`
+	// SigningKeys are the versions of the asymmetric signing key, to rotate it without downtime.
+	SigningKeys []SigningKeyConfig `json:"signingKeys"`
+	// SigningOverlap is the number of seconds a key version keeps signing after the next version
+	// became active. It defaults to a day.
+	SigningOverlap       int    `json:"signingOverlap"`
+	SecretHashHeaderName string `json:"secretHashHeaderName"`
+	Broker               string `json:"broker"`
+	NumWorkers           int    `json:"numWorkers"`
+	ChannelSize          int    `json:"channelSize"`
+}
+
+// EndpointFor returns the settings of the endpoint matching the URL.
+func (c Configuration) EndpointFor(url string) (EndpointConfig, bool) {
+	var endpoint EndpointConfig
+	found := false
+
+	for _, candidate := range c.Endpoints {
+		if strings.HasPrefix(url, candidate.EndpointUrl) && (!found || len(candidate.EndpointUrl) > len(endpoint.EndpointUrl)) {
+			endpoint = candidate
+			found = true
+		}
+	}
+
+	return endpoint, found
 }
 
 // Adapter defines methods for interacting with different queue systems.
 type Adapter interface {
 	Connect() error
 	SubscribeToQueue(ctx context.Context, queue chan<- WebhookPayload) error
-	ProcessWebhooks(ctx context.Context, queue chan WebhookPayload, queueAdapter Adapter)
 	PublishStatus(ctx context.Context, webhookID, url, created, delivered, status, deliveryError string, payloadSize int, numberOfTries int) error
+	// Acknowledge tells the broker that the payload reached a terminal delivery
+	// outcome and must not be delivered again.
+	Acknowledge(ctx context.Context, payload WebhookPayload) error
+	// ScheduleRetry persists the payload in the broker so that it's delivered again at retryAt,
+	// and acknowledges the current message.
+	ScheduleRetry(ctx context.Context, payload WebhookPayload, retryAt time.Time) error
+	// DeadLetter moves the payload to the dead-letter queue and acknowledges the current message.
+	DeadLetter(ctx context.Context, payload WebhookPayload, lastError string) error
+}
+
+// Enqueuer is implemented by the adapters that can queue webhooks themselves.
+type Enqueuer interface {
+	// Enqueue queues the payload and returns its position in the queue, or -1 when the broker
+	// can't tell.
+	Enqueue(ctx context.Context, payload WebhookPayload) (int64, error)
+}
+
+// StatusStore is implemented by the adapters keeping the delivery status history.
+type StatusStore interface {
+	ListStatuses(ctx context.Context, webhookID string) ([]WebhookDeliveryStatus, error)
+}
+
+// StatusWatcher is implemented by the adapters that can follow their status stream.
+type StatusWatcher interface {
+	// WatchStatuses sends the statuses published from now on to the statuses channel, until the
+	// context is cancelled.
+	WatchStatuses(ctx context.Context, statuses chan<- WebhookDeliveryStatus) error
+}
+
+// LeaseExtender is implemented by the adapters whose broker hands a message not acknowledged in
+// time to another consumer. ExtendLease tells the broker the message is still being worked on, so
+// a webhook can wait in the worker longer than the lease.
+type LeaseExtender interface {
+	ExtendLease(ctx context.Context, payload WebhookPayload) error
+}
+
+// CancelRetention is how long a cancellation is kept. A webhook read after that is sent.
+const CancelRetention = 7 * 24 * time.Hour
+
+// Canceller is implemented by the adapters that can cancel webhooks. A cancelled webhook is
+// acknowledged without being sent the next time it's read, whether it's waiting for its first
+// attempt or for a retry.
+type Canceller interface {
+	// CancelWebhook marks a pending webhook as cancelled and returns its URL. It returns
+	// ErrWebhookNotFound when no webhook with this ID is waiting for delivery.
+	CancelWebhook(ctx context.Context, webhookID string) (string, error)
+	WebhookCancelled(ctx context.Context, webhookID string) (bool, error)
+}
+
+// ErrCancelNotSupported is returned by Cancel when the adapter isn't a Canceller.
+var ErrCancelNotSupported = errors.New("cancellation is not supported")
+
+// ErrWebhookNotFound is returned by Cancel when no webhook with this ID is waiting for delivery.
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// Cancel cancels the webhook and publishes its "cancelled" status. An attempt already under way
+// isn't interrupted.
+func Cancel(ctx context.Context, queueAdapter Adapter, webhookID string) error {
+	canceller, ok := queueAdapter.(Canceller)
+	if !ok {
+		return ErrCancelNotSupported
+	}
+
+	url, err := canceller.CancelWebhook(ctx, webhookID)
+	if err != nil {
+		return err
+	}
+
+	return queueAdapter.PublishStatus(ctx, webhookID, url, "", "", "cancelled", "", 0, 0)
+}
+
+// DeadLetterQueue is implemented by the adapters that can inspect and replay their dead letters.
+type DeadLetterQueue interface {
+	ListDeadLetters(ctx context.Context, filter DeadLetterFilter) ([]DeadLetter, error)
+	GetDeadLetter(ctx context.Context, id string) (DeadLetter, error)
+	// RedriveDeadLetters queues the selected dead letters again with a fresh attempt history and
+	// removes them from the dead-letter queue.
+	RedriveDeadLetters(ctx context.Context, filter DeadLetterFilter) (int, error)
+	PurgeDeadLetters(ctx context.Context, filter DeadLetterFilter) (int, error)
 }
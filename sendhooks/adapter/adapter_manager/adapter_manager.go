@@ -2,11 +2,17 @@ package adapter_manager
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
 	"sendhooks/adapter"
 	"sync"
 
+	amqpadapter "sendhooks/adapter/amqp_adapter"
+	kafkaadapter "sendhooks/adapter/kafka_adapter"
+	localadapter "sendhooks/adapter/local_adapter"
+	natsadapter "sendhooks/adapter/nats_adapter"
+	postgresadapter "sendhooks/adapter/postgres_adapter"
 	redisadapter "sendhooks/adapter/redis_adapter"
 )
 
@@ -41,18 +47,36 @@ func GetConfig() adapter.Configuration {
 	return config
 }
 
+// NewAdapter creates the adapter matching the configured broker.
+func NewAdapter(conf adapter.Configuration) (adapter.Adapter, error) {
+	switch conf.Broker {
+	case "redis":
+		return redisadapter.NewRedisAdapter(conf), nil
+	case "kafka":
+		return kafkaadapter.NewKafkaAdapter(conf), nil
+	case "amqp":
+		return amqpadapter.NewAmqpAdapter(conf), nil
+	case "nats":
+		return natsadapter.NewNatsAdapter(conf), nil
+	case "postgres":
+		return postgresadapter.NewPostgresAdapter(conf), nil
+	case "local":
+		return localadapter.NewLocalAdapter(conf), nil
+	default:
+		return nil, fmt.Errorf("unsupported broker type: %v", conf.Broker)
+	}
+}
+
 // Initialize initializes the appropriate adapter based on the configuration.
 func Initialize() {
 	once.Do(func() {
-		conf := GetConfig()
-		switch conf.Broker {
-		case "redis":
-			instance = redisadapter.NewRedisAdapter(conf)
-		default:
-			log.Fatalf("Unsupported broker type: %v", conf.Broker)
+		var err error
+		instance, err = NewAdapter(GetConfig())
+		if err != nil {
+			log.Fatalf("%v", err)
 		}
 
-		err := instance.Connect()
+		err = instance.Connect()
 		if err != nil {
 			log.Fatalf("Failed to connect to broker: %v", err)
 		}
@@ -0,0 +1,262 @@
+package amqpadapter
+
+/*
+These tests run the AMQP adapter against an in-process fake of the connection and its channels, to check the
+reconnection, the publisher confirms and the routing of the retries through the retry queue.
+*/
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"sendhooks/adapter"
+	"sendhooks/logging"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeConfirmation struct {
+	acked bool
+}
+
+func (f fakeConfirmation) WaitContext(ctx context.Context) (bool, error) {
+	return f.acked, nil
+}
+
+type publishedMessage struct {
+	exchange string
+	key      string
+	message  amqp.Publishing
+}
+
+// fakeBroker records what the adapter declares, publishes and acknowledges.
+type fakeBroker struct {
+	mu          sync.Mutex
+	connections []*fakeConnection
+	declared    map[string]amqp.Table
+	published   []publishedMessage
+	acked       []uint64
+	// nack makes the broker reject the published messages.
+	nack bool
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{declared: map[string]amqp.Table{}}
+}
+
+func (b *fakeBroker) dial(url string, tlsConfig *tls.Config) (amqpConnection, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	connection := &fakeConnection{broker: b, deliveries: make(chan amqp.Delivery, 10)}
+	b.connections = append(b.connections, connection)
+	return connection, nil
+}
+
+// connection returns the last connection opened by the adapter.
+func (b *fakeBroker) connection() *fakeConnection {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.connections[len(b.connections)-1]
+}
+
+func (b *fakeBroker) messages() []publishedMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]publishedMessage(nil), b.published...)
+}
+
+func (b *fakeBroker) ackedTags() []uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]uint64(nil), b.acked...)
+}
+
+func (b *fakeBroker) Ack(tag uint64, multiple bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.acked = append(b.acked, tag)
+	return nil
+}
+
+func (b *fakeBroker) Nack(tag uint64, multiple, requeue bool) error { return nil }
+
+func (b *fakeBroker) Reject(tag uint64, requeue bool) error { return nil }
+
+type fakeConnection struct {
+	broker     *fakeBroker
+	deliveries chan amqp.Delivery
+	closed     bool
+}
+
+func (c *fakeConnection) Channel() (amqpChannel, error) {
+	return &fakeChannel{connection: c}, nil
+}
+
+func (c *fakeConnection) IsClosed() bool { return c.closed }
+
+func (c *fakeConnection) Close() error {
+	c.closed = true
+	return nil
+}
+
+// deliver sends a message to the consumer, as the broker would.
+func (c *fakeConnection) deliver(t *testing.T, tag uint64, webhookID string) {
+	data, err := json.Marshal(adapter.WebhookPayload{URL: "http://example.com", WebhookID: webhookID})
+	assert.NoError(t, err)
+
+	c.deliveries <- amqp.Delivery{Acknowledger: c.broker, DeliveryTag: tag, Body: data}
+}
+
+type fakeChannel struct {
+	connection *fakeConnection
+}
+
+func (c *fakeChannel) Qos(prefetchCount, prefetchSize int, global bool) error { return nil }
+
+func (c *fakeChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	broker := c.connection.broker
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	broker.declared[name] = args
+	return amqp.Queue{Name: name}, nil
+}
+
+func (c *fakeChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	return nil
+}
+
+func (c *fakeChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	return nil
+}
+
+func (c *fakeChannel) Confirm(noWait bool) error { return nil }
+
+func (c *fakeChannel) ConsumeWithContext(ctx context.Context, queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	return c.connection.deliveries, nil
+}
+
+func (c *fakeChannel) PublishWithConfirm(ctx context.Context, exchange, key string, message amqp.Publishing) (confirmation, error) {
+	broker := c.connection.broker
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	broker.published = append(broker.published, publishedMessage{exchange: exchange, key: key, message: message})
+	return fakeConfirmation{acked: !broker.nack}, nil
+}
+
+func (c *fakeChannel) IsClosed() bool { return c.connection.closed }
+
+func (c *fakeChannel) Close() error { return nil }
+
+func newTestAdapter(t *testing.T) (*AmqpAdapter, *fakeBroker) {
+	logging.WebhookLogger = func(errorType string, message interface{}) error {
+		return nil
+	}
+
+	broker := newFakeBroker()
+	amqpAdapter := NewAmqpAdapter(adapter.Configuration{Amqp: adapter.AmqpConfig{AmqpQueue: "hooks"}})
+	amqpAdapter.dial = broker.dial
+	assert.NoError(t, amqpAdapter.Connect())
+	t.Cleanup(func() { amqpAdapter.Close() })
+
+	return amqpAdapter, broker
+}
+
+func receive(t *testing.T, queue chan adapter.WebhookPayload) adapter.WebhookPayload {
+	select {
+	case payload := <-queue:
+		return payload
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+		return adapter.WebhookPayload{}
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	amqpAdapter, broker := newTestAdapter(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queue := make(chan adapter.WebhookPayload, 1)
+	go amqpAdapter.SubscribeToQueue(ctx, queue)
+
+	lost := broker.connection()
+	lost.deliver(t, 1, "webhook-1")
+	first := receive(t, queue)
+	assert.Equal(t, "1-1", first.MessageID)
+
+	// The broker closes the connection: the adapter connects again and consumes the redelivered
+	// message under a new generation.
+	close(lost.deliveries)
+	assert.Eventually(t, func() bool {
+		return broker.connection() != lost
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.True(t, lost.closed)
+
+	broker.connection().deliver(t, 1, "webhook-1")
+	redelivered := receive(t, queue)
+	assert.Equal(t, "2-1", redelivered.MessageID)
+
+	// The delivery of the lost connection can't be acknowledged anymore.
+	assert.Error(t, amqpAdapter.Acknowledge(ctx, first))
+	assert.NoError(t, amqpAdapter.Acknowledge(ctx, redelivered))
+	assert.Equal(t, []uint64{1}, broker.ackedTags())
+}
+
+func TestPublisherConfirms(t *testing.T) {
+	amqpAdapter, broker := newTestAdapter(t)
+	ctx := context.Background()
+
+	_, err := amqpAdapter.Enqueue(ctx, adapter.WebhookPayload{URL: "http://example.com", WebhookID: "webhook-1", EnqueueID: "enqueue-1"})
+	assert.NoError(t, err)
+
+	messages := broker.messages()
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "hooks", messages[0].key)
+	assert.Equal(t, "enqueue-1", messages[0].message.MessageId)
+	assert.Equal(t, amqp.Persistent, messages[0].message.DeliveryMode)
+
+	// A message rejected by the broker is not enqueued.
+	broker.nack = true
+	_, err = amqpAdapter.Enqueue(ctx, adapter.WebhookPayload{URL: "http://example.com", WebhookID: "webhook-2"})
+	assert.Error(t, err)
+}
+
+func TestScheduleRetry(t *testing.T) {
+	amqpAdapter, broker := newTestAdapter(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The retries expire from the retry queue to the webhooks queue.
+	assert.Equal(t, amqp.Table{"x-dead-letter-exchange": "", "x-dead-letter-routing-key": "hooks"}, broker.declared["hooks.retries"])
+
+	queue := make(chan adapter.WebhookPayload, 1)
+	go amqpAdapter.SubscribeToQueue(ctx, queue)
+
+	broker.connection().deliver(t, 1, "webhook-1")
+	payload := receive(t, queue)
+	payload.Attempts = []adapter.DeliveryAttempt{{Error: "failed"}}
+
+	retryAt := time.Now().Add(time.Hour)
+	assert.NoError(t, amqpAdapter.ScheduleRetry(ctx, payload, retryAt))
+	assert.Equal(t, []uint64{1}, broker.ackedTags())
+
+	messages := broker.messages()
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "hooks.retries", messages[0].key)
+
+	// The message is held maxRetryHold at most, and its payload isn't delivered before the retry.
+	assert.Equal(t, strconv.FormatInt(maxRetryHold.Milliseconds(), 10), messages[0].message.Expiration)
+
+	var retried adapter.WebhookPayload
+	assert.NoError(t, json.Unmarshal(messages[0].message.Body, &retried))
+	assert.Empty(t, retried.MessageID)
+	assert.Len(t, retried.Attempts, 1)
+	assert.Equal(t, retryAt.UTC().Format(time.RFC3339), retried.DeliverAt)
+}
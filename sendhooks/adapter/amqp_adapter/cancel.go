@@ -0,0 +1,36 @@
+package amqpadapter
+
+import (
+	"context"
+	"fmt"
+
+	"sendhooks/adapter"
+	"sendhooks/logging"
+)
+
+// CancelWebhook marks the webhook as cancelled when it was enqueued or scheduled for a retry and not
+// acknowledged since. AMQP can't look a message up, so the webhooks published straight to the queue
+// can't be cancelled before their first retry.
+func (a *AmqpAdapter) CancelWebhook(ctx context.Context, webhookID string) (string, error) {
+	return a.cancels.Cancel(ctx, webhookID)
+}
+
+// WebhookCancelled tells if the webhook was cancelled.
+func (a *AmqpAdapter) WebhookCancelled(ctx context.Context, webhookID string) (bool, error) {
+	return a.cancels.Cancelled(ctx, webhookID)
+}
+
+// track remembers a pending webhook so it can be cancelled. The webhook is sent anyway when it can't
+// be tracked.
+func (a *AmqpAdapter) track(ctx context.Context, payload adapter.WebhookPayload) {
+	if err := a.cancels.Track(ctx, payload); err != nil {
+		logging.WebhookLogger(logging.WarningType, fmt.Errorf("error tracking webhook for cancellation: WebhookID : %s: %w", payload.WebhookID, err))
+	}
+}
+
+// forget forgets a webhook which reached a terminal outcome.
+func (a *AmqpAdapter) forget(ctx context.Context, webhookID string) {
+	if err := a.cancels.Forget(ctx, webhookID); err != nil {
+		logging.WebhookLogger(logging.WarningType, fmt.Errorf("error forgetting webhook for cancellation: WebhookID : %s: %w", webhookID, err))
+	}
+}
@@ -0,0 +1,36 @@
+package kafkaadapter
+
+import (
+	"context"
+	"fmt"
+
+	"sendhooks/adapter"
+	"sendhooks/logging"
+)
+
+// CancelWebhook marks the webhook as cancelled when it was enqueued or scheduled for a retry and not
+// acknowledged since. Kafka can't look a message up, so the webhooks produced straight to the topic
+// can't be cancelled before their first retry.
+func (k *KafkaAdapter) CancelWebhook(ctx context.Context, webhookID string) (string, error) {
+	return k.cancels.Cancel(ctx, webhookID)
+}
+
+// WebhookCancelled tells if the webhook was cancelled.
+func (k *KafkaAdapter) WebhookCancelled(ctx context.Context, webhookID string) (bool, error) {
+	return k.cancels.Cancelled(ctx, webhookID)
+}
+
+// track remembers a pending webhook so it can be cancelled. The webhook is sent anyway when it can't
+// be tracked.
+func (k *KafkaAdapter) track(ctx context.Context, payload adapter.WebhookPayload) {
+	if err := k.cancels.Track(ctx, payload); err != nil {
+		logging.WebhookLogger(logging.WarningType, fmt.Errorf("error tracking webhook for cancellation: WebhookID : %s: %w", payload.WebhookID, err))
+	}
+}
+
+// forget forgets a webhook which reached a terminal outcome.
+func (k *KafkaAdapter) forget(ctx context.Context, webhookID string) {
+	if err := k.cancels.Forget(ctx, webhookID); err != nil {
+		logging.WebhookLogger(logging.WarningType, fmt.Errorf("error forgetting webhook for cancellation: WebhookID : %s: %w", webhookID, err))
+	}
+}
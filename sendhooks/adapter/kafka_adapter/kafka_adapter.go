@@ -0,0 +1,473 @@
+package kafkaadapter
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sendhooks/adapter"
+	"sendhooks/cancellation"
+	"sendhooks/logging"
+	"sendhooks/utils"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	defaultConsumerGroup = "sendhooks"
+	retryAtHeader        = "retry-at"
+	// maxRetryHold is how long a message is held in the retry topic at most, counted from when it
+	// was written, so that a webhook delivered much later doesn't hold the retries behind it. A
+	// webhook released before its DeliverAt time is sent back to the retry topic by the worker.
+	maxRetryHold = time.Minute
+)
+
+// messageReader is the part of kafka.Reader used by the adapter.
+type messageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// messageWriter is the part of kafka.Writer used by the adapter.
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// KafkaAdapter implements the Adapter interface for Kafka.
+type KafkaAdapter struct {
+	config           adapter.Configuration
+	topic            string
+	statusTopic      string
+	retryTopic       string
+	deadLetterTopic  string
+	consumerGroup    string
+	reader           messageReader
+	retryReader      messageReader
+	writer           messageWriter
+	offsets          *offsetTracker
+	commitMu         sync.Mutex
+	retryPollTimeout time.Duration
+	// cancels tracks the pending webhooks, which Kafka can't look up, to cancel them.
+	cancels *cancellation.Registry
+
+	// newReader creates a reader in a consumer group.
+	newReader func(groupID, topic string) messageReader
+	// newStatusReader creates a reader starting at the end of the status topic.
+	newStatusReader func() messageReader
+}
+
+// NewKafkaAdapter creates a new KafkaAdapter instance.
+func NewKafkaAdapter(config adapter.Configuration) *KafkaAdapter {
+	consumerGroup := config.Kafka.KafkaConsumerGroup
+	if consumerGroup == "" {
+		consumerGroup = defaultConsumerGroup
+	}
+
+	retryTopic := config.Kafka.KafkaRetryTopic
+	if retryTopic == "" {
+		retryTopic = config.Kafka.KafkaTopic + ".retries"
+	}
+
+	deadLetterTopic := config.Kafka.KafkaDeadLetterTopic
+	if deadLetterTopic == "" {
+		deadLetterTopic = config.Kafka.KafkaTopic + ".dead-letter"
+	}
+
+	return &KafkaAdapter{
+		config:           config,
+		topic:            config.Kafka.KafkaTopic,
+		statusTopic:      config.Kafka.KafkaStatusTopic,
+		retryTopic:       retryTopic,
+		deadLetterTopic:  deadLetterTopic,
+		consumerGroup:    consumerGroup,
+		offsets:          newOffsetTracker(),
+		retryPollTimeout: time.Second,
+	}
+}
+
+// Connect creates the writer and prepares the readers. kafka-go connects lazily, so errors show up
+// on the first fetch or write.
+func (k *KafkaAdapter) Connect() error {
+	brokers := k.config.Kafka.KafkaBrokers
+	if len(brokers) == 0 {
+		brokers = []string{"localhost:9092"} // Default broker
+	}
+
+	if k.topic == "" {
+		return errors.New("kafkaTopic is required")
+	}
+
+	var tlsConfig *tls.Config
+	if strings.ToLower(k.config.Kafka.KafkaSsl) == "true" {
+		var err error
+		tlsConfig, err = utils.CreateTLSConfig(k.config.Kafka.KafkaCaCert, k.config.Kafka.KafkaClientCert, k.config.Kafka.KafkaClientKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	dialer := &kafka.Dialer{
+		Timeout:   10 * time.Second,
+		DualStack: true,
+		TLS:       tlsConfig,
+	}
+
+	// The readers join the consumer group, so they are only created when subscribing. Producers
+	// connect the adapter to enqueue without taking partitions from the workers.
+	k.newReader = func(groupID, topic string) messageReader {
+		return kafka.NewReader(kafka.ReaderConfig{
+			Brokers: brokers,
+			GroupID: groupID,
+			Topic:   topic,
+			Dialer:  dialer,
+		})
+	}
+
+	k.newStatusReader = func() messageReader {
+		// Every watcher has its own group, so that each one receives all the statuses. Its offsets
+		// are never committed and the group is removed by the broker once the watcher left.
+		return kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     brokers,
+			GroupID:     fmt.Sprintf("%s.status-watch.%d", k.consumerGroup, time.Now().UnixNano()),
+			Topic:       k.statusTopic,
+			Dialer:      dialer,
+			StartOffset: kafka.LastOffset,
+		})
+	}
+
+	var transport *kafka.Transport
+	if tlsConfig != nil {
+		transport = &kafka.Transport{TLS: tlsConfig}
+	}
+
+	k.writer = &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		Transport:    transport,
+	}
+
+	cancels, err := cancellation.NewRegistry(k.config, "sendhooks:cancel:"+k.topic+":")
+	if err != nil {
+		return err
+	}
+	k.cancels = cancels
+
+	return nil
+}
+
+// Close flushes the writer and closes the readers of the adapter.
+func (k *KafkaAdapter) Close() error {
+	err := k.writer.Close()
+	if closeErr := k.cancels.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+
+	for _, reader := range []messageReader{k.reader, k.retryReader} {
+		if reader == nil {
+			continue
+		}
+		if closeErr := reader.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// SubscribeToQueue fetches the webhooks from the topic and sends them to the workers. Offsets are
+// committed once the worker reports a terminal outcome.
+func (k *KafkaAdapter) SubscribeToQueue(ctx context.Context, queue chan<- adapter.WebhookPayload) error {
+	if k.reader == nil {
+		k.reader = k.newReader(k.consumerGroup, k.topic)
+		k.retryReader = k.newReader(k.consumerGroup+".retries", k.retryTopic)
+	}
+
+	go k.requeueRetries(ctx)
+
+	for {
+		message, err := k.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		var payload adapter.WebhookPayload
+		if err := json.Unmarshal(message.Value, &payload); err != nil {
+			logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error unmarshalling message data: %w", err))
+			k.offsets.track(message)
+			k.commit(ctx, message)
+			continue
+		}
+
+		payload.MessageID = k.offsets.track(message)
+
+		select {
+		case queue <- payload:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// requeueRetries reads the retry topic and moves each retry back to the webhooks topic once it's due.
+// Retries are read in order, so a retry waits for the ones before it in the same partition.
+func (k *KafkaAdapter) requeueRetries(ctx context.Context) {
+	for {
+		message, err := k.retryReader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error reading retry topic: %w", err))
+			select {
+			case <-time.After(k.retryPollTimeout):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		releaseAt := retryAt(message)
+		if !message.Time.IsZero() && message.Time.Add(maxRetryHold).Before(releaseAt) {
+			releaseAt = message.Time.Add(maxRetryHold)
+		}
+
+		if wait := time.Until(releaseAt); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		// The reader has moved past the message, so keep trying until it's written.
+		for {
+			err = k.writer.WriteMessages(ctx, kafka.Message{
+				Topic: k.topic,
+				Key:   message.Key,
+				Value: message.Value,
+			})
+			if err == nil {
+				break
+			}
+
+			logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error requeueing retry: %w", err))
+			select {
+			case <-time.After(k.retryPollTimeout):
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if err := k.retryReader.CommitMessages(ctx, message); err != nil {
+			logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error committing retry offset: %w", err))
+		}
+	}
+}
+
+// retryAt reads the time of the next attempt from the message headers.
+func retryAt(message kafka.Message) time.Time {
+	for _, header := range message.Headers {
+		if header.Key == retryAtHeader {
+			milliseconds, err := strconv.ParseInt(string(header.Value), 10, 64)
+			if err == nil {
+				return time.UnixMilli(milliseconds)
+			}
+		}
+	}
+
+	return time.Time{}
+}
+
+// PublishStatus publishes the status of a webhook delivery to the status topic.
+func (k *KafkaAdapter) PublishStatus(ctx context.Context, webhookID, url, created, delivered, status, deliveryError string, payloadSize int, numberOfTries int) error {
+	message := adapter.WebhookDeliveryStatus{
+		WebhookID:     webhookID,
+		Status:        status,
+		DeliveryError: deliveryError,
+		URL:           url,
+		Created:       created,
+		Delivered:     delivered,
+		PayloadSize:   payloadSize,
+		NumberOfTries: numberOfTries,
+	}
+
+	jsonString, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return k.writer.WriteMessages(ctx, kafka.Message{
+		Topic: k.statusTopic,
+		Key:   []byte(webhookID),
+		Value: jsonString,
+	})
+}
+
+// WatchStatuses consumes the statuses produced to the status topic from now on.
+func (k *KafkaAdapter) WatchStatuses(ctx context.Context, statuses chan<- adapter.WebhookDeliveryStatus) error {
+	if k.statusTopic == "" {
+		return errors.New("kafkaStatusTopic is required to watch statuses")
+	}
+
+	reader := k.newStatusReader()
+	defer reader.Close()
+
+	for {
+		message, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		var status adapter.WebhookDeliveryStatus
+		if err := json.Unmarshal(message.Value, &status); err != nil {
+			logging.WebhookLogger(logging.WarningType, fmt.Errorf("error unmarshalling status: %w", err))
+			continue
+		}
+
+		select {
+		case statuses <- status:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Acknowledge marks the message as done and commits the offsets that can be committed.
+func (k *KafkaAdapter) Acknowledge(ctx context.Context, payload adapter.WebhookPayload) error {
+	message, ok := k.offsets.message(payload.MessageID)
+	if !ok {
+		return fmt.Errorf("unknown message %s", payload.MessageID)
+	}
+
+	if payload.WebhookID != "" {
+		k.forget(ctx, payload.WebhookID)
+	}
+
+	return k.commit(ctx, message)
+}
+
+// Enqueue produces the payload to the topic, keyed by its ordering key or its webhook ID. Kafka
+// doesn't tell the position of the message in the consumer group, so it's always -1.
+func (k *KafkaAdapter) Enqueue(ctx context.Context, payload adapter.WebhookPayload) (int64, error) {
+	payload.MessageID = ""
+	payload.ResolveDelay(time.Now())
+	k.track(ctx, payload)
+
+	// A webhook delivered later waits in the retry topic.
+	if deliverAt, later := payload.DeliverLater(time.Now()); later {
+		return -1, k.writeRetry(ctx, payload, deliverAt)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	err = k.writer.WriteMessages(ctx, kafka.Message{
+		Topic: k.topic,
+		Key:   messageKey(payload),
+		Value: data,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return -1, nil
+}
+
+// ScheduleRetry writes the payload to the retry topic before committing the current message.
+func (k *KafkaAdapter) ScheduleRetry(ctx context.Context, payload adapter.WebhookPayload, retryAt time.Time) error {
+	messageID := payload.MessageID
+	payload.MessageID = ""
+
+	k.track(ctx, payload)
+	if err := k.writeRetry(ctx, payload, retryAt); err != nil {
+		return err
+	}
+
+	return k.Acknowledge(ctx, adapter.WebhookPayload{MessageID: messageID})
+}
+
+// writeRetry writes the payload to the retry topic until retryAt. The payload is not delivered
+// before retryAt even when the retry topic releases it early.
+func (k *KafkaAdapter) writeRetry(ctx context.Context, payload adapter.WebhookPayload, retryAt time.Time) error {
+	payload.DeliverNotBefore(retryAt)
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return k.writer.WriteMessages(ctx, kafka.Message{
+		Topic:   k.retryTopic,
+		Key:     messageKey(payload),
+		Value:   data,
+		Headers: []kafka.Header{{Key: retryAtHeader, Value: []byte(strconv.FormatInt(retryAt.UnixMilli(), 10))}},
+	})
+}
+
+// messageKey keys the webhooks sharing an ordering key alike, so they land on the same partition
+// and are read in order by a single consumer.
+func messageKey(payload adapter.WebhookPayload) []byte {
+	if payload.OrderingKey != "" {
+		return []byte(payload.OrderingKey)
+	}
+	return []byte(payload.WebhookID)
+}
+
+// DeadLetter writes the payload to the dead-letter topic before committing the current message.
+func (k *KafkaAdapter) DeadLetter(ctx context.Context, payload adapter.WebhookPayload, lastError string) error {
+	messageID := payload.MessageID
+	payload.MessageID = ""
+
+	data, err := json.Marshal(adapter.DeadLetter{
+		Payload:   payload,
+		LastError: lastError,
+		Failed:    time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = k.writer.WriteMessages(ctx, kafka.Message{
+		Topic: k.deadLetterTopic,
+		Key:   []byte(payload.WebhookID),
+		Value: data,
+	})
+	if err != nil {
+		return err
+	}
+
+	k.forget(ctx, payload.WebhookID)
+
+	return k.Acknowledge(ctx, adapter.WebhookPayload{MessageID: messageID})
+}
+
+// commit marks the message as done and commits the highest offset below which every message is done.
+// Commits are serialized so that an offset is never committed after a higher one.
+func (k *KafkaAdapter) commit(ctx context.Context, message kafka.Message) error {
+	k.commitMu.Lock()
+	defer k.commitMu.Unlock()
+
+	committable, ok := k.offsets.complete(message)
+	if !ok {
+		return nil
+	}
+
+	return k.reader.CommitMessages(ctx, committable)
+}
@@ -0,0 +1,255 @@
+package kafkaadapter
+
+/*
+These tests run the Kafka adapter against an in-process fake of the reader and the writer, to check that offsets
+are only committed once every message before them reached a terminal outcome.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"sendhooks/adapter"
+	"sendhooks/cancellation"
+	"sendhooks/logging"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeReader struct {
+	messages  chan kafka.Message
+	mu        sync.Mutex
+	committed []kafka.Message
+}
+
+func newFakeReader() *fakeReader {
+	return &fakeReader{messages: make(chan kafka.Message, 10)}
+}
+
+func (f *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case message := <-f.messages:
+		return message, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (f *fakeReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.committed = append(f.committed, msgs...)
+	return nil
+}
+
+func (f *fakeReader) Close() error { return nil }
+
+func (f *fakeReader) committedOffsets() []int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var offsets []int64
+	for _, message := range f.committed {
+		offsets = append(offsets, message.Offset)
+	}
+	return offsets
+}
+
+type fakeWriter struct {
+	mu       sync.Mutex
+	messages []kafka.Message
+}
+
+func (f *fakeWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages = append(f.messages, msgs...)
+	return nil
+}
+
+func (f *fakeWriter) Close() error { return nil }
+
+func (f *fakeWriter) written() []kafka.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]kafka.Message(nil), f.messages...)
+}
+
+func newTestAdapter() (*KafkaAdapter, *fakeReader, *fakeReader, *fakeWriter) {
+	logging.WebhookLogger = func(errorType string, message interface{}) error {
+		return nil
+	}
+
+	kafkaAdapter := NewKafkaAdapter(adapter.Configuration{
+		Kafka: adapter.KafkaConfig{
+			KafkaTopic:       "hooks",
+			KafkaStatusTopic: "hooks-status",
+		},
+	})
+
+	reader, retryReader, writer := newFakeReader(), newFakeReader(), &fakeWriter{}
+	kafkaAdapter.reader = reader
+	kafkaAdapter.retryReader = retryReader
+	kafkaAdapter.writer = writer
+	kafkaAdapter.retryPollTimeout = 10 * time.Millisecond
+	kafkaAdapter.cancels = cancellation.NewRegistryWithStore(cancellation.NewMemoryStore())
+
+	return kafkaAdapter, reader, retryReader, writer
+}
+
+func testMessage(t *testing.T, offset int64, webhookID string) kafka.Message {
+	data, err := json.Marshal(adapter.WebhookPayload{URL: "http://example.com", WebhookID: webhookID})
+	assert.NoError(t, err)
+
+	return kafka.Message{Topic: "hooks", Partition: 0, Offset: offset, Value: data}
+}
+
+func TestOffsetsAreCommittedInOrder(t *testing.T) {
+	kafkaAdapter, reader, _, _ := newTestAdapter()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for offset := int64(0); offset < 3; offset++ {
+		reader.messages <- testMessage(t, offset, "webhook")
+	}
+
+	queue := make(chan adapter.WebhookPayload, 3)
+	go kafkaAdapter.SubscribeToQueue(ctx, queue)
+
+	payloads := []adapter.WebhookPayload{<-queue, <-queue, <-queue}
+
+	// The second message is done first, nothing can be committed yet.
+	assert.NoError(t, kafkaAdapter.Acknowledge(ctx, payloads[1]))
+	assert.Empty(t, reader.committedOffsets())
+
+	assert.NoError(t, kafkaAdapter.Acknowledge(ctx, payloads[0]))
+	assert.Equal(t, []int64{1}, reader.committedOffsets())
+
+	assert.NoError(t, kafkaAdapter.Acknowledge(ctx, payloads[2]))
+	assert.Equal(t, []int64{1, 2}, reader.committedOffsets())
+
+	assert.Error(t, kafkaAdapter.Acknowledge(ctx, payloads[2]))
+}
+
+func TestScheduleRetry(t *testing.T) {
+	kafkaAdapter, reader, retryReader, writer := newTestAdapter()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reader.messages <- testMessage(t, 0, "webhook-1")
+
+	queue := make(chan adapter.WebhookPayload, 1)
+	go kafkaAdapter.SubscribeToQueue(ctx, queue)
+
+	payload := <-queue
+	payload.Attempts = []adapter.DeliveryAttempt{{Error: "failed"}}
+	assert.NoError(t, kafkaAdapter.ScheduleRetry(ctx, payload, time.Now().Add(50*time.Millisecond)))
+	assert.Equal(t, []int64{0}, reader.committedOffsets())
+
+	written := writer.written()
+	assert.Len(t, written, 1)
+	assert.Equal(t, "hooks.retries", written[0].Topic)
+
+	// The retry goes back to the webhooks topic once it's due.
+	retryReader.messages <- written[0]
+	assert.Eventually(t, func() bool {
+		return len(writer.written()) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	requeued := writer.written()[1]
+	assert.Equal(t, "hooks", requeued.Topic)
+	assert.Equal(t, []int64{0}, retryReader.committedOffsets())
+
+	var retried adapter.WebhookPayload
+	assert.NoError(t, json.Unmarshal(requeued.Value, &retried))
+	assert.Equal(t, "webhook-1", retried.WebhookID)
+	assert.Len(t, retried.Attempts, 1)
+	assert.False(t, retryAt(written[0]).After(time.Now()))
+}
+
+func TestEnqueueDelayed(t *testing.T) {
+	kafkaAdapter, _, retryReader, writer := newTestAdapter()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	deliverAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	_, err := kafkaAdapter.Enqueue(ctx, adapter.WebhookPayload{URL: "http://example.com", WebhookID: "webhook-1", DeliverAt: deliverAt})
+	assert.NoError(t, err)
+
+	written := writer.written()
+	assert.Len(t, written, 1)
+	assert.Equal(t, "hooks.retries", written[0].Topic)
+
+	// A message held for long in the retry topic is released early, its DeliverAt time is kept
+	// for the worker to send it back.
+	go kafkaAdapter.SubscribeToQueue(ctx, make(chan adapter.WebhookPayload, 1))
+
+	message := written[0]
+	message.Time = time.Now().Add(-2 * maxRetryHold)
+	retryReader.messages <- message
+	assert.Eventually(t, func() bool {
+		return len(writer.written()) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	var released adapter.WebhookPayload
+	assert.NoError(t, json.Unmarshal(writer.written()[1].Value, &released))
+	assert.Equal(t, deliverAt, released.DeliverAt)
+}
+
+func TestDeadLetter(t *testing.T) {
+	kafkaAdapter, reader, _, writer := newTestAdapter()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reader.messages <- testMessage(t, 0, "webhook-1")
+
+	queue := make(chan adapter.WebhookPayload, 1)
+	go kafkaAdapter.SubscribeToQueue(ctx, queue)
+
+	assert.NoError(t, kafkaAdapter.DeadLetter(ctx, <-queue, "failed"))
+	assert.Equal(t, []int64{0}, reader.committedOffsets())
+
+	written := writer.written()
+	assert.Len(t, written, 1)
+	assert.Equal(t, "hooks.dead-letter", written[0].Topic)
+
+	var deadLetter adapter.DeadLetter
+	assert.NoError(t, json.Unmarshal(written[0].Value, &deadLetter))
+	assert.Equal(t, "webhook-1", deadLetter.Payload.WebhookID)
+	assert.Equal(t, "failed", deadLetter.LastError)
+}
+
+func TestCancelWebhook(t *testing.T) {
+	kafkaAdapter, reader, _, writer := newTestAdapter()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := kafkaAdapter.CancelWebhook(ctx, "webhook-1")
+	assert.ErrorIs(t, err, adapter.ErrWebhookNotFound)
+
+	_, err = kafkaAdapter.Enqueue(ctx, adapter.WebhookPayload{URL: "http://example.com", WebhookID: "webhook-1"})
+	assert.NoError(t, err)
+	url, err := kafkaAdapter.CancelWebhook(ctx, "webhook-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com", url)
+
+	cancelled, err := kafkaAdapter.WebhookCancelled(ctx, "webhook-1")
+	assert.NoError(t, err)
+	assert.True(t, cancelled)
+
+	// A webhook can't be cancelled once acknowledged.
+	message := writer.written()[0]
+	message.Partition, message.Offset = 0, 0
+	reader.messages <- message
+
+	queue := make(chan adapter.WebhookPayload, 1)
+	go kafkaAdapter.SubscribeToQueue(ctx, queue)
+
+	assert.NoError(t, kafkaAdapter.Acknowledge(ctx, <-queue))
+	_, err = kafkaAdapter.CancelWebhook(ctx, "webhook-1")
+	assert.ErrorIs(t, err, adapter.ErrWebhookNotFound)
+}
@@ -0,0 +1,101 @@
+package kafkaadapter
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// offsetTracker keeps track of the messages handed to the workers. Workers finish in any order,
+// but committing an offset commits every offset below it, so an offset can only be committed once
+// every message before it in the partition is done.
+type offsetTracker struct {
+	mu         sync.Mutex
+	messages   map[string]kafka.Message
+	partitions map[int]*partitionOffsets
+}
+
+type partitionOffsets struct {
+	pending map[int64]bool
+	done    map[int64]kafka.Message
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		messages:   make(map[string]kafka.Message),
+		partitions: make(map[int]*partitionOffsets),
+	}
+}
+
+// messageID identifies a message by its topic, partition and offset.
+func messageID(message kafka.Message) string {
+	return fmt.Sprintf("%s/%d/%d", message.Topic, message.Partition, message.Offset)
+}
+
+// track registers a fetched message and returns its ID.
+func (t *offsetTracker) track(message kafka.Message) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	partition, ok := t.partitions[message.Partition]
+	if !ok {
+		partition = &partitionOffsets{
+			pending: make(map[int64]bool),
+			done:    make(map[int64]kafka.Message),
+		}
+		t.partitions[message.Partition] = partition
+	}
+	partition.pending[message.Offset] = true
+
+	id := messageID(message)
+	t.messages[id] = message
+	return id
+}
+
+// message returns the tracked message with the given ID.
+func (t *offsetTracker) message(id string) (kafka.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	message, ok := t.messages[id]
+	return message, ok
+}
+
+// complete marks the message as done. It returns the message with the highest offset that can be
+// committed, if any.
+func (t *offsetTracker) complete(message kafka.Message) (kafka.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.messages, messageID(message))
+
+	partition, ok := t.partitions[message.Partition]
+	if !ok || !partition.pending[message.Offset] {
+		return kafka.Message{}, false
+	}
+	delete(partition.pending, message.Offset)
+	partition.done[message.Offset] = message
+
+	lowestPending := int64(-1)
+	for offset := range partition.pending {
+		if lowestPending == -1 || offset < lowestPending {
+			lowestPending = offset
+		}
+	}
+
+	var committable kafka.Message
+	found := false
+	for offset, doneMessage := range partition.done {
+		if lowestPending != -1 && offset > lowestPending {
+			continue
+		}
+		if !found || offset > committable.Offset {
+			committable = doneMessage
+			found = true
+		}
+		delete(partition.done, offset)
+	}
+
+	return committable, found
+}
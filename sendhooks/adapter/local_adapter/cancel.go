@@ -0,0 +1,74 @@
+package localadapter
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"sendhooks/adapter"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// CancelWebhook marks the webhook as cancelled when it's scheduled or in flight, and forgets the
+// cancellations older than the retention.
+func (l *LocalAdapter) CancelWebhook(ctx context.Context, webhookID string) (string, error) {
+	now := time.Now().UTC()
+
+	var url string
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		var found bool
+		url, found = findPending(tx, webhookID)
+		if !found {
+			return adapter.ErrWebhookNotFound
+		}
+
+		cancelled := tx.Bucket(cancelledBucket)
+
+		var expired [][]byte
+		err := cancelled.ForEach(func(id, at []byte) error {
+			cancelledAt, err := time.Parse(time.RFC3339, string(at))
+			if err != nil || now.Sub(cancelledAt) > adapter.CancelRetention {
+				expired = append(expired, id)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, id := range expired {
+			if err := cancelled.Delete(id); err != nil {
+				return err
+			}
+		}
+
+		return cancelled.Put([]byte(webhookID), []byte(now.Format(time.RFC3339)))
+	})
+
+	return url, err
+}
+
+// findPending returns the URL of the webhook waiting in the scheduled or the in-flight bucket.
+func findPending(tx *bolt.Tx, webhookID string) (string, bool) {
+	for _, name := range [][]byte{scheduledBucket, inFlightBucket} {
+		cursor := tx.Bucket(name).Cursor()
+		for key, data := cursor.First(); key != nil; key, data = cursor.Next() {
+			var payload adapter.WebhookPayload
+			if err := json.Unmarshal(data, &payload); err == nil && payload.WebhookID == webhookID {
+				return payload.URL, true
+			}
+		}
+	}
+	return "", false
+}
+
+// WebhookCancelled tells if the webhook was cancelled.
+func (l *LocalAdapter) WebhookCancelled(ctx context.Context, webhookID string) (bool, error) {
+	var found bool
+	err := l.db.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket(cancelledBucket).Get([]byte(webhookID)) != nil
+		return nil
+	})
+	return found, err
+}
@@ -0,0 +1,160 @@
+package localadapter
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"sendhooks/adapter"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// DeadLetter moves the webhook from the in-flight bucket to the dead letters bucket.
+func (l *LocalAdapter) DeadLetter(ctx context.Context, payload adapter.WebhookPayload, lastError string) error {
+	id, err := messageKey(payload.MessageID)
+	if err != nil {
+		return err
+	}
+	payload.MessageID = ""
+
+	data, err := json.Marshal(adapter.DeadLetter{
+		Payload:   payload,
+		LastError: lastError,
+		Failed:    time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+
+	return l.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(inFlightBucket).Delete(id); err != nil {
+			return err
+		}
+		return tx.Bucket(deadLettersBucket).Put(id, data)
+	})
+}
+
+// forEachDeadLetter calls fn for every dead letter selected by the filter.
+func forEachDeadLetter(tx *bolt.Tx, filter adapter.DeadLetterFilter, fn func(key []byte, deadLetter adapter.DeadLetter) error) error {
+	var keys [][]byte
+	var deadLetters []adapter.DeadLetter
+
+	err := tx.Bucket(deadLettersBucket).ForEach(func(key, data []byte) error {
+		var deadLetter adapter.DeadLetter
+		if err := json.Unmarshal(data, &deadLetter); err != nil {
+			return err
+		}
+
+		deadLetter.ID = strconv.FormatUint(binary.BigEndian.Uint64(key), 10)
+		if filter.Matches(deadLetter) {
+			keys = append(keys, append([]byte(nil), key...))
+			deadLetters = append(deadLetters, deadLetter)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The callbacks run once the iteration is over, so they can modify the bucket.
+	for i, key := range keys {
+		if err := fn(key, deadLetters[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ListDeadLetters returns the dead letters selected by the filter, oldest first.
+func (l *LocalAdapter) ListDeadLetters(ctx context.Context, filter adapter.DeadLetterFilter) ([]adapter.DeadLetter, error) {
+	var deadLetters []adapter.DeadLetter
+
+	err := l.db.View(func(tx *bolt.Tx) error {
+		return forEachDeadLetter(tx, filter, func(key []byte, deadLetter adapter.DeadLetter) error {
+			deadLetters = append(deadLetters, deadLetter)
+			return nil
+		})
+	})
+
+	return deadLetters, err
+}
+
+// GetDeadLetter returns a single dead letter.
+func (l *LocalAdapter) GetDeadLetter(ctx context.Context, id string) (adapter.DeadLetter, error) {
+	deadLetters, err := l.ListDeadLetters(ctx, adapter.DeadLetterFilter{ID: id})
+	if err != nil {
+		return adapter.DeadLetter{}, err
+	}
+
+	if len(deadLetters) == 0 {
+		return adapter.DeadLetter{}, fmt.Errorf("dead letter %s not found", id)
+	}
+
+	return deadLetters[0], nil
+}
+
+// RedriveDeadLetters moves the selected dead letters back to the scheduled bucket. They start over
+// as accepted now, so the max age of their retry policy counts from the redrive.
+func (l *LocalAdapter) RedriveDeadLetters(ctx context.Context, filter adapter.DeadLetterFilter) (int, error) {
+	redriven := 0
+
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		now := time.Now()
+
+		return forEachDeadLetter(tx, filter, func(key []byte, deadLetter adapter.DeadLetter) error {
+			payload := deadLetter.Payload
+			payload.Attempts = nil
+			payload.Accepted = now.UTC().Format(time.RFC3339)
+			payload.RateLimitReserved = false
+
+			data, err := json.Marshal(payload)
+			if err != nil {
+				return err
+			}
+
+			if err := tx.Bucket(scheduledBucket).Put(scheduledKey(now, key), data); err != nil {
+				return err
+			}
+			if err := tx.Bucket(deadLettersBucket).Delete(key); err != nil {
+				return err
+			}
+
+			redriven++
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if redriven > 0 {
+		select {
+		case l.enqueued <- struct{}{}:
+		default:
+		}
+	}
+
+	return redriven, nil
+}
+
+// PurgeDeadLetters deletes the selected dead letters.
+func (l *LocalAdapter) PurgeDeadLetters(ctx context.Context, filter adapter.DeadLetterFilter) (int, error) {
+	purged := 0
+
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		return forEachDeadLetter(tx, filter, func(key []byte, deadLetter adapter.DeadLetter) error {
+			purged++
+			return tx.Bucket(deadLettersBucket).Delete(key)
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,413 @@
+package localadapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"sendhooks/adapter"
+	"sendhooks/logging"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	defaultPath          = "sendhooks.db"
+	defaultStatusHistory = 10000
+	pollInterval         = time.Second
+	watcherBufferSize    = 64
+)
+
+var (
+	scheduledBucket   = []byte("scheduled")
+	inFlightBucket    = []byte("in_flight")
+	deadLettersBucket = []byte("dead_letters")
+	statusesBucket    = []byte("statuses")
+	cancelledBucket   = []byte("cancelled")
+)
+
+// LocalAdapter implements the Adapter interface on top of an embedded bbolt database, for
+// single-node deployments without any external broker.
+//
+// Webhooks waiting for delivery are stored in the scheduled bucket, keyed by their due time and
+// their ID, so that the due webhooks are always at the beginning of the bucket. They move to the
+// in-flight bucket while a worker delivers them.
+type LocalAdapter struct {
+	config        adapter.Configuration
+	path          string
+	statusHistory int
+	db            *bolt.DB
+	// enqueued wakes up the subscriber when a webhook is queued.
+	enqueued chan struct{}
+
+	mu       sync.Mutex
+	watchers map[chan adapter.WebhookDeliveryStatus]struct{}
+}
+
+// NewLocalAdapter creates a new LocalAdapter instance.
+func NewLocalAdapter(config adapter.Configuration) *LocalAdapter {
+	path := config.Local.LocalPath
+	if path == "" {
+		path = defaultPath
+	}
+
+	statusHistory := config.Local.LocalStatusHistory
+	if statusHistory <= 0 {
+		statusHistory = defaultStatusHistory
+	}
+
+	return &LocalAdapter{
+		config:        config,
+		path:          path,
+		statusHistory: statusHistory,
+		enqueued:      make(chan struct{}, 1),
+		watchers:      make(map[chan adapter.WebhookDeliveryStatus]struct{}),
+	}
+}
+
+// Connect opens the database and queues again the webhooks that were in flight when the engine stopped.
+func (l *LocalAdapter) Connect() error {
+	db, err := bolt.Open(l.path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", l.path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{scheduledBucket, inFlightBucket, deadLettersBucket, statusesBucket, cancelledBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		inFlight := tx.Bucket(inFlightBucket)
+		scheduled := tx.Bucket(scheduledBucket)
+		now := time.Now()
+
+		var ids [][]byte
+		err := inFlight.ForEach(func(id, data []byte) error {
+			ids = append(ids, id)
+			return scheduled.Put(scheduledKey(now, id), data)
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			if err := inFlight.Delete(id); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return err
+	}
+
+	l.db = db
+	return nil
+}
+
+// Close closes the database file, releasing its lock.
+func (l *LocalAdapter) Close() error {
+	return l.db.Close()
+}
+
+// itob encodes an ID as a sortable key.
+func itob(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+// scheduledKey builds the key of a webhook due at the given time.
+func scheduledKey(due time.Time, id []byte) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, uint64(due.UnixNano()))
+	copy(key[8:], id)
+	return key
+}
+
+// messageKey converts a message ID back to its key.
+func messageKey(messageID string) ([]byte, error) {
+	id, err := strconv.ParseUint(messageID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message id %q", messageID)
+	}
+	return itob(id), nil
+}
+
+// Enqueue stores the payload, due immediately or at its DeliverAt time.
+func (l *LocalAdapter) Enqueue(ctx context.Context, payload adapter.WebhookPayload) (int64, error) {
+	payload.MessageID = ""
+	payload.ResolveDelay(time.Now())
+
+	due := time.Now()
+	if deliverAt, later := payload.DeliverLater(due); later {
+		due = deliverAt
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	var position int64
+	err = l.db.Update(func(tx *bolt.Tx) error {
+		scheduled := tx.Bucket(scheduledBucket)
+
+		id, err := scheduled.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		key := scheduledKey(due, itob(id))
+		if err := scheduled.Put(key, data); err != nil {
+			return err
+		}
+
+		// The webhooks due before this one are delivered first.
+		cursor := scheduled.Cursor()
+		for k, _ := cursor.First(); k != nil && bytes.Compare(k, key) <= 0; k, _ = cursor.Next() {
+			position++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	select {
+	case l.enqueued <- struct{}{}:
+	default:
+	}
+
+	return position, nil
+}
+
+// SubscribeToQueue sends the due webhooks to the workers.
+func (l *LocalAdapter) SubscribeToQueue(ctx context.Context, queue chan<- adapter.WebhookPayload) error {
+	batchSize := l.config.ChannelSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	for {
+		payloads, err := l.claim(batchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, payload := range payloads {
+			select {
+			case queue <- payload:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if len(payloads) < batchSize {
+			select {
+			case <-l.enqueued:
+			case <-time.After(pollInterval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// claim moves up to limit due webhooks to the in-flight bucket and returns them.
+func (l *LocalAdapter) claim(limit int) ([]adapter.WebhookPayload, error) {
+	var payloads []adapter.WebhookPayload
+
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		scheduled := tx.Bucket(scheduledBucket)
+		inFlight := tx.Bucket(inFlightBucket)
+		now := uint64(time.Now().UnixNano())
+
+		var claimed [][]byte
+		cursor := scheduled.Cursor()
+		for key, data := cursor.First(); key != nil && len(claimed) < limit; key, data = cursor.Next() {
+			if binary.BigEndian.Uint64(key[:8]) > now {
+				break
+			}
+			claimed = append(claimed, key)
+
+			id := key[8:]
+			var payload adapter.WebhookPayload
+			if err := json.Unmarshal(data, &payload); err != nil {
+				logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error unmarshalling message data: %w", err))
+				continue
+			}
+
+			if err := inFlight.Put(id, data); err != nil {
+				return err
+			}
+
+			payload.MessageID = strconv.FormatUint(binary.BigEndian.Uint64(id), 10)
+			payloads = append(payloads, payload)
+		}
+
+		for _, key := range claimed {
+			if err := scheduled.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return payloads, err
+}
+
+// PublishStatus adds the status to the status history and deletes the oldest statuses beyond the
+// configured history size.
+func (l *LocalAdapter) PublishStatus(ctx context.Context, webhookID, url, created, delivered, status, deliveryError string, payloadSize int, numberOfTries int) error {
+	message := adapter.WebhookDeliveryStatus{
+		WebhookID:     webhookID,
+		Status:        status,
+		DeliveryError: deliveryError,
+		URL:           url,
+		Created:       created,
+		Delivered:     delivered,
+		PayloadSize:   payloadSize,
+		NumberOfTries: numberOfTries,
+	}
+
+	jsonString, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	err = l.db.Update(func(tx *bolt.Tx) error {
+		statuses := tx.Bucket(statusesBucket)
+
+		id, err := statuses.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		if err := statuses.Put(itob(id), jsonString); err != nil {
+			return err
+		}
+
+		cursor := statuses.Cursor()
+		for key, _ := cursor.First(); key != nil && id-binary.BigEndian.Uint64(key) >= uint64(l.statusHistory); key, _ = cursor.First() {
+			if err := statuses.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	l.notifyWatchers(message)
+	return nil
+}
+
+// notifyWatchers sends the status to the watchers. A watcher that doesn't keep up misses the
+// status rather than blocking the workers.
+func (l *LocalAdapter) notifyWatchers(status adapter.WebhookDeliveryStatus) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for watcher := range l.watchers {
+		select {
+		case watcher <- status:
+		default:
+			logging.WebhookLogger(logging.WarningType, fmt.Errorf("status watcher is full, dropping status of webhook %s", status.WebhookID))
+		}
+	}
+}
+
+// WatchStatuses receives the statuses published by this engine from now on.
+func (l *LocalAdapter) WatchStatuses(ctx context.Context, statuses chan<- adapter.WebhookDeliveryStatus) error {
+	watcher := make(chan adapter.WebhookDeliveryStatus, watcherBufferSize)
+
+	l.mu.Lock()
+	l.watchers[watcher] = struct{}{}
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		delete(l.watchers, watcher)
+		l.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case status := <-watcher:
+			select {
+			case statuses <- status:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ListStatuses returns the status history of a webhook, oldest first.
+func (l *LocalAdapter) ListStatuses(ctx context.Context, webhookID string) ([]adapter.WebhookDeliveryStatus, error) {
+	var statuses []adapter.WebhookDeliveryStatus
+
+	err := l.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(statusesBucket).ForEach(func(key, data []byte) error {
+			var status adapter.WebhookDeliveryStatus
+			if err := json.Unmarshal(data, &status); err != nil {
+				return err
+			}
+
+			if status.WebhookID == webhookID {
+				statuses = append(statuses, status)
+			}
+			return nil
+		})
+	})
+
+	return statuses, err
+}
+
+// Acknowledge removes the webhook from the in-flight bucket.
+func (l *LocalAdapter) Acknowledge(ctx context.Context, payload adapter.WebhookPayload) error {
+	id, err := messageKey(payload.MessageID)
+	if err != nil {
+		return err
+	}
+
+	return l.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(inFlightBucket).Delete(id)
+	})
+}
+
+// ScheduleRetry moves the webhook from the in-flight bucket back to the scheduled bucket, due at retryAt.
+func (l *LocalAdapter) ScheduleRetry(ctx context.Context, payload adapter.WebhookPayload, retryAt time.Time) error {
+	id, err := messageKey(payload.MessageID)
+	if err != nil {
+		return err
+	}
+	payload.MessageID = ""
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return l.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(inFlightBucket).Delete(id); err != nil {
+			return err
+		}
+		return tx.Bucket(scheduledBucket).Put(scheduledKey(retryAt, id), data)
+	})
+}
@@ -0,0 +1,198 @@
+package localadapter
+
+/*
+These tests run the local adapter against a database in a temporary directory, to check that webhooks survive a
+restart, that retries wait for their due time and that the status history is bounded.
+*/
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sendhooks/adapter"
+	"sendhooks/logging"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAdapter(t *testing.T, path string) *LocalAdapter {
+	logging.WebhookLogger = func(errorType string, message interface{}) error {
+		return nil
+	}
+
+	localAdapter := NewLocalAdapter(adapter.Configuration{
+		Local:       adapter.LocalConfig{LocalPath: path, LocalStatusHistory: 2},
+		ChannelSize: 1,
+	})
+	assert.NoError(t, localAdapter.Connect())
+
+	return localAdapter
+}
+
+func receive(t *testing.T, queue chan adapter.WebhookPayload) adapter.WebhookPayload {
+	select {
+	case payload := <-queue:
+		return payload
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+		return adapter.WebhookPayload{}
+	}
+}
+
+func TestEnqueueAndAcknowledge(t *testing.T) {
+	localAdapter := newTestAdapter(t, filepath.Join(t.TempDir(), "sendhooks.db"))
+	defer localAdapter.db.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	position, err := localAdapter.Enqueue(ctx, adapter.WebhookPayload{URL: "http://example.com", WebhookID: "webhook-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), position)
+
+	queue := make(chan adapter.WebhookPayload, 1)
+	go localAdapter.SubscribeToQueue(ctx, queue)
+
+	payload := receive(t, queue)
+	assert.Equal(t, "webhook-1", payload.WebhookID)
+	assert.NoError(t, localAdapter.Acknowledge(ctx, payload))
+
+	select {
+	case <-queue:
+		t.Fatal("acknowledged message redelivered")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestInFlightRecoveredOnConnect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sendhooks.db")
+	localAdapter := newTestAdapter(t, path)
+	ctx := context.Background()
+
+	_, err := localAdapter.Enqueue(ctx, adapter.WebhookPayload{URL: "http://example.com", WebhookID: "webhook-1"})
+	assert.NoError(t, err)
+
+	payloads, err := localAdapter.claim(1)
+	assert.NoError(t, err)
+	assert.Len(t, payloads, 1)
+	assert.NoError(t, localAdapter.db.Close())
+
+	// The webhook was in flight when the engine stopped, it's delivered again after the restart.
+	localAdapter = newTestAdapter(t, path)
+	defer localAdapter.db.Close()
+
+	payloads, err = localAdapter.claim(1)
+	assert.NoError(t, err)
+	assert.Len(t, payloads, 1)
+	assert.Equal(t, "webhook-1", payloads[0].WebhookID)
+}
+
+func TestScheduleRetry(t *testing.T) {
+	localAdapter := newTestAdapter(t, filepath.Join(t.TempDir(), "sendhooks.db"))
+	defer localAdapter.db.Close()
+	ctx := context.Background()
+
+	_, err := localAdapter.Enqueue(ctx, adapter.WebhookPayload{URL: "http://example.com", WebhookID: "webhook-1"})
+	assert.NoError(t, err)
+
+	payloads, err := localAdapter.claim(1)
+	assert.NoError(t, err)
+
+	payload := payloads[0]
+	payload.Attempts = []adapter.DeliveryAttempt{{Error: "failed"}}
+	assert.NoError(t, localAdapter.ScheduleRetry(ctx, payload, time.Now().Add(100*time.Millisecond)))
+
+	payloads, err = localAdapter.claim(1)
+	assert.NoError(t, err)
+	assert.Empty(t, payloads)
+
+	time.Sleep(150 * time.Millisecond)
+
+	payloads, err = localAdapter.claim(1)
+	assert.NoError(t, err)
+	assert.Len(t, payloads, 1)
+	assert.Equal(t, payload.MessageID, payloads[0].MessageID)
+	assert.Len(t, payloads[0].Attempts, 1)
+}
+
+func TestDeadLetters(t *testing.T) {
+	localAdapter := newTestAdapter(t, filepath.Join(t.TempDir(), "sendhooks.db"))
+	defer localAdapter.db.Close()
+	ctx := context.Background()
+
+	_, err := localAdapter.Enqueue(ctx, adapter.WebhookPayload{URL: "http://example.com", WebhookID: "webhook-1"})
+	assert.NoError(t, err)
+
+	payloads, err := localAdapter.claim(1)
+	assert.NoError(t, err)
+	payloads[0].Accepted = "2024-06-01T10:00:00Z"
+	payloads[0].RateLimitReserved = true
+	assert.NoError(t, localAdapter.DeadLetter(ctx, payloads[0], "failed"))
+
+	deadLetters, err := localAdapter.ListDeadLetters(ctx, adapter.DeadLetterFilter{WebhookID: "webhook-1"})
+	assert.NoError(t, err)
+	assert.Len(t, deadLetters, 1)
+	assert.Equal(t, "failed", deadLetters[0].LastError)
+
+	redriven, err := localAdapter.RedriveDeadLetters(ctx, adapter.DeadLetterFilter{ID: deadLetters[0].ID})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, redriven)
+
+	// The redriven webhook starts over as accepted now, without a rate limit token.
+	payloads, err = localAdapter.claim(1)
+	assert.NoError(t, err)
+	assert.Len(t, payloads, 1)
+	accepted, err := time.Parse(time.RFC3339, payloads[0].Accepted)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), accepted, time.Minute)
+	assert.False(t, payloads[0].RateLimitReserved)
+
+	deadLetters, err = localAdapter.ListDeadLetters(ctx, adapter.DeadLetterFilter{})
+	assert.NoError(t, err)
+	assert.Empty(t, deadLetters)
+}
+
+func TestCancelWebhook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sendhooks.db")
+	localAdapter := newTestAdapter(t, path)
+	ctx := context.Background()
+
+	_, err := localAdapter.CancelWebhook(ctx, "webhook-1")
+	assert.ErrorIs(t, err, adapter.ErrWebhookNotFound)
+
+	_, err = localAdapter.Enqueue(ctx, adapter.WebhookPayload{URL: "http://example.com", WebhookID: "webhook-1"})
+	assert.NoError(t, err)
+	url, err := localAdapter.CancelWebhook(ctx, "webhook-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com", url)
+
+	// The cancellation survives a restart.
+	assert.NoError(t, localAdapter.db.Close())
+	localAdapter = newTestAdapter(t, path)
+	defer localAdapter.db.Close()
+
+	cancelled, err := localAdapter.WebhookCancelled(ctx, "webhook-1")
+	assert.NoError(t, err)
+	assert.True(t, cancelled)
+
+	cancelled, err = localAdapter.WebhookCancelled(ctx, "webhook-2")
+	assert.NoError(t, err)
+	assert.False(t, cancelled)
+}
+
+func TestStatusHistory(t *testing.T) {
+	localAdapter := newTestAdapter(t, filepath.Join(t.TempDir(), "sendhooks.db"))
+	defer localAdapter.db.Close()
+	ctx := context.Background()
+
+	for _, status := range []string{"retrying", "retrying", "success"} {
+		assert.NoError(t, localAdapter.PublishStatus(ctx, "webhook-1", "http://example.com", "", "", status, "", 0, 1))
+	}
+
+	// Only the two most recent statuses are kept.
+	statuses, err := localAdapter.ListStatuses(ctx, "webhook-1")
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 2)
+	assert.Equal(t, "success", statuses[1].Status)
+}
@@ -0,0 +1,88 @@
+package natsadapter
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"sendhooks/adapter"
+	"sendhooks/logging"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// cancelStore keeps the pending and the cancelled webhooks in key-value buckets, whose entries
+// expire after the retention, so they are shared by all the instances.
+type cancelStore struct {
+	pending   jetstream.KeyValue
+	cancelled jetstream.KeyValue
+}
+
+// cancelKey encodes the webhook ID, which may hold characters not allowed in a key.
+func cancelKey(webhookID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(webhookID))
+}
+
+func (s *cancelStore) Track(ctx context.Context, webhookID, url string) error {
+	_, err := s.pending.Put(ctx, cancelKey(webhookID), []byte(url))
+	return err
+}
+
+func (s *cancelStore) Forget(ctx context.Context, webhookID string) error {
+	err := s.pending.Delete(ctx, cancelKey(webhookID))
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s *cancelStore) Cancel(ctx context.Context, webhookID string) (string, bool, error) {
+	entry, err := s.pending.Get(ctx, cancelKey(webhookID))
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	if _, err := s.cancelled.Put(ctx, cancelKey(webhookID), []byte{1}); err != nil {
+		return "", false, err
+	}
+	return string(entry.Value()), true, nil
+}
+
+func (s *cancelStore) Cancelled(ctx context.Context, webhookID string) (bool, error) {
+	_, err := s.cancelled.Get(ctx, cancelKey(webhookID))
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// CancelWebhook marks the webhook as cancelled when it was enqueued or scheduled for a retry and not
+// acknowledged since. The webhooks published straight to the subject can't be cancelled before
+// their first retry.
+func (n *NatsAdapter) CancelWebhook(ctx context.Context, webhookID string) (string, error) {
+	return n.cancels.Cancel(ctx, webhookID)
+}
+
+// WebhookCancelled tells if the webhook was cancelled.
+func (n *NatsAdapter) WebhookCancelled(ctx context.Context, webhookID string) (bool, error) {
+	return n.cancels.Cancelled(ctx, webhookID)
+}
+
+// track remembers a pending webhook so it can be cancelled. The webhook is sent anyway when it can't
+// be tracked.
+func (n *NatsAdapter) track(ctx context.Context, payload adapter.WebhookPayload) {
+	if err := n.cancels.Track(ctx, payload); err != nil {
+		logging.WebhookLogger(logging.WarningType, fmt.Errorf("error tracking webhook for cancellation: WebhookID : %s: %w", payload.WebhookID, err))
+	}
+}
+
+// forget forgets a webhook which reached a terminal outcome.
+func (n *NatsAdapter) forget(ctx context.Context, webhookID string) {
+	if err := n.cancels.Forget(ctx, webhookID); err != nil {
+		logging.WebhookLogger(logging.WarningType, fmt.Errorf("error forgetting webhook for cancellation: WebhookID : %s: %w", webhookID, err))
+	}
+}
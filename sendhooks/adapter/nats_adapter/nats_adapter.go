@@ -0,0 +1,460 @@
+package natsadapter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sendhooks/adapter"
+	"sendhooks/cancellation"
+	"sendhooks/logging"
+	"sendhooks/utils"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	defaultStream   = "SENDHOOKS"
+	defaultConsumer = "sendhooks"
+	ackWait         = 5 * time.Minute
+	fetchMaxWait    = time.Second
+)
+
+// inFlightMessage is a message handed to the workers and not acknowledged yet.
+type inFlightMessage struct {
+	msg         jetstream.Msg
+	redelivered bool
+}
+
+// NatsAdapter implements the Adapter interface for NATS JetStream. Retries are scheduled by the
+// server with a delayed negative acknowledgement, and the payload of a retried message is kept in a
+// key-value bucket, with its attempt history, its accepted time and its resolved delay, because a
+// redelivered message keeps its original body. The pending and cancelled webhooks are kept in
+// key-value buckets too.
+type NatsAdapter struct {
+	config            adapter.Configuration
+	streamName        string
+	subject           string
+	consumerName      string
+	statusSubject     string
+	deadLetterSubject string
+
+	connection *nats.Conn
+	jetStream  jetstream.JetStream
+	consumer   jetstream.Consumer
+	retries    jetstream.KeyValue
+	cancels    *cancellation.Registry
+
+	mu       sync.Mutex
+	inFlight map[string]inFlightMessage
+}
+
+// NewNatsAdapter creates a new NatsAdapter instance.
+func NewNatsAdapter(config adapter.Configuration) *NatsAdapter {
+	streamName := config.Nats.NatsStream
+	if streamName == "" {
+		streamName = defaultStream
+	}
+
+	consumerName := config.Nats.NatsConsumer
+	if consumerName == "" {
+		consumerName = defaultConsumer
+	}
+
+	deadLetterSubject := config.Nats.NatsDeadLetterSubject
+	if deadLetterSubject == "" {
+		deadLetterSubject = config.Nats.NatsSubject + ".dead-letter"
+	}
+
+	return &NatsAdapter{
+		config:            config,
+		streamName:        streamName,
+		subject:           config.Nats.NatsSubject,
+		consumerName:      consumerName,
+		statusSubject:     config.Nats.NatsStatusSubject,
+		deadLetterSubject: deadLetterSubject,
+		inFlight:          make(map[string]inFlightMessage),
+	}
+}
+
+// Connect connects to the server and creates the stream, the durable consumer and the buckets if
+// they don't exist.
+func (n *NatsAdapter) Connect() error {
+	if n.subject == "" {
+		return errors.New("natsSubject is required")
+	}
+
+	natsURL := n.config.Nats.NatsUrl
+	if natsURL == "" {
+		natsURL = nats.DefaultURL
+	}
+
+	options := []nats.Option{nats.Name("sendhooks"), nats.MaxReconnects(-1)}
+	if strings.ToLower(n.config.Nats.NatsSsl) == "true" {
+		tlsConfig, err := utils.CreateTLSConfig(n.config.Nats.NatsCaCert, n.config.Nats.NatsClientCert, n.config.Nats.NatsClientKey)
+		if err != nil {
+			return err
+		}
+		options = append(options, nats.Secure(tlsConfig))
+	}
+
+	connection, err := nats.Connect(natsURL, options...)
+	if err != nil {
+		return err
+	}
+
+	jetStream, err := jetstream.New(connection)
+	if err != nil {
+		connection.Close()
+		return err
+	}
+
+	ctx := context.Background()
+
+	_, err = jetStream.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     n.streamName,
+		Subjects: []string{n.subject, n.deadLetterSubject},
+	})
+	if err != nil {
+		connection.Close()
+		return fmt.Errorf("failed to create stream %s: %w", n.streamName, err)
+	}
+
+	consumer, err := jetStream.CreateOrUpdateConsumer(ctx, n.streamName, jetstream.ConsumerConfig{
+		Durable:       n.consumerName,
+		FilterSubject: n.subject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       ackWait,
+		MaxDeliver:    -1,
+	})
+	if err != nil {
+		connection.Close()
+		return fmt.Errorf("failed to create consumer %s: %w", n.consumerName, err)
+	}
+
+	retries, err := jetStream.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket: n.streamName + "_RETRIES",
+	})
+	if err != nil {
+		connection.Close()
+		return fmt.Errorf("failed to create retries bucket: %w", err)
+	}
+
+	pending, err := jetStream.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket: n.streamName + "_WEBHOOKS",
+		TTL:    adapter.CancelRetention,
+	})
+	if err != nil {
+		connection.Close()
+		return fmt.Errorf("failed to create webhooks bucket: %w", err)
+	}
+
+	cancelled, err := jetStream.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket: n.streamName + "_CANCELLED",
+		TTL:    adapter.CancelRetention,
+	})
+	if err != nil {
+		connection.Close()
+		return fmt.Errorf("failed to create cancelled bucket: %w", err)
+	}
+
+	n.connection = connection
+	n.jetStream = jetStream
+	n.consumer = consumer
+	n.retries = retries
+	n.cancels = cancellation.NewRegistryWithStore(&cancelStore{pending: pending, cancelled: cancelled})
+
+	return nil
+}
+
+// Close closes the connection to the server.
+func (n *NatsAdapter) Close() error {
+	n.connection.Close()
+	return nil
+}
+
+// SubscribeToQueue pulls the messages from the durable consumer and sends them to the workers.
+func (n *NatsAdapter) SubscribeToQueue(ctx context.Context, queue chan<- adapter.WebhookPayload) error {
+	batchSize := n.config.ChannelSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		batch, err := n.consumer.Fetch(batchSize, jetstream.FetchMaxWait(fetchMaxWait))
+		if err != nil {
+			logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error fetching messages: %w", err))
+			select {
+			case <-time.After(fetchMaxWait):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			continue
+		}
+
+		for msg := range batch.Messages() {
+			payload, ok := n.decodeMessage(ctx, msg)
+			if !ok {
+				continue
+			}
+
+			select {
+			case queue <- payload:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if err := batch.Error(); err != nil && !errors.Is(err, nats.ErrTimeout) {
+			logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error fetching messages: %w", err))
+		}
+	}
+}
+
+// decodeMessage converts a message into a payload. A redelivered message gets the payload saved
+// when its retry was scheduled. Messages that can't be decoded are terminated.
+func (n *NatsAdapter) decodeMessage(ctx context.Context, msg jetstream.Msg) (adapter.WebhookPayload, bool) {
+	var payload adapter.WebhookPayload
+
+	metadata, err := msg.Metadata()
+	if err != nil {
+		logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error reading message metadata: %w", err))
+		msg.Term()
+		return payload, false
+	}
+
+	if err := json.Unmarshal(msg.Data(), &payload); err != nil {
+		logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error unmarshalling message data: %w", err))
+		msg.Term()
+		return payload, false
+	}
+
+	payload.MessageID = strconv.FormatUint(metadata.Sequence.Stream, 10)
+	redelivered := metadata.NumDelivered > 1
+
+	if redelivered {
+		entry, err := n.retries.Get(ctx, payload.MessageID)
+		if err == nil {
+			var retry adapter.WebhookPayload
+			if err := json.Unmarshal(entry.Value(), &retry); err != nil {
+				logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error unmarshalling retry of message %s: %w", payload.MessageID, err))
+			} else {
+				retry.MessageID = payload.MessageID
+				payload = retry
+			}
+		} else if !errors.Is(err, jetstream.ErrKeyNotFound) {
+			logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error reading retry of message %s: %w", payload.MessageID, err))
+		}
+	}
+
+	n.mu.Lock()
+	n.inFlight[payload.MessageID] = inFlightMessage{msg: msg, redelivered: redelivered}
+	n.mu.Unlock()
+
+	return payload, true
+}
+
+// PublishStatus publishes the status of a webhook delivery to the status subject.
+func (n *NatsAdapter) PublishStatus(ctx context.Context, webhookID, url, created, delivered, status, deliveryError string, payloadSize int, numberOfTries int) error {
+	if n.statusSubject == "" {
+		return nil
+	}
+
+	message := adapter.WebhookDeliveryStatus{
+		WebhookID:     webhookID,
+		Status:        status,
+		DeliveryError: deliveryError,
+		URL:           url,
+		Created:       created,
+		Delivered:     delivered,
+		PayloadSize:   payloadSize,
+		NumberOfTries: numberOfTries,
+	}
+
+	jsonString, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return n.connection.Publish(n.statusSubject, jsonString)
+}
+
+// WatchStatuses subscribes to the status subject.
+func (n *NatsAdapter) WatchStatuses(ctx context.Context, statuses chan<- adapter.WebhookDeliveryStatus) error {
+	if n.statusSubject == "" {
+		return errors.New("natsStatusSubject is required to watch statuses")
+	}
+
+	messages := make(chan *nats.Msg, 64)
+	subscription, err := n.connection.ChanSubscribe(n.statusSubject, messages)
+	if err != nil {
+		return err
+	}
+	defer subscription.Unsubscribe()
+
+	for {
+		select {
+		case msg := <-messages:
+			var status adapter.WebhookDeliveryStatus
+			if err := json.Unmarshal(msg.Data, &status); err != nil {
+				logging.WebhookLogger(logging.WarningType, fmt.Errorf("error unmarshalling status: %w", err))
+				continue
+			}
+
+			select {
+			case statuses <- status:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Enqueue publishes the payload to the stream and returns the number of messages waiting in the
+// consumer, which includes the new one. The delay of the webhook counts from now.
+func (n *NatsAdapter) Enqueue(ctx context.Context, payload adapter.WebhookPayload) (int64, error) {
+	payload.MessageID = ""
+	payload.ResolveDelay(time.Now())
+	n.track(ctx, payload)
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := n.jetStream.Publish(ctx, n.subject, data); err != nil {
+		return 0, err
+	}
+
+	info, err := n.consumer.Info(ctx)
+	if err != nil {
+		logging.WebhookLogger(logging.WarningType, fmt.Errorf("error reading consumer info: %w", err))
+		return -1, nil
+	}
+
+	return int64(info.NumPending) + int64(info.NumAckPending), nil
+}
+
+// takeInFlight removes the message from the in-flight messages.
+func (n *NatsAdapter) takeInFlight(messageID string) (inFlightMessage, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	message, ok := n.inFlight[messageID]
+	if !ok {
+		return message, fmt.Errorf("unknown message %s", messageID)
+	}
+	delete(n.inFlight, messageID)
+
+	return message, nil
+}
+
+// ExtendLease resets the acknowledgement timer of the message, so the server doesn't redeliver it.
+func (n *NatsAdapter) ExtendLease(ctx context.Context, payload adapter.WebhookPayload) error {
+	n.mu.Lock()
+	message, ok := n.inFlight[payload.MessageID]
+	n.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("unknown message %s", payload.MessageID)
+	}
+
+	return message.msg.InProgress()
+}
+
+// forgetRetry deletes the saved payload of a message that won't be delivered again.
+func (n *NatsAdapter) forgetRetry(ctx context.Context, messageID string, message inFlightMessage) {
+	if !message.redelivered {
+		return
+	}
+
+	if err := n.retries.Delete(ctx, messageID); err != nil && !errors.Is(err, jetstream.ErrKeyNotFound) {
+		logging.WebhookLogger(logging.WarningType, fmt.Errorf("error deleting retry of message %s: %w", messageID, err))
+	}
+}
+
+// Acknowledge acknowledges the message.
+func (n *NatsAdapter) Acknowledge(ctx context.Context, payload adapter.WebhookPayload) error {
+	message, err := n.takeInFlight(payload.MessageID)
+	if err != nil {
+		return err
+	}
+
+	if err := message.msg.Ack(); err != nil {
+		return err
+	}
+
+	n.forgetRetry(ctx, payload.MessageID, message)
+	n.forget(ctx, payload.WebhookID)
+	return nil
+}
+
+// ScheduleRetry saves the payload and asks the server to redeliver the message at retryAt.
+func (n *NatsAdapter) ScheduleRetry(ctx context.Context, payload adapter.WebhookPayload, retryAt time.Time) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	if _, err := n.retries.Put(ctx, payload.MessageID, data); err != nil {
+		return err
+	}
+	n.track(ctx, payload)
+
+	message, err := n.takeInFlight(payload.MessageID)
+	if err != nil {
+		return err
+	}
+
+	delay := time.Until(retryAt)
+	if delay < 0 {
+		delay = 0
+	}
+
+	return message.msg.NakWithDelay(delay)
+}
+
+// DeadLetter publishes the payload to the dead-letter subject and terminates the message, so that
+// it's never redelivered.
+func (n *NatsAdapter) DeadLetter(ctx context.Context, payload adapter.WebhookPayload, lastError string) error {
+	messageID := payload.MessageID
+	payload.MessageID = ""
+
+	data, err := json.Marshal(adapter.DeadLetter{
+		Payload:   payload,
+		LastError: lastError,
+		Failed:    time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := n.jetStream.Publish(ctx, n.deadLetterSubject, data); err != nil {
+		return err
+	}
+
+	message, err := n.takeInFlight(messageID)
+	if err != nil {
+		return err
+	}
+
+	if err := message.msg.Term(); err != nil {
+		return err
+	}
+
+	n.forgetRetry(ctx, messageID, message)
+	n.forget(ctx, payload.WebhookID)
+	return nil
+}
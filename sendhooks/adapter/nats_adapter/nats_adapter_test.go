@@ -0,0 +1,235 @@
+package natsadapter
+
+/*
+These tests run the JetStream adapter against an embedded NATS server, to check that retries are redelivered by
+the server with their attempt history and their accepted time, and that dead letters are never redelivered.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"sendhooks/adapter"
+	"sendhooks/logging"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+func runTestServer(t *testing.T) *server.Server {
+	natsServer, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	})
+	assert.NoError(t, err)
+
+	go natsServer.Start()
+	if !natsServer.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready")
+	}
+	t.Cleanup(natsServer.Shutdown)
+
+	return natsServer
+}
+
+func newTestAdapter(t *testing.T, natsServer *server.Server) *NatsAdapter {
+	logging.WebhookLogger = func(errorType string, message interface{}) error {
+		return nil
+	}
+
+	natsAdapter := NewNatsAdapter(adapter.Configuration{
+		Nats: adapter.NatsConfig{
+			NatsUrl:           natsServer.ClientURL(),
+			NatsSubject:       "hooks",
+			NatsStatusSubject: "hooks-status",
+		},
+		ChannelSize: 1,
+	})
+	assert.NoError(t, natsAdapter.Connect())
+	t.Cleanup(natsAdapter.connection.Close)
+
+	return natsAdapter
+}
+
+func publishTestMessage(t *testing.T, natsAdapter *NatsAdapter, webhookID string) {
+	data, err := json.Marshal(adapter.WebhookPayload{URL: "http://example.com", WebhookID: webhookID})
+	assert.NoError(t, err)
+
+	_, err = natsAdapter.jetStream.Publish(context.Background(), "hooks", data)
+	assert.NoError(t, err)
+}
+
+func receive(t *testing.T, queue chan adapter.WebhookPayload) adapter.WebhookPayload {
+	select {
+	case payload := <-queue:
+		return payload
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+		return adapter.WebhookPayload{}
+	}
+}
+
+func TestScheduleRetryAndAcknowledge(t *testing.T) {
+	natsAdapter := newTestAdapter(t, runTestServer(t))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	publishTestMessage(t, natsAdapter, "webhook-1")
+
+	queue := make(chan adapter.WebhookPayload, 1)
+	go natsAdapter.SubscribeToQueue(ctx, queue)
+
+	payload := receive(t, queue)
+	assert.Equal(t, "webhook-1", payload.WebhookID)
+	assert.Empty(t, payload.Attempts)
+
+	payload.Attempts = []adapter.DeliveryAttempt{{Error: "failed"}}
+	payload.Accepted = "2024-06-01T10:00:00Z"
+	assert.NoError(t, natsAdapter.ScheduleRetry(ctx, payload, time.Now().Add(100*time.Millisecond)))
+
+	// The server redelivers the message once the delay expired, with its attempt history and the
+	// time it was accepted, so a maximum age counts from the first read.
+	retried := receive(t, queue)
+	assert.Equal(t, payload.MessageID, retried.MessageID)
+	assert.Len(t, retried.Attempts, 1)
+	assert.Equal(t, "2024-06-01T10:00:00Z", retried.Accepted)
+
+	assert.NoError(t, natsAdapter.Acknowledge(ctx, retried))
+
+	_, err := natsAdapter.retries.Get(ctx, retried.MessageID)
+	assert.Error(t, err)
+
+	select {
+	case <-queue:
+		t.Fatal("acknowledged message redelivered")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	natsAdapter := newTestAdapter(t, runTestServer(t))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	deadLetters := make(chan *nats.Msg, 1)
+	subscription, err := natsAdapter.connection.ChanSubscribe("hooks.dead-letter", deadLetters)
+	assert.NoError(t, err)
+	defer subscription.Unsubscribe()
+
+	publishTestMessage(t, natsAdapter, "webhook-1")
+
+	queue := make(chan adapter.WebhookPayload, 1)
+	go natsAdapter.SubscribeToQueue(ctx, queue)
+
+	assert.NoError(t, natsAdapter.DeadLetter(ctx, receive(t, queue), "failed"))
+
+	select {
+	case msg := <-deadLetters:
+		var deadLetter adapter.DeadLetter
+		assert.NoError(t, json.Unmarshal(msg.Data, &deadLetter))
+		assert.Equal(t, "webhook-1", deadLetter.Payload.WebhookID)
+		assert.Equal(t, "failed", deadLetter.LastError)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no dead letter published")
+	}
+}
+
+func TestPublishStatus(t *testing.T) {
+	natsAdapter := newTestAdapter(t, runTestServer(t))
+
+	statuses := make(chan *nats.Msg, 1)
+	subscription, err := natsAdapter.connection.ChanSubscribe("hooks-status", statuses)
+	assert.NoError(t, err)
+	defer subscription.Unsubscribe()
+
+	assert.NoError(t, natsAdapter.PublishStatus(context.Background(), "webhook-1", "http://example.com", "", "", "success", "", 0, 1))
+
+	select {
+	case msg := <-statuses:
+		var status adapter.WebhookDeliveryStatus
+		assert.NoError(t, json.Unmarshal(msg.Data, &status))
+		assert.Equal(t, "success", status.Status)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no status published")
+	}
+}
+
+func TestDelayedWebhook(t *testing.T) {
+	natsAdapter := newTestAdapter(t, runTestServer(t))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := natsAdapter.Enqueue(ctx, adapter.WebhookPayload{URL: "http://example.com", WebhookID: "webhook-1", DelaySeconds: 60})
+	assert.NoError(t, err)
+
+	queue := make(chan adapter.WebhookPayload, 1)
+	go natsAdapter.SubscribeToQueue(ctx, queue)
+
+	// The delay is resolved when the webhook is enqueued.
+	payload := receive(t, queue)
+	assert.Zero(t, payload.DelaySeconds)
+	deliverAt, later := payload.DeliverLater(time.Now())
+	assert.True(t, later)
+
+	// The webhook postponed until it's due comes back with the same DeliverAt time, instead of
+	// being delayed again.
+	assert.NoError(t, natsAdapter.ScheduleRetry(ctx, payload, time.Now().Add(100*time.Millisecond)))
+
+	retried := receive(t, queue)
+	assert.Zero(t, retried.DelaySeconds)
+	retriedAt, _ := retried.DeliverLater(time.Now())
+	assert.Equal(t, deliverAt, retriedAt)
+}
+
+func TestCancelWebhook(t *testing.T) {
+	natsAdapter := newTestAdapter(t, runTestServer(t))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := natsAdapter.CancelWebhook(ctx, "webhook/1")
+	assert.ErrorIs(t, err, adapter.ErrWebhookNotFound)
+
+	_, err = natsAdapter.Enqueue(ctx, adapter.WebhookPayload{URL: "http://example.com", WebhookID: "webhook/1"})
+	assert.NoError(t, err)
+	url, err := natsAdapter.CancelWebhook(ctx, "webhook/1")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com", url)
+
+	cancelled, err := natsAdapter.WebhookCancelled(ctx, "webhook/1")
+	assert.NoError(t, err)
+	assert.True(t, cancelled)
+	cancelled, err = natsAdapter.WebhookCancelled(ctx, "webhook-2")
+	assert.NoError(t, err)
+	assert.False(t, cancelled)
+
+	// A webhook can't be cancelled once acknowledged.
+	queue := make(chan adapter.WebhookPayload, 1)
+	go natsAdapter.SubscribeToQueue(ctx, queue)
+
+	assert.NoError(t, natsAdapter.Acknowledge(ctx, receive(t, queue)))
+	_, err = natsAdapter.CancelWebhook(ctx, "webhook/1")
+	assert.ErrorIs(t, err, adapter.ErrWebhookNotFound)
+}
+
+func TestExtendLease(t *testing.T) {
+	natsAdapter := newTestAdapter(t, runTestServer(t))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	publishTestMessage(t, natsAdapter, "webhook-1")
+
+	queue := make(chan adapter.WebhookPayload, 1)
+	go natsAdapter.SubscribeToQueue(ctx, queue)
+
+	payload := receive(t, queue)
+	assert.NoError(t, natsAdapter.ExtendLease(ctx, payload))
+	assert.NoError(t, natsAdapter.Acknowledge(ctx, payload))
+
+	// An acknowledged message has no lease anymore.
+	assert.Error(t, natsAdapter.ExtendLease(ctx, payload))
+}
@@ -0,0 +1,42 @@
+package postgresadapter
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"sendhooks/adapter"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CancelWebhook marks the webhook as cancelled when it's pending or in flight in the outbox, and
+// forgets the cancellations older than the retention.
+func (p *PostgresAdapter) CancelWebhook(ctx context.Context, webhookID string) (string, error) {
+	var url string
+	err := p.pool.QueryRow(ctx, `
+SELECT payload->>'url' FROM sendhooks_outbox
+WHERE payload->>'webhookId' = $1 AND state IN ('pending', 'in_flight')
+LIMIT 1`, webhookID).Scan(&url)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", adapter.ErrWebhookNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	_, err = p.pool.Exec(ctx, `DELETE FROM sendhooks_cancelled WHERE cancelled_at < $1`, time.Now().Add(-adapter.CancelRetention))
+	if err != nil {
+		return "", err
+	}
+
+	_, err = p.pool.Exec(ctx, `INSERT INTO sendhooks_cancelled (webhook_id) VALUES ($1) ON CONFLICT (webhook_id) DO NOTHING`, webhookID)
+	return url, err
+}
+
+// WebhookCancelled tells if the webhook was cancelled.
+func (p *PostgresAdapter) WebhookCancelled(ctx context.Context, webhookID string) (bool, error) {
+	var cancelled bool
+	err := p.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM sendhooks_cancelled WHERE webhook_id = $1)`, webhookID).Scan(&cancelled)
+	return cancelled, err
+}
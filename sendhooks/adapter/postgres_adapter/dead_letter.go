@@ -0,0 +1,137 @@
+package postgresadapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"sendhooks/adapter"
+)
+
+// deadLetterCondition builds the WHERE clause selecting the failed rows matching the filter.
+func deadLetterCondition(filter adapter.DeadLetterFilter) (string, []interface{}, error) {
+	conditions := []string{"state = 'failed'"}
+	var args []interface{}
+
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.ID != "" {
+		id, err := strconv.ParseInt(filter.ID, 10, 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid dead letter id %q", filter.ID)
+		}
+		addCondition("id = $%d", id)
+	}
+	if filter.URL != "" {
+		addCondition("payload->>'url' = $%d", filter.URL)
+	}
+	if filter.WebhookID != "" {
+		addCondition("payload->>'webhookId' = $%d", filter.WebhookID)
+	}
+	if !filter.From.IsZero() {
+		addCondition("updated_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("updated_at <= $%d", filter.To)
+	}
+
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+// ListDeadLetters returns the failed rows selected by the filter, oldest first.
+func (p *PostgresAdapter) ListDeadLetters(ctx context.Context, filter adapter.DeadLetterFilter) ([]adapter.DeadLetter, error) {
+	condition, args, err := deadLetterCondition(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := p.pool.Query(ctx, `
+SELECT id, payload, attempts, coalesce(last_error, ''), updated_at
+FROM sendhooks_outbox
+WHERE `+condition+`
+ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deadLetters []adapter.DeadLetter
+	for rows.Next() {
+		var id int64
+		var data, attempts []byte
+		var failed time.Time
+		var deadLetter adapter.DeadLetter
+
+		if err := rows.Scan(&id, &data, &attempts, &deadLetter.LastError, &failed); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(data, &deadLetter.Payload); err != nil {
+			return nil, fmt.Errorf("error unmarshalling outbox row %d: %w", id, err)
+		}
+		if err := json.Unmarshal(attempts, &deadLetter.Payload.Attempts); err != nil {
+			return nil, fmt.Errorf("error unmarshalling attempts of outbox row %d: %w", id, err)
+		}
+
+		deadLetter.ID = strconv.FormatInt(id, 10)
+		deadLetter.Failed = failed.UTC().Format(time.RFC3339)
+		deadLetters = append(deadLetters, deadLetter)
+	}
+
+	return deadLetters, rows.Err()
+}
+
+// GetDeadLetter returns a single failed row.
+func (p *PostgresAdapter) GetDeadLetter(ctx context.Context, id string) (adapter.DeadLetter, error) {
+	deadLetters, err := p.ListDeadLetters(ctx, adapter.DeadLetterFilter{ID: id})
+	if err != nil {
+		return adapter.DeadLetter{}, err
+	}
+
+	if len(deadLetters) == 0 {
+		return adapter.DeadLetter{}, fmt.Errorf("dead letter %s not found", id)
+	}
+
+	return deadLetters[0], nil
+}
+
+// RedriveDeadLetters puts the selected failed rows back in the pending state. They start over as
+// accepted now, so the max age of their retry policy counts from the redrive.
+func (p *PostgresAdapter) RedriveDeadLetters(ctx context.Context, filter adapter.DeadLetterFilter) (int, error) {
+	condition, args, err := deadLetterCondition(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	tag, err := p.pool.Exec(ctx, `
+UPDATE sendhooks_outbox
+SET state = 'pending', attempts = '[]', last_error = NULL, next_attempt_at = now(), updated_at = now(),
+	payload = (payload - 'rateLimitReserved') || jsonb_build_object('accepted', to_char(now() AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"'))
+WHERE `+condition, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// PurgeDeadLetters deletes the selected failed rows.
+func (p *PostgresAdapter) PurgeDeadLetters(ctx context.Context, filter adapter.DeadLetterFilter) (int, error) {
+	condition, args, err := deadLetterCondition(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	tag, err := p.pool.Exec(ctx, `DELETE FROM sendhooks_outbox WHERE `+condition, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
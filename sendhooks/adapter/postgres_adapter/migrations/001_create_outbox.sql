@@ -0,0 +1,41 @@
+-- The outbox holds the webhooks to deliver. Producers insert rows in the same transaction as
+-- their business writes:
+--
+--   INSERT INTO sendhooks_outbox (payload) VALUES ('{"url": "...", "webhookId": "...", "data": {...}}');
+--
+-- state is one of pending, in_flight, delivered or failed.
+CREATE TABLE IF NOT EXISTS sendhooks_outbox (
+    id              BIGSERIAL PRIMARY KEY,
+    payload         JSONB       NOT NULL,
+    state           TEXT        NOT NULL DEFAULT 'pending',
+    attempts        JSONB       NOT NULL DEFAULT '[]',
+    last_error      TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    locked_until    TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS sendhooks_outbox_pending_idx
+    ON sendhooks_outbox (next_attempt_at)
+    WHERE state = 'pending';
+
+CREATE INDEX IF NOT EXISTS sendhooks_outbox_in_flight_idx
+    ON sendhooks_outbox (locked_until)
+    WHERE state = 'in_flight';
+
+CREATE TABLE IF NOT EXISTS sendhooks_delivery_status (
+    id              BIGSERIAL PRIMARY KEY,
+    webhook_id      TEXT        NOT NULL,
+    status          TEXT        NOT NULL,
+    delivery_error  TEXT        NOT NULL DEFAULT '',
+    url             TEXT        NOT NULL,
+    created         TEXT        NOT NULL DEFAULT '',
+    delivered       TEXT        NOT NULL DEFAULT '',
+    payload_size    INTEGER     NOT NULL DEFAULT 0,
+    number_of_tries INTEGER     NOT NULL DEFAULT 0,
+    recorded_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS sendhooks_delivery_status_webhook_id_idx
+    ON sendhooks_delivery_status (webhook_id);
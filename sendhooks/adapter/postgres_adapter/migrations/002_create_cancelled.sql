@@ -0,0 +1,6 @@
+-- The webhooks cancelled through the API or the CLI. The workers acknowledge them without sending
+-- them. The rows older than the cancel retention are deleted on the next cancellation.
+CREATE TABLE IF NOT EXISTS sendhooks_cancelled (
+    webhook_id   TEXT PRIMARY KEY,
+    cancelled_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,389 @@
+package postgresadapter
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"sendhooks/adapter"
+	"sendhooks/logging"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+const (
+	defaultPollInterval = time.Second
+	// lease is how long a row stays in flight before another instance can claim it again.
+	lease = 5 * time.Minute
+)
+
+// claimQuery marks the next due rows as in flight and returns them. Rows left in flight by a dead
+// instance are claimed again once their lease expired. SKIP LOCKED lets several instances poll
+// the outbox at the same time without claiming the same rows.
+const claimQuery = `
+UPDATE sendhooks_outbox
+SET state = 'in_flight', locked_until = now() + make_interval(secs => $2), updated_at = now()
+WHERE id IN (
+	SELECT id FROM sendhooks_outbox
+	WHERE (state = 'pending' AND next_attempt_at <= now())
+	   OR (state = 'in_flight' AND locked_until < now())
+	ORDER BY id
+	LIMIT $1
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING id, payload, attempts`
+
+// PostgresAdapter implements the Adapter interface on top of a transactional outbox table.
+type PostgresAdapter struct {
+	config       adapter.Configuration
+	pool         *pgxpool.Pool
+	pollInterval time.Duration
+}
+
+// NewPostgresAdapter creates a new PostgresAdapter instance.
+func NewPostgresAdapter(config adapter.Configuration) *PostgresAdapter {
+	pollInterval := defaultPollInterval
+	if config.Postgres.PostgresPollInterval > 0 {
+		pollInterval = time.Duration(config.Postgres.PostgresPollInterval) * time.Second
+	}
+
+	return &PostgresAdapter{
+		config:       config,
+		pollInterval: pollInterval,
+	}
+}
+
+// Connect opens the connection pool and runs the migrations if they are enabled.
+func (p *PostgresAdapter) Connect() error {
+	postgresURL := p.config.Postgres.PostgresUrl
+	if postgresURL == "" {
+		postgresURL = "postgres://localhost:5432/sendhooks" // Default database
+	}
+
+	ctx := context.Background()
+
+	poolConfig, err := pgxpool.ParseConfig(postgresURL)
+	if err != nil {
+		return err
+	}
+	if p.config.NumWorkers > 0 {
+		poolConfig.MaxConns = int32(p.config.NumWorkers) + 1
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return err
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return err
+	}
+
+	p.pool = pool
+
+	if strings.ToLower(p.config.Postgres.PostgresMigrate) == "true" {
+		return p.migrate(ctx)
+	}
+
+	return nil
+}
+
+// Close closes the connection pool.
+func (p *PostgresAdapter) Close() error {
+	p.pool.Close()
+	return nil
+}
+
+// migrate runs the embedded migrations in order. They are idempotent.
+func (p *PostgresAdapter) migrate(ctx context.Context) error {
+	entries, err := migrations.ReadDir("migrations")
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		migration, err := migrations.ReadFile("migrations/" + name)
+		if err != nil {
+			return err
+		}
+
+		if _, err := p.pool.Exec(ctx, string(migration)); err != nil {
+			return fmt.Errorf("failed to run migration %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// SubscribeToQueue polls the outbox and sends the claimed rows to the workers.
+func (p *PostgresAdapter) SubscribeToQueue(ctx context.Context, queue chan<- adapter.WebhookPayload) error {
+	batchSize := p.config.ChannelSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	for {
+		payloads, err := p.claim(ctx, batchSize)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error polling the outbox: %w", err))
+		}
+
+		for _, payload := range payloads {
+			select {
+			case queue <- payload:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if len(payloads) < batchSize {
+			select {
+			case <-time.After(p.pollInterval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// claim marks up to limit due rows as in flight and returns their payloads.
+func (p *PostgresAdapter) claim(ctx context.Context, limit int) ([]adapter.WebhookPayload, error) {
+	rows, err := p.pool.Query(ctx, claimQuery, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payloads []adapter.WebhookPayload
+	for rows.Next() {
+		var id int64
+		var data, attempts []byte
+
+		if err := rows.Scan(&id, &data, &attempts); err != nil {
+			return nil, err
+		}
+
+		var payload adapter.WebhookPayload
+		if err := json.Unmarshal(data, &payload); err != nil {
+			logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error unmarshalling outbox row %d: %w", id, err))
+			p.markFailed(ctx, id, err.Error())
+			continue
+		}
+
+		if err := json.Unmarshal(attempts, &payload.Attempts); err != nil {
+			logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error unmarshalling attempts of outbox row %d: %w", id, err))
+		}
+
+		payload.MessageID = strconv.FormatInt(id, 10)
+		payloads = append(payloads, payload)
+	}
+
+	return payloads, rows.Err()
+}
+
+// markFailed marks a row that can't be delivered as failed.
+func (p *PostgresAdapter) markFailed(ctx context.Context, id int64, lastError string) {
+	_, err := p.pool.Exec(ctx, `UPDATE sendhooks_outbox SET state = 'failed', last_error = $2, locked_until = NULL, updated_at = now() WHERE id = $1`, id, lastError)
+	if err != nil {
+		logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error marking outbox row %d as failed: %w", id, err))
+	}
+}
+
+// PublishStatus writes the status of a webhook delivery to the status table.
+func (p *PostgresAdapter) PublishStatus(ctx context.Context, webhookID, url, created, delivered, status, deliveryError string, payloadSize int, numberOfTries int) error {
+	_, err := p.pool.Exec(ctx, `
+INSERT INTO sendhooks_delivery_status (webhook_id, status, delivery_error, url, created, delivered, payload_size, number_of_tries)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		webhookID, status, deliveryError, url, created, delivered, payloadSize, numberOfTries)
+
+	return err
+}
+
+// WatchStatuses polls the status table for the statuses written from now on.
+func (p *PostgresAdapter) WatchStatuses(ctx context.Context, statuses chan<- adapter.WebhookDeliveryStatus) error {
+	var lastID int64
+	if err := p.pool.QueryRow(ctx, `SELECT coalesce(max(id), 0) FROM sendhooks_delivery_status`).Scan(&lastID); err != nil {
+		return err
+	}
+
+	for {
+		batch, err := p.statusesAfter(ctx, lastID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		for _, row := range batch {
+			lastID = row.id
+			select {
+			case statuses <- row.status:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if len(batch) == 0 {
+			select {
+			case <-time.After(p.pollInterval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// statusRow is a row of the status table.
+type statusRow struct {
+	id     int64
+	status adapter.WebhookDeliveryStatus
+}
+
+// statusesAfter returns the statuses written after the given row.
+func (p *PostgresAdapter) statusesAfter(ctx context.Context, lastID int64) ([]statusRow, error) {
+	rows, err := p.pool.Query(ctx, `
+SELECT id, webhook_id, status, delivery_error, url, created, delivered, payload_size, number_of_tries
+FROM sendhooks_delivery_status
+WHERE id > $1
+ORDER BY id
+LIMIT 100`, lastID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []statusRow
+	for rows.Next() {
+		var row statusRow
+		status := &row.status
+		err := rows.Scan(&row.id, &status.WebhookID, &status.Status, &status.DeliveryError, &status.URL, &status.Created, &status.Delivered, &status.PayloadSize, &status.NumberOfTries)
+		if err != nil {
+			return nil, err
+		}
+		batch = append(batch, row)
+	}
+
+	return batch, rows.Err()
+}
+
+// Enqueue inserts the payload in the outbox and returns the number of pending rows up to the new one.
+// A webhook delivered later is inserted with its DeliverAt time as the next attempt time.
+func (p *PostgresAdapter) Enqueue(ctx context.Context, payload adapter.WebhookPayload) (int64, error) {
+	payload.MessageID = ""
+	payload.ResolveDelay(time.Now())
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	// A webhook delivered later isn't claimed until it's due, its position is -1.
+	if deliverAt, later := payload.DeliverLater(time.Now()); later {
+		_, err := p.pool.Exec(ctx, `INSERT INTO sendhooks_outbox (payload, next_attempt_at) VALUES ($1, $2)`, data, deliverAt)
+		return -1, err
+	}
+
+	var position int64
+	err = p.pool.QueryRow(ctx, `
+WITH inserted AS (
+	INSERT INTO sendhooks_outbox (payload) VALUES ($1) RETURNING id
+)
+SELECT 1 + (SELECT count(*) FROM sendhooks_outbox WHERE state = 'pending' AND next_attempt_at <= now()) FROM inserted`,
+		data).Scan(&position)
+
+	return position, err
+}
+
+// Acknowledge marks the row as delivered.
+func (p *PostgresAdapter) Acknowledge(ctx context.Context, payload adapter.WebhookPayload) error {
+	return p.exec(ctx, `UPDATE sendhooks_outbox SET state = 'delivered', locked_until = NULL, updated_at = now() WHERE id = $1`, payload.MessageID)
+}
+
+// ExtendLease keeps the row in flight for another lease.
+func (p *PostgresAdapter) ExtendLease(ctx context.Context, payload adapter.WebhookPayload) error {
+	return p.exec(ctx, `
+UPDATE sendhooks_outbox
+SET locked_until = now() + make_interval(secs => $2), updated_at = now()
+WHERE id = $1 AND state = 'in_flight'`, payload.MessageID, lease.Seconds())
+}
+
+// ScheduleRetry puts the row back in the pending state until retryAt. The payload is saved as the
+// workers left it, so the next claim gets its accepted time and the DeliverAt time resolved from
+// its delay, instead of delaying it again.
+func (p *PostgresAdapter) ScheduleRetry(ctx context.Context, payload adapter.WebhookPayload, retryAt time.Time) error {
+	attempts, err := json.Marshal(payload.Attempts)
+	if err != nil {
+		return err
+	}
+
+	lastError := ""
+	if len(payload.Attempts) > 0 {
+		lastError = payload.Attempts[len(payload.Attempts)-1].Error
+	}
+
+	// The attempts have their own column.
+	messageID := payload.MessageID
+	payload.MessageID = ""
+	payload.Attempts = nil
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return p.exec(ctx, `
+UPDATE sendhooks_outbox
+SET state = 'pending', payload = $2, attempts = $3, last_error = $4, next_attempt_at = $5, locked_until = NULL, updated_at = now()
+WHERE id = $1`, messageID, data, attempts, lastError, retryAt)
+}
+
+// DeadLetter marks the row as failed. Failed rows stay in the outbox until they are redriven or purged.
+func (p *PostgresAdapter) DeadLetter(ctx context.Context, payload adapter.WebhookPayload, lastError string) error {
+	attempts, err := json.Marshal(payload.Attempts)
+	if err != nil {
+		return err
+	}
+
+	return p.exec(ctx, `
+UPDATE sendhooks_outbox
+SET state = 'failed', attempts = $2, last_error = $3, locked_until = NULL, updated_at = now()
+WHERE id = $1`, payload.MessageID, attempts, lastError)
+}
+
+// exec runs a statement updating a single outbox row.
+func (p *PostgresAdapter) exec(ctx context.Context, query string, messageID string, args ...interface{}) error {
+	id, err := strconv.ParseInt(messageID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid outbox row id %q", messageID)
+	}
+
+	tag, err := p.pool.Exec(ctx, query, append([]interface{}{id}, args...)...)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
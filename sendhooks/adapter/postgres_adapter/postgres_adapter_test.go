@@ -0,0 +1,216 @@
+//go:build integration
+
+package postgresadapter
+
+/*
+These tests run the Postgres adapter against a real database, as the claims rely on row locks. They are built with
+the integration tag and need the URL of a disposable database, whose sendhooks tables are emptied:
+
+	SENDHOOKS_POSTGRES_URL=postgres://localhost:5432/sendhooks_test go test -tags integration ./adapter/postgres_adapter/
+*/
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"sendhooks/adapter"
+	"sendhooks/logging"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAdapter(t *testing.T) *PostgresAdapter {
+	postgresURL := os.Getenv("SENDHOOKS_POSTGRES_URL")
+	if postgresURL == "" {
+		t.Skip("SENDHOOKS_POSTGRES_URL is not set")
+	}
+
+	logging.WebhookLogger = func(errorType string, message interface{}) error {
+		return nil
+	}
+
+	postgresAdapter := NewPostgresAdapter(adapter.Configuration{
+		Postgres: adapter.PostgresConfig{PostgresUrl: postgresURL, PostgresMigrate: "true"},
+	})
+	assert.NoError(t, postgresAdapter.Connect())
+	t.Cleanup(func() { postgresAdapter.Close() })
+
+	_, err := postgresAdapter.pool.Exec(context.Background(), `TRUNCATE sendhooks_outbox, sendhooks_delivery_status, sendhooks_cancelled RESTART IDENTITY`)
+	assert.NoError(t, err)
+
+	return postgresAdapter
+}
+
+func enqueue(t *testing.T, postgresAdapter *PostgresAdapter, webhookID string) {
+	_, err := postgresAdapter.Enqueue(context.Background(), adapter.WebhookPayload{URL: "http://example.com", WebhookID: webhookID})
+	assert.NoError(t, err)
+}
+
+func claimedIDs(t *testing.T, postgresAdapter *PostgresAdapter, limit int) []string {
+	payloads, err := postgresAdapter.claim(context.Background(), limit)
+	assert.NoError(t, err)
+
+	var webhookIDs []string
+	for _, payload := range payloads {
+		webhookIDs = append(webhookIDs, payload.WebhookID)
+	}
+	return webhookIDs
+}
+
+func TestClaimSkipsLockedRows(t *testing.T) {
+	postgresAdapter := newTestAdapter(t)
+	ctx := context.Background()
+
+	enqueue(t, postgresAdapter, "webhook-1")
+	enqueue(t, postgresAdapter, "webhook-2")
+
+	// Another instance is claiming the first row.
+	tx, err := postgresAdapter.pool.Begin(ctx)
+	assert.NoError(t, err)
+	defer tx.Rollback(ctx)
+	_, err = tx.Exec(ctx, `SELECT id FROM sendhooks_outbox WHERE id = 1 FOR UPDATE`)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"webhook-2"}, claimedIDs(t, postgresAdapter, 2))
+
+	// Once the lock is released, the first row is claimed, and the rows in flight are not.
+	assert.NoError(t, tx.Rollback(ctx))
+	assert.Equal(t, []string{"webhook-1"}, claimedIDs(t, postgresAdapter, 2))
+	assert.Empty(t, claimedIDs(t, postgresAdapter, 2))
+}
+
+func TestLeaseExpiry(t *testing.T) {
+	postgresAdapter := newTestAdapter(t)
+	ctx := context.Background()
+
+	enqueue(t, postgresAdapter, "webhook-1")
+	assert.Equal(t, []string{"webhook-1"}, claimedIDs(t, postgresAdapter, 1))
+	assert.Empty(t, claimedIDs(t, postgresAdapter, 1))
+
+	// The instance holding the row died: it's claimed again once its lease expired.
+	_, err := postgresAdapter.pool.Exec(ctx, `UPDATE sendhooks_outbox SET locked_until = now() - interval '1 second'`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"webhook-1"}, claimedIDs(t, postgresAdapter, 1))
+}
+
+func TestExtendLease(t *testing.T) {
+	postgresAdapter := newTestAdapter(t)
+	ctx := context.Background()
+
+	enqueue(t, postgresAdapter, "webhook-1")
+	payloads, err := postgresAdapter.claim(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, payloads, 1)
+
+	// The lease is about to expire, extending it keeps the row from being claimed again.
+	_, err = postgresAdapter.pool.Exec(ctx, `UPDATE sendhooks_outbox SET locked_until = now() + interval '1 second'`)
+	assert.NoError(t, err)
+	assert.NoError(t, postgresAdapter.ExtendLease(ctx, payloads[0]))
+
+	var extended bool
+	assert.NoError(t, postgresAdapter.pool.QueryRow(ctx, `SELECT locked_until > now() + interval '1 minute' FROM sendhooks_outbox WHERE id = 1`).Scan(&extended))
+	assert.True(t, extended)
+
+	// A row that isn't in flight anymore has no lease.
+	assert.NoError(t, postgresAdapter.Acknowledge(ctx, payloads[0]))
+	assert.Error(t, postgresAdapter.ExtendLease(ctx, payloads[0]))
+}
+
+func TestScheduleRetry(t *testing.T) {
+	postgresAdapter := newTestAdapter(t)
+	ctx := context.Background()
+
+	enqueue(t, postgresAdapter, "webhook-1")
+	payloads, err := postgresAdapter.claim(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, payloads, 1)
+
+	payload := payloads[0]
+	payload.Attempts = []adapter.DeliveryAttempt{{Error: "failed"}}
+	payload.Accepted = "2024-06-01T10:00:00Z"
+
+	// The row isn't claimed before its retry.
+	assert.NoError(t, postgresAdapter.ScheduleRetry(ctx, payload, time.Now().Add(time.Hour)))
+	assert.Empty(t, claimedIDs(t, postgresAdapter, 1))
+
+	var lastError string
+	assert.NoError(t, postgresAdapter.pool.QueryRow(ctx, `SELECT last_error FROM sendhooks_outbox WHERE id = 1`).Scan(&lastError))
+	assert.Equal(t, "failed", lastError)
+
+	_, err = postgresAdapter.pool.Exec(ctx, `UPDATE sendhooks_outbox SET next_attempt_at = now()`)
+	assert.NoError(t, err)
+
+	// The retry gets the attempt history and the accepted time.
+	payloads, err = postgresAdapter.claim(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, payloads, 1)
+	assert.Equal(t, payload.MessageID, payloads[0].MessageID)
+	assert.Len(t, payloads[0].Attempts, 1)
+	assert.Equal(t, "2024-06-01T10:00:00Z", payloads[0].Accepted)
+
+	assert.NoError(t, postgresAdapter.Acknowledge(ctx, payloads[0]))
+	assert.Empty(t, claimedIDs(t, postgresAdapter, 1))
+}
+
+func TestDeadLetterAndRedrive(t *testing.T) {
+	postgresAdapter := newTestAdapter(t)
+	ctx := context.Background()
+
+	enqueue(t, postgresAdapter, "webhook-1")
+	payloads, err := postgresAdapter.claim(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, payloads, 1)
+
+	payload := payloads[0]
+	payload.Attempts = []adapter.DeliveryAttempt{{Error: "failed"}}
+	assert.NoError(t, postgresAdapter.DeadLetter(ctx, payload, "failed"))
+
+	// The webhook was accepted long ago, as saved by its retries.
+	_, err = postgresAdapter.pool.Exec(ctx, `UPDATE sendhooks_outbox SET payload = payload || '{"accepted": "2024-06-01T10:00:00Z", "rateLimitReserved": true}'`)
+	assert.NoError(t, err)
+
+	deadLetters, err := postgresAdapter.ListDeadLetters(ctx, adapter.DeadLetterFilter{WebhookID: "webhook-1"})
+	assert.NoError(t, err)
+	assert.Len(t, deadLetters, 1)
+	assert.Equal(t, "failed", deadLetters[0].LastError)
+	assert.Len(t, deadLetters[0].Payload.Attempts, 1)
+
+	// A dead letter isn't claimed until it's redriven, with a fresh attempt history, as accepted now.
+	assert.Empty(t, claimedIDs(t, postgresAdapter, 1))
+
+	redriven, err := postgresAdapter.RedriveDeadLetters(ctx, adapter.DeadLetterFilter{ID: deadLetters[0].ID})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, redriven)
+
+	payloads, err = postgresAdapter.claim(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, payloads, 1)
+	assert.Empty(t, payloads[0].Attempts)
+	accepted, err := time.Parse(time.RFC3339, payloads[0].Accepted)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), accepted, time.Minute)
+	assert.False(t, payloads[0].RateLimitReserved)
+
+	deadLetters, err = postgresAdapter.ListDeadLetters(ctx, adapter.DeadLetterFilter{})
+	assert.NoError(t, err)
+	assert.Empty(t, deadLetters)
+}
+
+func TestCancelWebhook(t *testing.T) {
+	postgresAdapter := newTestAdapter(t)
+	ctx := context.Background()
+
+	_, err := postgresAdapter.CancelWebhook(ctx, "webhook-1")
+	assert.ErrorIs(t, err, adapter.ErrWebhookNotFound)
+
+	enqueue(t, postgresAdapter, "webhook-1")
+	url, err := postgresAdapter.CancelWebhook(ctx, "webhook-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com", url)
+
+	cancelled, err := postgresAdapter.WebhookCancelled(ctx, "webhook-1")
+	assert.NoError(t, err)
+	assert.True(t, cancelled)
+}
@@ -0,0 +1,93 @@
+package redisadapter
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"sendhooks/adapter"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const cancelPageSize = 100
+
+// cancelledKey is the key marking a webhook as cancelled. It expires after the retention.
+func (r *RedisAdapter) cancelledKey(webhookID string) string {
+	return r.queueName + ":cancelled:" + webhookID
+}
+
+// CancelWebhook marks the webhook as cancelled when it's waiting in a stream or in the retry set.
+func (r *RedisAdapter) CancelWebhook(ctx context.Context, webhookID string) (string, error) {
+	url, err := r.findPending(ctx, webhookID)
+	if err != nil {
+		return "", err
+	}
+
+	err = r.client.Set(ctx, r.cancelledKey(webhookID), time.Now().UTC().Format(time.RFC3339), adapter.CancelRetention).Err()
+	return url, err
+}
+
+// findPending returns the URL of the webhook waiting in a stream or in the retry set. The acked
+// messages are deleted from the streams, so what's left is pending.
+func (r *RedisAdapter) findPending(ctx context.Context, webhookID string) (string, error) {
+	for _, lane := range r.lanes {
+		start := "-"
+		for {
+			entries, err := r.client.XRangeN(ctx, lane.stream, start, "+", cancelPageSize).Result()
+			if err != nil {
+				return "", err
+			}
+
+			for _, entry := range entries {
+				data, _ := entry.Values["data"].(string)
+				if url, ok := matchWebhook(data, webhookID); ok {
+					return url, nil
+				}
+			}
+
+			if len(entries) < cancelPageSize {
+				break
+			}
+			start = "(" + entries[len(entries)-1].ID
+		}
+	}
+
+	var cursor uint64
+	for {
+		members, next, err := r.client.ZScan(ctx, r.retrySet, cursor, "", cancelPageSize).Result()
+		if err != nil {
+			return "", err
+		}
+
+		// ZSCAN returns the members and their scores.
+		for i := 0; i < len(members); i += 2 {
+			if url, ok := matchWebhook(members[i], webhookID); ok {
+				return url, nil
+			}
+		}
+
+		if next == 0 {
+			return "", adapter.ErrWebhookNotFound
+		}
+		cursor = next
+	}
+}
+
+// matchWebhook returns the URL of the payload when it has the webhook ID.
+func matchWebhook(data, webhookID string) (string, bool) {
+	var payload adapter.WebhookPayload
+	if err := json.Unmarshal([]byte(data), &payload); err != nil || payload.WebhookID != webhookID {
+		return "", false
+	}
+	return payload.URL, true
+}
+
+// WebhookCancelled tells if the webhook was cancelled.
+func (r *RedisAdapter) WebhookCancelled(ctx context.Context, webhookID string) (bool, error) {
+	err := r.client.Get(ctx, r.cancelledKey(webhookID)).Err()
+	if err == redis.Nil {
+		return false, nil
+	}
+	return err == nil, err
+}
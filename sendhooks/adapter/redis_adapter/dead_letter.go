@@ -0,0 +1,173 @@
+package redisadapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"sendhooks/adapter"
+	"sendhooks/logging"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const deadLetterPageSize = 100
+
+// DeadLetter adds the payload to the dead-letter stream and removes the current message from the
+// stream in the same transaction.
+func (r *RedisAdapter) DeadLetter(ctx context.Context, payload adapter.WebhookPayload, lastError string) error {
+	messageID := payload.MessageID
+	payload.MessageID = ""
+
+	data, err := json.Marshal(adapter.DeadLetter{
+		Payload:   payload,
+		LastError: lastError,
+		Failed:    time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+
+	stream, entryID := r.locate(messageID)
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: r.deadLetterQueue,
+			Values: map[string]interface{}{"data": string(data)},
+		})
+		pipe.XAck(ctx, stream, r.consumerGroup, entryID)
+		pipe.XDel(ctx, stream, entryID)
+		return nil
+	})
+
+	return err
+}
+
+// ListDeadLetters returns the dead letters selected by the filter, oldest first.
+func (r *RedisAdapter) ListDeadLetters(ctx context.Context, filter adapter.DeadLetterFilter) ([]adapter.DeadLetter, error) {
+	start, end := "-", "+"
+	if filter.ID != "" {
+		start, end = filter.ID, filter.ID
+	} else {
+		// Stream IDs start with the insertion time in milliseconds, so the time range is applied by Redis.
+		if !filter.From.IsZero() {
+			start = strconv.FormatInt(filter.From.UnixMilli(), 10)
+		}
+		if !filter.To.IsZero() {
+			end = strconv.FormatInt(filter.To.UnixMilli(), 10)
+		}
+	}
+
+	var deadLetters []adapter.DeadLetter
+	for {
+		entries, err := r.client.XRangeN(ctx, r.deadLetterQueue, start, end, deadLetterPageSize).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			deadLetter, err := decodeDeadLetter(entry)
+			if err != nil {
+				logging.WebhookLogger(logging.ErrorType, err)
+				continue
+			}
+			if filter.Matches(deadLetter) {
+				deadLetters = append(deadLetters, deadLetter)
+			}
+		}
+
+		if len(entries) < deadLetterPageSize {
+			return deadLetters, nil
+		}
+		start = "(" + entries[len(entries)-1].ID
+	}
+}
+
+// GetDeadLetter returns a single dead letter.
+func (r *RedisAdapter) GetDeadLetter(ctx context.Context, id string) (adapter.DeadLetter, error) {
+	entries, err := r.client.XRange(ctx, r.deadLetterQueue, id, id).Result()
+	if err != nil {
+		return adapter.DeadLetter{}, err
+	}
+
+	if len(entries) == 0 {
+		return adapter.DeadLetter{}, fmt.Errorf("dead letter %s not found", id)
+	}
+
+	return decodeDeadLetter(entries[0])
+}
+
+// RedriveDeadLetters queues the selected dead letters again, in the streams of their priorities.
+// They start over as accepted now, so the max age of their retry policy counts from the redrive.
+func (r *RedisAdapter) RedriveDeadLetters(ctx context.Context, filter adapter.DeadLetterFilter) (int, error) {
+	deadLetters, err := r.ListDeadLetters(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	accepted := time.Now().UTC().Format(time.RFC3339)
+	redriven := 0
+	for _, deadLetter := range deadLetters {
+		payload := deadLetter.Payload
+		payload.Attempts = nil
+		payload.Accepted = accepted
+		payload.RateLimitReserved = false
+
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return redriven, err
+		}
+
+		_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: r.laneFor(payload.PriorityLevel()).stream,
+				Values: map[string]interface{}{"data": string(data)},
+			})
+			pipe.XDel(ctx, r.deadLetterQueue, deadLetter.ID)
+			return nil
+		})
+		if err != nil {
+			return redriven, err
+		}
+		redriven++
+	}
+
+	return redriven, nil
+}
+
+// PurgeDeadLetters deletes the selected dead letters.
+func (r *RedisAdapter) PurgeDeadLetters(ctx context.Context, filter adapter.DeadLetterFilter) (int, error) {
+	deadLetters, err := r.ListDeadLetters(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(deadLetters) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]string, 0, len(deadLetters))
+	for _, deadLetter := range deadLetters {
+		ids = append(ids, deadLetter.ID)
+	}
+
+	purged, err := r.client.XDel(ctx, r.deadLetterQueue, ids...).Result()
+	return int(purged), err
+}
+
+func decodeDeadLetter(entry redis.XMessage) (adapter.DeadLetter, error) {
+	var deadLetter adapter.DeadLetter
+
+	data, ok := entry.Values["data"].(string)
+	if !ok {
+		return deadLetter, fmt.Errorf("expected string for 'data' field of dead letter %s but got %T", entry.ID, entry.Values["data"])
+	}
+
+	if err := json.Unmarshal([]byte(data), &deadLetter); err != nil {
+		return deadLetter, fmt.Errorf("error unmarshalling dead letter %s: %w", entry.ID, err)
+	}
+
+	deadLetter.ID = entry.ID
+	return deadLetter, nil
+}
@@ -2,79 +2,203 @@ package redisadapter
 
 import (
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"math"
+	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	"sendhooks/adapter"
 	"sendhooks/logging"
-	worker "sendhooks/queue"
 	"sendhooks/utils"
 
 	"github.com/go-redis/redis/v8"
 )
 
+const (
+	defaultConsumerGroup = "sendhooks"
+	defaultClaimMinIdle  = 5 * time.Minute
+	defaultClaimInterval = time.Minute
+	readBlockTimeout     = time.Second
+	readCount            = 5
+	retryBatchSize       = 100
+)
+
+// requeueDueRetries moves the retries that are due from the retry set back to the stream of their
+// priority: KEYS[2], KEYS[3] and KEYS[4] are the streams of the high, normal and low priorities.
+// Running it as a script makes the move atomic, so several instances can run it at the same time.
+var requeueDueRetries = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, member in ipairs(due) do
+	local stream = KEYS[3]
+	local ok, payload = pcall(cjson.decode, member)
+	if ok and type(payload) == 'table' then
+		if payload.priority == 'high' then
+			stream = KEYS[2]
+		elseif payload.priority == 'low' then
+			stream = KEYS[4]
+		end
+	end
+
+	redis.call('ZREM', KEYS[1], member)
+	redis.call('XADD', stream, '*', 'data', member)
+end
+return #due
+`)
+
+// lane is the stream of the webhooks of a priority. The normal webhooks are in the configured
+// stream, the others in the streams suffixed with their priority.
+type lane struct {
+	priority string
+	stream   string
+	// count is the number of messages read at once, proportional to the weight of the priority.
+	count int64
+}
+
 // RedisAdapter implements the Adapter interface for Redis.
 type RedisAdapter struct {
-	client      *redis.Client
-	config      adapter.Configuration
-	queueName   string
-	statusQueue string
-	lastID      string
+	client          *redis.Client
+	config          adapter.Configuration
+	queueName       string
+	statusQueue     string
+	retrySet        string
+	deadLetterQueue string
+	consumerGroup   string
+	consumerName    string
+	claimMinIdle    time.Duration
+	claimInterval   time.Duration
+	lastClaim       time.Time
+	// lanes are ordered from the most urgent priority.
+	lanes []lane
 }
 
 // NewRedisAdapter creates a new RedisAdapter instance.
 func NewRedisAdapter(config adapter.Configuration) *RedisAdapter {
+	consumerGroup := config.Redis.RedisConsumerGroup
+	if consumerGroup == "" {
+		consumerGroup = defaultConsumerGroup
+	}
+
+	consumerName := config.Redis.RedisConsumerName
+	if consumerName == "" {
+		consumerName = defaultConsumerName()
+	}
+
+	claimMinIdle := defaultClaimMinIdle
+	if config.Redis.RedisClaimMinIdle > 0 {
+		claimMinIdle = time.Duration(config.Redis.RedisClaimMinIdle) * time.Second
+	}
+
+	claimInterval := defaultClaimInterval
+	if config.Redis.RedisClaimInterval > 0 {
+		claimInterval = time.Duration(config.Redis.RedisClaimInterval) * time.Second
+	}
+
+	retrySet := config.Redis.RedisRetrySetName
+	if retrySet == "" {
+		retrySet = config.Redis.RedisStreamName + ":retries"
+	}
+
+	deadLetterQueue := config.Redis.RedisDeadLetterStreamName
+	if deadLetterQueue == "" {
+		deadLetterQueue = config.Redis.RedisStreamName + ":dead-letter"
+	}
+
+	var lanes []lane
+	for _, priority := range adapter.Priorities {
+		stream := config.Redis.RedisStreamName
+		if priority != adapter.PriorityNormal {
+			stream += ":" + priority
+		}
+
+		weight := float64(config.Priority.Weight(priority)) / float64(config.Priority.Weight(adapter.PriorityNormal))
+		lanes = append(lanes, lane{priority: priority, stream: stream, count: int64(math.Ceil(readCount * weight))})
+	}
+
 	return &RedisAdapter{
-		config:      config,
-		queueName:   config.Redis.RedisStreamName,
-		statusQueue: config.Redis.RedisStreamStatusName,
-		lastID:      "0",
+		lanes:           lanes,
+		config:          config,
+		queueName:       config.Redis.RedisStreamName,
+		statusQueue:     config.Redis.RedisStreamStatusName,
+		retrySet:        retrySet,
+		deadLetterQueue: deadLetterQueue,
+		consumerGroup:   consumerGroup,
+		consumerName:    consumerName,
+		claimMinIdle:    claimMinIdle,
+		claimInterval:   claimInterval,
 	}
 }
 
-// Connect initializes the Redis client and establishes a connection.
-func (r *RedisAdapter) Connect() error {
-	redisAddress := r.config.Redis.RedisAddress
-	if redisAddress == "" {
-		redisAddress = "localhost:6379" // Default address
+// defaultConsumerName uses the hostname so that every instance gets its own
+// consumer inside the group.
+func defaultConsumerName() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return defaultConsumerGroup
 	}
+	return hostname
+}
 
-	redisDB := r.config.Redis.RedisDb
-	if redisDB == "" {
-		redisDB = "0" // Default database
+// Connect initializes the Redis client and establishes a connection.
+func (r *RedisAdapter) Connect() error {
+	client, err := utils.NewRedisClient(r.config.Redis, r.config.NumWorkers)
+	if err != nil {
+		return err
 	}
+	r.client = client
 
-	redisDBInt, _ := strconv.Atoi(redisDB)
-	redisPassword := r.config.Redis.RedisPassword
+	return r.createConsumerGroup(context.Background())
+}
 
-	useSSL := strings.ToLower(r.config.Redis.RedisSsl) == "true"
-	var tlsConfig *tls.Config
+// Close closes the connections to Redis.
+func (r *RedisAdapter) Close() error {
+	return r.client.Close()
+}
 
-	if useSSL {
-		caCertPath := r.config.Redis.RedisCaCert
-		clientCertPath := r.config.Redis.RedisClientCert
-		clientKeyPath := r.config.Redis.RedisClientKey
+// createConsumerGroup creates the consumer group and the streams of the lanes if needed. The group
+// starts at the beginning of the streams so that messages queued before the first start are
+// delivered.
+func (r *RedisAdapter) createConsumerGroup(ctx context.Context) error {
+	for _, lane := range r.lanes {
+		err := r.client.XGroupCreateMkStream(ctx, lane.stream, r.consumerGroup, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return fmt.Errorf("failed to create consumer group %s on %s: %w", r.consumerGroup, lane.stream, err)
+		}
+	}
+	return nil
+}
 
-		var err error
-		tlsConfig, err = utils.CreateTLSConfig(caCertPath, clientCertPath, clientKeyPath)
-		if err != nil {
-			return err
+// laneFor returns the lane of a priority, or the normal lane for an unknown priority.
+func (r *RedisAdapter) laneFor(priority string) lane {
+	normal := r.lanes[0]
+	for _, lane := range r.lanes {
+		if lane.priority == priority {
+			return lane
+		}
+		if lane.priority == adapter.PriorityNormal {
+			normal = lane
 		}
 	}
+	return normal
+}
 
-	r.client = redis.NewClient(&redis.Options{
-		Addr:      redisAddress,
-		Password:  redisPassword,
-		DB:        redisDBInt,
-		TLSConfig: tlsConfig,
-		PoolSize:  r.config.NumWorkers,
-	})
+// messageID returns the message ID of a stream entry. The IDs of the entries outside the normal
+// stream are prefixed with their priority, so the entry is found again from the payload alone.
+func (r *RedisAdapter) messageID(lane lane, entryID string) string {
+	if lane.priority == adapter.PriorityNormal {
+		return entryID
+	}
+	return lane.priority + ":" + entryID
+}
 
-	return nil
+// locate returns the stream and the entry ID of a message ID.
+func (r *RedisAdapter) locate(messageID string) (string, string) {
+	if priority, entryID, found := strings.Cut(messageID, ":"); found {
+		return r.laneFor(priority).stream, entryID
+	}
+	return r.queueName, messageID
 }
 
 // SubscribeToQueue subscribes to the specified Redis queue and processes messages.
@@ -84,6 +208,12 @@ func (r *RedisAdapter) SubscribeToQueue(ctx context.Context, queue chan<- adapte
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
+			if err := r.claimStaleMessages(ctx, queue); err != nil {
+				return err
+			}
+			if err := r.requeueRetries(ctx); err != nil {
+				return err
+			}
 			if err := r.processQueueMessages(ctx, queue); err != nil {
 				return err
 			}
@@ -98,66 +228,322 @@ func (r *RedisAdapter) processQueueMessages(ctx context.Context, queue chan<- ad
 		return err
 	}
 
+	return r.dispatchMessages(ctx, queue, messages)
+}
+
+// dispatchMessages pushes the messages to the workers. Messages stay pending in the consumer
+// group until the worker acknowledges them, so we wait for room in the channel instead of
+// dropping them.
+func (r *RedisAdapter) dispatchMessages(ctx context.Context, queue chan<- adapter.WebhookPayload, messages []adapter.WebhookPayload) error {
 	for _, payload := range messages {
 		select {
 		case queue <- payload:
-			_, delErr := r.client.XDel(ctx, r.queueName, payload.MessageID).Result()
-			if delErr != nil {
-				logging.WebhookLogger(logging.ErrorType, fmt.Errorf("failed to delete message %s: %v", payload.MessageID, delErr))
-			}
 		case <-ctx.Done():
 			return ctx.Err()
-		default:
-			logging.WebhookLogger(logging.WarningType, fmt.Errorf("dropped webhook due to channel overflow. Webhook ID: %s", payload.WebhookID))
 		}
 	}
 
 	return nil
 }
 
-// readMessagesFromQueue reads messages from the Redis queue.
+// readMessagesFromQueue reads new messages for this consumer from the consumer group. Each lane
+// is read up to its count, the most urgent first, so that the priorities share the workers by
+// weight during a backlog. When all the lanes are empty, it waits for a message in any of them.
 func (r *RedisAdapter) readMessagesFromQueue(ctx context.Context) ([]adapter.WebhookPayload, error) {
-	entries, err := r.client.XRead(ctx, &redis.XReadArgs{
-		Streams: []string{r.queueName, r.lastID},
-		Count:   5,
+	var messages []adapter.WebhookPayload
+	for _, lane := range r.lanes {
+		entries, err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    r.consumerGroup,
+			Consumer: r.consumerName,
+			Streams:  []string{lane.stream, ">"},
+			Count:    lane.count,
+			Block:    -1,
+		}).Result()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+
+		messages = append(messages, r.decodeStreams(ctx, entries)...)
+	}
+
+	if len(messages) > 0 {
+		return messages, nil
+	}
+
+	streams := make([]string, 0, 2*len(r.lanes))
+	for _, lane := range r.lanes {
+		streams = append(streams, lane.stream)
+	}
+	for range r.lanes {
+		streams = append(streams, ">")
+	}
+
+	entries, err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    r.consumerGroup,
+		Consumer: r.consumerName,
+		Streams:  streams,
+		Count:    readCount,
+		Block:    readBlockTimeout,
 	}).Result()
 
 	if err != nil {
 		if err == redis.Nil {
-			time.Sleep(time.Second)
-			return r.readMessagesFromQueue(ctx)
+			return nil, nil
 		}
 		return nil, err
 	}
 
+	return r.decodeStreams(ctx, entries), nil
+}
+
+// decodeStreams decodes the entries read from the streams of the lanes.
+func (r *RedisAdapter) decodeStreams(ctx context.Context, streams []redis.XStream) []adapter.WebhookPayload {
 	var messages []adapter.WebhookPayload
-	for _, entry := range entries[0].Messages {
-		var payload adapter.WebhookPayload
-
-		if data, ok := entry.Values["data"].(string); ok {
-			if err := json.Unmarshal([]byte(data), &payload); err != nil {
-				logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error unmarshalling message data: %w", err))
-				r.lastID = entry.ID
-				return nil, err
+	for _, stream := range streams {
+		for _, lane := range r.lanes {
+			if lane.stream != stream.Stream {
+				continue
+			}
+
+			for _, entry := range stream.Messages {
+				if payload, ok := r.decodeMessage(ctx, lane, entry); ok {
+					messages = append(messages, payload)
+				}
 			}
-		} else {
-			logging.WebhookLogger(logging.ErrorType, fmt.Errorf("expected string for 'data' field but got %T", entry.Values["data"]))
-			r.lastID = entry.ID
-			return nil, err
 		}
+	}
+
+	return messages
+}
 
-		payload.MessageID = entry.ID
-		messages = append(messages, payload)
-		r.lastID = entry.ID
+// claimStaleMessages takes over messages that stayed pending for too long on another consumer,
+// typically an instance that crashed in the middle of a delivery. It runs on the first call and
+// then once per claim interval.
+func (r *RedisAdapter) claimStaleMessages(ctx context.Context, queue chan<- adapter.WebhookPayload) error {
+	if !r.lastClaim.IsZero() && time.Since(r.lastClaim) < r.claimInterval {
+		return nil
 	}
+	r.lastClaim = time.Now()
 
-	return messages, nil
+	for _, lane := range r.lanes {
+		if err := r.claimStaleLaneMessages(ctx, lane, queue); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-// ProcessWebhooks processes webhooks from the specified queue.
-func (r *RedisAdapter) ProcessWebhooks(ctx context.Context, queue chan adapter.WebhookPayload, queueAdapter adapter.Adapter) {
+// claimStaleLaneMessages claims the stale messages of a lane.
+func (r *RedisAdapter) claimStaleLaneMessages(ctx context.Context, lane lane, queue chan<- adapter.WebhookPayload) error {
+	start := "0-0"
+	for {
+		entries, next, err := r.autoClaim(ctx, lane.stream, start)
+		if err != nil {
+			if err == redis.Nil {
+				return nil
+			}
+			return fmt.Errorf("failed to claim pending messages: %w", err)
+		}
+
+		var messages []adapter.WebhookPayload
+		for _, entry := range entries {
+			if payload, ok := r.decodeMessage(ctx, lane, entry); ok {
+				messages = append(messages, payload)
+			}
+		}
 
-	worker.ProcessWebhooks(ctx, queue, r.config, queueAdapter)
+		if len(messages) > 0 {
+			logging.WebhookLogger(logging.EventType, fmt.Sprintf("reclaimed %d pending messages", len(messages)))
+		}
+
+		if err := r.dispatchMessages(ctx, queue, messages); err != nil {
+			return err
+		}
+
+		if next == "0-0" || next == "" {
+			return nil
+		}
+		start = next
+	}
+}
+
+// autoClaim runs XAUTOCLAIM. The reply is parsed by hand because Redis 7 added a third element
+// (the deleted IDs) that the client library doesn't expect.
+func (r *RedisAdapter) autoClaim(ctx context.Context, stream, start string) ([]redis.XMessage, string, error) {
+	reply, err := r.client.Do(ctx, "XAUTOCLAIM", stream, r.consumerGroup, r.consumerName,
+		r.claimMinIdle.Milliseconds(), start, "COUNT", readCount).Slice()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(reply) < 2 {
+		return nil, "", fmt.Errorf("unexpected XAUTOCLAIM reply length: %d", len(reply))
+	}
+
+	next, ok := reply[0].(string)
+	if !ok {
+		return nil, "", fmt.Errorf("unexpected XAUTOCLAIM cursor type: %T", reply[0])
+	}
+
+	rawEntries, ok := reply[1].([]interface{})
+	if !ok {
+		return nil, "", fmt.Errorf("unexpected XAUTOCLAIM entries type: %T", reply[1])
+	}
+
+	var entries []redis.XMessage
+	for _, rawEntry := range rawEntries {
+		fields, ok := rawEntry.([]interface{})
+		if !ok || len(fields) != 2 {
+			continue
+		}
+
+		id, _ := fields[0].(string)
+		// Entries deleted from the stream while pending are returned without values.
+		rawValues, _ := fields[1].([]interface{})
+
+		values := make(map[string]interface{}, len(rawValues)/2)
+		for i := 0; i+1 < len(rawValues); i += 2 {
+			if key, ok := rawValues[i].(string); ok {
+				values[key] = rawValues[i+1]
+			}
+		}
+
+		entries = append(entries, redis.XMessage{ID: id, Values: values})
+	}
+
+	return entries, next, nil
+}
+
+// decodeMessage converts a stream entry into a payload. Entries that can't be decoded will never
+// be delivered, so they are acknowledged and removed right away.
+func (r *RedisAdapter) decodeMessage(ctx context.Context, lane lane, entry redis.XMessage) (adapter.WebhookPayload, bool) {
+	var payload adapter.WebhookPayload
+	messageID := r.messageID(lane, entry.ID)
+
+	data, ok := entry.Values["data"].(string)
+	if !ok {
+		logging.WebhookLogger(logging.ErrorType, fmt.Errorf("expected string for 'data' field but got %T", entry.Values["data"]))
+		r.discardMessage(ctx, messageID)
+		return payload, false
+	}
+
+	if err := json.Unmarshal([]byte(data), &payload); err != nil {
+		logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error unmarshalling message data: %w", err))
+		r.discardMessage(ctx, messageID)
+		return payload, false
+	}
+
+	payload.MessageID = messageID
+	return payload, true
+}
+
+// discardMessage acknowledges and deletes a message from the stream.
+func (r *RedisAdapter) discardMessage(ctx context.Context, messageID string) error {
+	stream, entryID := r.locate(messageID)
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAck(ctx, stream, r.consumerGroup, entryID)
+		pipe.XDel(ctx, stream, entryID)
+		return nil
+	})
+	if err != nil {
+		logging.WebhookLogger(logging.ErrorType, fmt.Errorf("failed to delete message %s: %v", messageID, err))
+	}
+	return err
+}
+
+// requeueRetries pushes the retries that are due back to the stream, where they are read like any
+// other message.
+func (r *RedisAdapter) requeueRetries(ctx context.Context) error {
+	for {
+		now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		keys := []string{r.retrySet}
+		for _, lane := range r.lanes {
+			keys = append(keys, lane.stream)
+		}
+
+		moved, err := requeueDueRetries.Run(ctx, r.client, keys, now, retryBatchSize).Int()
+		if err != nil {
+			return fmt.Errorf("failed to requeue scheduled retries: %w", err)
+		}
+
+		if moved < retryBatchSize {
+			return nil
+		}
+	}
+}
+
+// ScheduleRetry adds the payload to the retry set and removes the current message from the
+// stream in the same transaction, so the retry is never lost nor duplicated.
+func (r *RedisAdapter) ScheduleRetry(ctx context.Context, payload adapter.WebhookPayload, retryAt time.Time) error {
+	messageID := payload.MessageID
+	payload.MessageID = ""
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	stream, entryID := r.locate(messageID)
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, r.retrySet, &redis.Z{Score: float64(retryAt.UnixMilli()), Member: string(data)})
+		pipe.XAck(ctx, stream, r.consumerGroup, entryID)
+		pipe.XDel(ctx, stream, entryID)
+		return nil
+	})
+
+	return err
+}
+
+// Enqueue adds the payload to the stream of its priority. Delivered messages are deleted from the
+// stream, so its length is the position of the new message among the webhooks of its priority. A
+// webhook delivered later is added to the retry set until it's due instead, and its position is -1.
+func (r *RedisAdapter) Enqueue(ctx context.Context, payload adapter.WebhookPayload) (int64, error) {
+	payload.MessageID = ""
+	payload.ResolveDelay(time.Now())
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	if deliverAt, later := payload.DeliverLater(time.Now()); later {
+		err := r.client.ZAdd(ctx, r.retrySet, &redis.Z{Score: float64(deliverAt.UnixMilli()), Member: string(data)}).Err()
+		return -1, err
+	}
+
+	stream := r.laneFor(payload.PriorityLevel()).stream
+	var length *redis.IntCmd
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: stream,
+			Values: map[string]interface{}{"data": string(data)},
+		})
+		length = pipe.XLen(ctx, stream)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return length.Val(), nil
+}
+
+// ExtendLease claims the message again for this consumer, which resets its idle time, so other
+// instances don't reclaim it as stale.
+func (r *RedisAdapter) ExtendLease(ctx context.Context, payload adapter.WebhookPayload) error {
+	stream, entryID := r.locate(payload.MessageID)
+	return r.client.XClaimJustID(ctx, &redis.XClaimArgs{
+		Stream:   stream,
+		Group:    r.consumerGroup,
+		Consumer: r.consumerName,
+		Messages: []string{entryID},
+	}).Err()
+}
+
+// Acknowledge acknowledges the message in the consumer group and removes it from its stream.
+func (r *RedisAdapter) Acknowledge(ctx context.Context, payload adapter.WebhookPayload) error {
+	return r.discardMessage(ctx, payload.MessageID)
 }
 
 // PublishStatus publishes the status of a webhook delivery.
@@ -185,3 +571,54 @@ func (r *RedisAdapter) PublishStatus(ctx context.Context, webhookID, url, create
 
 	return err
 }
+
+// WatchStatuses reads the statuses added to the status stream from now on.
+func (r *RedisAdapter) WatchStatuses(ctx context.Context, statuses chan<- adapter.WebhookDeliveryStatus) error {
+	// The last ID is read once rather than passing "$" to every XREAD, which would skip the
+	// statuses added between two reads.
+	lastID := "0-0"
+	latest, err := r.client.XRevRangeN(ctx, r.statusQueue, "+", "-", 1).Result()
+	if err != nil {
+		return err
+	}
+	if len(latest) > 0 {
+		lastID = latest[0].ID
+	}
+
+	for {
+		streams, err := r.client.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{r.statusQueue, lastID},
+			Count:   100,
+			Block:   readBlockTimeout,
+		}).Result()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && err != redis.Nil {
+			return err
+		}
+
+		for _, stream := range streams {
+			for _, entry := range stream.Messages {
+				lastID = entry.ID
+
+				data, ok := entry.Values["data"].(string)
+				if !ok {
+					continue
+				}
+
+				var status adapter.WebhookDeliveryStatus
+				if err := json.Unmarshal([]byte(data), &status); err != nil {
+					logging.WebhookLogger(logging.WarningType, fmt.Errorf("error unmarshalling status %s: %w", entry.ID, err))
+					continue
+				}
+
+				select {
+				case statuses <- status:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,408 @@
+package redisadapter
+
+/*
+These tests run the Redis adapter against an in-memory Redis server to make sure that messages stay in the
+consumer group until the worker acknowledges them, and that messages left pending by a dead instance are reclaimed.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"sendhooks/adapter"
+	"sendhooks/logging"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAdapter(t *testing.T, server *miniredis.Miniredis, consumerName string) *RedisAdapter {
+	logging.WebhookLogger = func(errorType string, message interface{}) error {
+		return nil
+	}
+
+	redisAdapter := NewRedisAdapter(adapter.Configuration{
+		Redis: adapter.RedisConfig{
+			RedisAddress:          server.Addr(),
+			RedisStreamName:       "hooks",
+			RedisStreamStatusName: "hooks-status",
+			RedisConsumerName:     consumerName,
+			RedisClaimMinIdle:     60,
+		},
+		NumWorkers: 1,
+	})
+	assert.NoError(t, redisAdapter.Connect())
+
+	return redisAdapter
+}
+
+func addTestMessage(t *testing.T, server *miniredis.Miniredis, webhookID string) {
+	data, err := json.Marshal(adapter.WebhookPayload{URL: "http://example.com", WebhookID: webhookID})
+	assert.NoError(t, err)
+
+	_, err = server.XAdd("hooks", "*", []string{"data", string(data)})
+	assert.NoError(t, err)
+}
+
+func TestReadAndAcknowledge(t *testing.T) {
+	server := miniredis.RunT(t)
+	redisAdapter := newTestAdapter(t, server, "consumer-1")
+	ctx := context.Background()
+
+	addTestMessage(t, server, "webhook-1")
+
+	messages, err := redisAdapter.readMessagesFromQueue(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "webhook-1", messages[0].WebhookID)
+
+	// The message is pending until it is acknowledged.
+	pending, err := redisAdapter.client.XPending(ctx, "hooks", defaultConsumerGroup).Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), pending.Count)
+
+	assert.NoError(t, redisAdapter.Acknowledge(ctx, messages[0]))
+
+	pending, err = redisAdapter.client.XPending(ctx, "hooks", defaultConsumerGroup).Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), pending.Count)
+
+	length, err := redisAdapter.client.XLen(ctx, "hooks").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), length)
+}
+
+func TestMalformedMessagesAreDiscarded(t *testing.T) {
+	server := miniredis.RunT(t)
+	redisAdapter := newTestAdapter(t, server, "consumer-1")
+	ctx := context.Background()
+
+	_, err := server.XAdd("hooks", "*", []string{"data", "not json"})
+	assert.NoError(t, err)
+	addTestMessage(t, server, "webhook-1")
+
+	messages, err := redisAdapter.readMessagesFromQueue(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 1)
+
+	pending, err := redisAdapter.client.XPending(ctx, "hooks", defaultConsumerGroup).Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), pending.Count)
+}
+
+func TestClaimStaleMessages(t *testing.T) {
+	server := miniredis.RunT(t)
+	now := time.Now()
+	server.SetTime(now)
+
+	deadInstance := newTestAdapter(t, server, "consumer-1")
+	liveInstance := newTestAdapter(t, server, "consumer-2")
+	ctx := context.Background()
+
+	addTestMessage(t, server, "webhook-1")
+
+	// The first instance reads the message and dies before acknowledging it.
+	messages, err := deadInstance.readMessagesFromQueue(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 1)
+
+	// The message isn't idle long enough to be claimed yet.
+	queue := make(chan adapter.WebhookPayload, 1)
+	assert.NoError(t, liveInstance.claimStaleMessages(ctx, queue))
+	assert.Len(t, queue, 0)
+
+	server.SetTime(now.Add(2 * time.Minute))
+	liveInstance.lastClaim = time.Time{}
+	assert.NoError(t, liveInstance.claimStaleMessages(ctx, queue))
+	assert.Len(t, queue, 1)
+
+	claimed := <-queue
+	assert.Equal(t, "webhook-1", claimed.WebhookID)
+
+	pending, err := liveInstance.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: "hooks",
+		Group:  defaultConsumerGroup,
+		Start:  "-",
+		End:    "+",
+		Count:  10,
+	}).Result()
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "consumer-2", pending[0].Consumer)
+}
+
+func TestExtendLease(t *testing.T) {
+	server := miniredis.RunT(t)
+	now := time.Now()
+	server.SetTime(now)
+
+	busyInstance := newTestAdapter(t, server, "consumer-1")
+	otherInstance := newTestAdapter(t, server, "consumer-2")
+	ctx := context.Background()
+
+	addTestMessage(t, server, "webhook-1")
+
+	messages, err := busyInstance.readMessagesFromQueue(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 1)
+
+	// The message waiting in the first instance is not stale while its lease is extended.
+	server.SetTime(now.Add(50 * time.Second))
+	assert.NoError(t, busyInstance.ExtendLease(ctx, messages[0]))
+
+	server.SetTime(now.Add(100 * time.Second))
+	queue := make(chan adapter.WebhookPayload, 1)
+	assert.NoError(t, otherInstance.claimStaleMessages(ctx, queue))
+	assert.Len(t, queue, 0)
+}
+
+func TestScheduleRetry(t *testing.T) {
+	server := miniredis.RunT(t)
+	redisAdapter := newTestAdapter(t, server, "consumer-1")
+	ctx := context.Background()
+
+	addTestMessage(t, server, "webhook-1")
+
+	messages, err := redisAdapter.readMessagesFromQueue(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 1)
+
+	payload := messages[0]
+	payload.Attempts = append(payload.Attempts, adapter.DeliveryAttempt{Error: "failed"})
+
+	// A retry in the future stays in the retry set.
+	assert.NoError(t, redisAdapter.ScheduleRetry(ctx, payload, time.Now().Add(time.Hour)))
+	assert.NoError(t, redisAdapter.requeueRetries(ctx))
+
+	scheduled, err := redisAdapter.client.ZCard(ctx, "hooks:retries").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), scheduled)
+
+	pending, err := redisAdapter.client.XPending(ctx, "hooks", defaultConsumerGroup).Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), pending.Count)
+
+	// Once due, the retry is moved back to the stream with its attempt history.
+	members, err := redisAdapter.client.ZRange(ctx, "hooks:retries", 0, 0).Result()
+	assert.NoError(t, err)
+	assert.NoError(t, redisAdapter.client.ZAdd(ctx, "hooks:retries", &redis.Z{Score: 0, Member: members[0]}).Err())
+	assert.NoError(t, redisAdapter.requeueRetries(ctx))
+
+	scheduled, err = redisAdapter.client.ZCard(ctx, "hooks:retries").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), scheduled)
+
+	messages, err = redisAdapter.readMessagesFromQueue(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "webhook-1", messages[0].WebhookID)
+	assert.Len(t, messages[0].Attempts, 1)
+}
+
+func TestDeadLetters(t *testing.T) {
+	server := miniredis.RunT(t)
+	redisAdapter := newTestAdapter(t, server, "consumer-1")
+	ctx := context.Background()
+
+	addTestMessage(t, server, "webhook-1")
+	addTestMessage(t, server, "webhook-2")
+
+	messages, err := redisAdapter.readMessagesFromQueue(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 2)
+
+	for _, payload := range messages {
+		payload.Attempts = []adapter.DeliveryAttempt{{Error: "failed"}}
+		payload.Accepted = "2024-06-01T10:00:00Z"
+		payload.RateLimitReserved = true
+		assert.NoError(t, redisAdapter.DeadLetter(ctx, payload, "failed"))
+	}
+
+	length, err := redisAdapter.client.XLen(ctx, "hooks").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), length)
+
+	deadLetters, err := redisAdapter.ListDeadLetters(ctx, adapter.DeadLetterFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, deadLetters, 2)
+	assert.Equal(t, "failed", deadLetters[0].LastError)
+	assert.Len(t, deadLetters[0].Payload.Attempts, 1)
+
+	deadLetter, err := redisAdapter.GetDeadLetter(ctx, deadLetters[1].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "webhook-2", deadLetter.Payload.WebhookID)
+
+	_, err = redisAdapter.GetDeadLetter(ctx, "0-1")
+	assert.Error(t, err)
+
+	// Redrive a single webhook, it's queued again with a fresh attempt history, as accepted now.
+	redriven, err := redisAdapter.RedriveDeadLetters(ctx, adapter.DeadLetterFilter{WebhookID: "webhook-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, redriven)
+
+	messages, err = redisAdapter.readMessagesFromQueue(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "webhook-1", messages[0].WebhookID)
+	assert.Empty(t, messages[0].Attempts)
+	accepted, err := time.Parse(time.RFC3339, messages[0].Accepted)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), accepted, time.Minute)
+	assert.False(t, messages[0].RateLimitReserved)
+
+	purged, err := redisAdapter.PurgeDeadLetters(ctx, adapter.DeadLetterFilter{From: time.Now().Add(-time.Hour)})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	deadLetters, err = redisAdapter.ListDeadLetters(ctx, adapter.DeadLetterFilter{})
+	assert.NoError(t, err)
+	assert.Empty(t, deadLetters)
+}
+
+func TestEnqueue(t *testing.T) {
+	server := miniredis.RunT(t)
+	redisAdapter := newTestAdapter(t, server, "consumer-1")
+	ctx := context.Background()
+
+	position, err := redisAdapter.Enqueue(ctx, adapter.WebhookPayload{URL: "http://example.com", WebhookID: "webhook-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), position)
+
+	position, err = redisAdapter.Enqueue(ctx, adapter.WebhookPayload{URL: "http://example.com", WebhookID: "webhook-2"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), position)
+
+	messages, err := redisAdapter.readMessagesFromQueue(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 2)
+	assert.Equal(t, "webhook-1", messages[0].WebhookID)
+}
+
+func TestEnqueueDelayed(t *testing.T) {
+	server := miniredis.RunT(t)
+	redisAdapter := newTestAdapter(t, server, "consumer-1")
+	ctx := context.Background()
+
+	position, err := redisAdapter.Enqueue(ctx, adapter.WebhookPayload{URL: "http://example.com", WebhookID: "webhook-1", DelaySeconds: 3600})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1), position)
+
+	// The webhook waits in the retry set, not in the stream.
+	length, err := redisAdapter.client.XLen(ctx, "hooks").Result()
+	assert.NoError(t, err)
+	assert.Zero(t, length)
+
+	members, err := redisAdapter.client.ZRangeWithScores(ctx, "hooks:retries", 0, -1).Result()
+	assert.NoError(t, err)
+	assert.Len(t, members, 1)
+	assert.InDelta(t, float64(time.Now().Add(time.Hour).UnixMilli()), members[0].Score, 2000)
+
+	var payload adapter.WebhookPayload
+	assert.NoError(t, json.Unmarshal([]byte(members[0].Member.(string)), &payload))
+	assert.Zero(t, payload.DelaySeconds)
+	assert.NotEmpty(t, payload.DeliverAt)
+}
+
+func TestPriorityLanes(t *testing.T) {
+	server := miniredis.RunT(t)
+	redisAdapter := newTestAdapter(t, server, "consumer-1")
+	ctx := context.Background()
+
+	for i := 0; i < 20; i++ {
+		for _, priority := range []string{adapter.PriorityLow, "", adapter.PriorityHigh} {
+			_, err := redisAdapter.Enqueue(ctx, adapter.WebhookPayload{URL: "http://example.com", WebhookID: fmt.Sprintf("webhook-%s-%d", priority, i), Priority: priority})
+			assert.NoError(t, err)
+		}
+	}
+
+	// Each lane is read in proportion to its weight, the most urgent first.
+	messages, err := redisAdapter.readMessagesFromQueue(ctx)
+	assert.NoError(t, err)
+
+	counts := map[string]int{}
+	for _, message := range messages {
+		counts[message.PriorityLevel()]++
+	}
+	assert.Equal(t, map[string]int{adapter.PriorityHigh: 10, adapter.PriorityNormal: 5, adapter.PriorityLow: 3}, counts)
+	assert.Equal(t, adapter.PriorityHigh, messages[0].Priority)
+
+	// A webhook is acknowledged in the stream of its lane.
+	assert.NoError(t, redisAdapter.Acknowledge(ctx, messages[0]))
+	length, err := redisAdapter.client.XLen(ctx, "hooks:high").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(19), length)
+
+	// A retry goes back to the stream of its lane.
+	assert.NoError(t, redisAdapter.ScheduleRetry(ctx, messages[1], time.Now().Add(-time.Second)))
+	assert.NoError(t, redisAdapter.requeueRetries(ctx))
+
+	pending, err := redisAdapter.client.XPending(ctx, "hooks:high", defaultConsumerGroup).Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(8), pending.Count)
+	length, err = redisAdapter.client.XLen(ctx, "hooks:high").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(19), length)
+}
+
+func TestCancelWebhook(t *testing.T) {
+	server := miniredis.RunT(t)
+	redisAdapter := newTestAdapter(t, server, "consumer-1")
+	ctx := context.Background()
+
+	_, err := redisAdapter.CancelWebhook(ctx, "webhook-1")
+	assert.ErrorIs(t, err, adapter.ErrWebhookNotFound)
+
+	// A webhook is found in its stream or in the retry set.
+	_, err = redisAdapter.Enqueue(ctx, adapter.WebhookPayload{URL: "http://example.com/1", WebhookID: "webhook-1", Priority: adapter.PriorityLow})
+	assert.NoError(t, err)
+	_, err = redisAdapter.Enqueue(ctx, adapter.WebhookPayload{URL: "http://example.com/3", WebhookID: "webhook-3", DelaySeconds: 60})
+	assert.NoError(t, err)
+
+	url, err := redisAdapter.CancelWebhook(ctx, "webhook-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com/1", url)
+	url, err = redisAdapter.CancelWebhook(ctx, "webhook-3")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com/3", url)
+
+	cancelled, err := redisAdapter.WebhookCancelled(ctx, "webhook-1")
+	assert.NoError(t, err)
+	assert.True(t, cancelled)
+
+	cancelled, err = redisAdapter.WebhookCancelled(ctx, "webhook-2")
+	assert.NoError(t, err)
+	assert.False(t, cancelled)
+
+	// The cancellation is forgotten after the retention.
+	server.FastForward(adapter.CancelRetention)
+	cancelled, err = redisAdapter.WebhookCancelled(ctx, "webhook-1")
+	assert.NoError(t, err)
+	assert.False(t, cancelled)
+}
+
+func TestWatchStatuses(t *testing.T) {
+	server := miniredis.RunT(t)
+	redisAdapter := newTestAdapter(t, server, "consumer-1")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Statuses published before the watcher started are not sent.
+	assert.NoError(t, redisAdapter.PublishStatus(ctx, "webhook-1", "http://example.com", "", "", "retrying", "", 0, 1))
+
+	statuses := make(chan adapter.WebhookDeliveryStatus, 1)
+	go redisAdapter.WatchStatuses(ctx, statuses)
+	time.Sleep(100 * time.Millisecond)
+
+	assert.NoError(t, redisAdapter.PublishStatus(ctx, "webhook-1", "http://example.com", "", "", "success", "", 0, 2))
+
+	select {
+	case status := <-statuses:
+		assert.Equal(t, "success", status.Status)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no status received")
+	}
+}
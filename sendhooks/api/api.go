@@ -0,0 +1,367 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"sendhooks/adapter"
+	"sendhooks/logging"
+	"sendhooks/sender"
+	"sendhooks/utils"
+)
+
+const (
+	maxBodySize  = 1 << 20
+	maxBatchSize = 100
+)
+
+// Server exposes the adapter over HTTP, so that producers can submit webhooks without talking to
+// the broker.
+type Server struct {
+	config       adapter.Configuration
+	queueAdapter adapter.Adapter
+}
+
+// NewServer creates the HTTP server of the API, listening on the configured address. It fails
+// without an authentication token, unless unauthenticated requests are explicitly allowed.
+func NewServer(config adapter.Configuration, queueAdapter adapter.Adapter) (*http.Server, error) {
+	if len(config.Http.HttpAuthTokens) == 0 && strings.ToLower(config.Http.HttpAllowUnauthenticated) != "true" {
+		return nil, errors.New("httpAuthTokens is empty, set httpAllowUnauthenticated to serve the API without authentication")
+	}
+
+	server := &Server{config: config, queueAdapter: queueAdapter}
+
+	return &http.Server{
+		Addr:              config.Http.HttpListenAddress,
+		Handler:           server.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}, nil
+}
+
+// Handler returns the routes of the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/webhooks", s.handleWebhooks)
+	mux.HandleFunc("/v1/webhooks/batch", s.handleBatch)
+	mux.HandleFunc("/v1/webhooks/", s.handleWebhook)
+
+	// The public keys are published without authentication, receivers fetch them to verify the
+	// webhooks.
+	root := http.NewServeMux()
+	root.HandleFunc("/.well-known/jwks.json", s.handleJWKS)
+	root.Handle("/", s.authenticate(mux))
+	return root
+}
+
+// handleJWKS serves the public keys of the asymmetric signing mode.
+func (s *Server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	jwks, err := sender.PublicKeys(s.config)
+	if err != nil {
+		logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error loading the public keys: %w", err))
+		writeError(w, http.StatusInternalServerError, errors.New("failed to load the public keys"))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, jwks)
+}
+
+// authenticate rejects the requests without one of the configured bearer tokens. Without a token,
+// every request is rejected unless unauthenticated requests are allowed.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	tokens := s.config.Http.HttpAuthTokens
+	if len(tokens) == 0 && strings.ToLower(s.config.Http.HttpAllowUnauthenticated) == "true" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r.Header.Get("Authorization"), tokens) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorized checks that the authorization header holds one of the tokens.
+func authorized(authorization string, tokens []string) bool {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok {
+		return false
+	}
+
+	matched := false
+	for _, expected := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 {
+			matched = true
+		}
+	}
+
+	return matched
+}
+
+// enqueueResponse is returned once a webhook is queued.
+type enqueueResponse struct {
+	WebhookID string `json:"webhookId"`
+	// Position is the position of the webhook in the queue, or -1 when the broker can't tell.
+	Position int64 `json:"position"`
+}
+
+// batchResponse is returned once a batch is queued.
+type batchResponse struct {
+	Webhooks []enqueueResponse `json:"webhooks"`
+	// Error is set when a webhook of the batch could not be queued. Webhooks lists the ones queued
+	// before it.
+	Error string `json:"error,omitempty"`
+}
+
+// cancelResponse is returned when a webhook is cancelled.
+type cancelResponse struct {
+	WebhookID string `json:"webhookId"`
+	Status    string `json:"status"`
+}
+
+// errorResponse is returned when a request fails.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// handleWebhooks queues the webhook sent in the request body.
+func (s *Server) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	enqueuer, ok := s.enqueuer(w, r)
+	if !ok {
+		return
+	}
+
+	var payload adapter.WebhookPayload
+	if err := decodeBody(w, r, &payload); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := preparePayload(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	position, err := enqueuer.Enqueue(r.Context(), payload)
+	if err != nil {
+		logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error enqueueing webhook: %w", err))
+		writeError(w, http.StatusInternalServerError, errors.New("failed to enqueue the webhook"))
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, enqueueResponse{WebhookID: payload.WebhookID, Position: position})
+}
+
+// handleBatch queues the webhooks sent as a JSON array in the request body. The whole batch is
+// validated before any webhook is queued.
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	enqueuer, ok := s.enqueuer(w, r)
+	if !ok {
+		return
+	}
+
+	var payloads []adapter.WebhookPayload
+	if err := decodeBody(w, r, &payloads); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if len(payloads) == 0 || len(payloads) > maxBatchSize {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("a batch holds between 1 and %d webhooks", maxBatchSize))
+		return
+	}
+
+	for i := range payloads {
+		if err := preparePayload(&payloads[i]); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("webhook %d: %w", i, err))
+			return
+		}
+	}
+
+	response := batchResponse{Webhooks: make([]enqueueResponse, 0, len(payloads))}
+	for i, payload := range payloads {
+		position, err := enqueuer.Enqueue(r.Context(), payload)
+		if err != nil {
+			logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error enqueueing webhook: %w", err))
+			response.Error = fmt.Sprintf("failed to enqueue webhook %d", i)
+			writeJSON(w, http.StatusInternalServerError, response)
+			return
+		}
+
+		response.Webhooks = append(response.Webhooks, enqueueResponse{WebhookID: payload.WebhookID, Position: position})
+	}
+
+	writeJSON(w, http.StatusAccepted, response)
+}
+
+// enqueuer checks that the request can be served by an adapter able to queue webhooks.
+func (s *Server) enqueuer(w http.ResponseWriter, r *http.Request) (adapter.Enqueuer, bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return nil, false
+	}
+
+	enqueuer, ok := s.queueAdapter.(adapter.Enqueuer)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, fmt.Errorf("the %s broker does not support enqueueing", s.config.Broker))
+		return nil, false
+	}
+
+	return enqueuer, true
+}
+
+// decodeBody decodes the JSON request body, rejecting unknown fields.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	return nil
+}
+
+// preparePayload validates a submitted payload and assigns it a webhook ID if it has none.
+func preparePayload(payload *adapter.WebhookPayload) error {
+	target, err := url.Parse(payload.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+
+	if payload.MessageID != "" || payload.EnqueueID != "" || len(payload.Attempts) > 0 || payload.Accepted != "" || payload.RateLimitReserved {
+		return errors.New("messageId, enqueueId, attempts, accepted and rateLimitReserved are set by sendhooks")
+	}
+
+	if payload.DeliverAt != "" {
+		if _, err := time.Parse(time.RFC3339, payload.DeliverAt); err != nil {
+			return errors.New("deliverAt must be an RFC 3339 time")
+		}
+	}
+
+	if payload.DelaySeconds < 0 {
+		return errors.New("delaySeconds must not be negative")
+	}
+
+	switch payload.Priority {
+	case "", adapter.PriorityHigh, adapter.PriorityNormal, adapter.PriorityLow:
+	default:
+		return errors.New("priority must be high, normal or low")
+	}
+
+	if payload.ExpiresAt != "" {
+		if _, err := time.Parse(time.RFC3339, payload.ExpiresAt); err != nil {
+			return errors.New("expiresAt must be an RFC 3339 time")
+		}
+	}
+
+	if payload.WebhookID == "" && payload.IdempotencyKey != "" {
+		payload.WebhookID = utils.WebhookIDForKey(payload.IdempotencyKey)
+	}
+
+	if payload.WebhookID == "" {
+		webhookID, err := utils.NewWebhookID()
+		if err != nil {
+			return err
+		}
+		payload.WebhookID = webhookID
+	}
+
+	enqueueID, err := utils.NewWebhookID()
+	if err != nil {
+		return err
+	}
+	payload.EnqueueID = enqueueID
+
+	return nil
+}
+
+// handleWebhook serves GET /v1/webhooks/{webhookId}/statuses and POST /v1/webhooks/{webhookId}/cancel.
+func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	webhookID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/webhooks/"), "/")
+	if webhookID == "" || (action != "statuses" && action != "cancel") {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	method := http.MethodGet
+	if action == "cancel" {
+		method = http.MethodPost
+	}
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	if action == "cancel" {
+		s.cancelWebhook(w, r, webhookID)
+		return
+	}
+
+	statusStore, ok := s.queueAdapter.(adapter.StatusStore)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, fmt.Errorf("the %s broker does not keep the delivery statuses", s.config.Broker))
+		return
+	}
+
+	statuses, err := statusStore.ListStatuses(r.Context(), webhookID)
+	if err != nil {
+		logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error listing statuses: %w", err))
+		writeError(w, http.StatusInternalServerError, errors.New("failed to list the statuses"))
+		return
+	}
+
+	if statuses == nil {
+		statuses = []adapter.WebhookDeliveryStatus{}
+	}
+
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// cancelWebhook stops the delivery of a webhook. A webhook being sent is still delivered.
+func (s *Server) cancelWebhook(w http.ResponseWriter, r *http.Request, webhookID string) {
+	err := adapter.Cancel(r.Context(), s.queueAdapter, webhookID)
+	if errors.Is(err, adapter.ErrCancelNotSupported) {
+		writeError(w, http.StatusNotImplemented, fmt.Errorf("the %s broker does not support cancellation", s.config.Broker))
+		return
+	}
+	if errors.Is(err, adapter.ErrWebhookNotFound) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("webhook %s is not waiting for delivery", webhookID))
+		return
+	}
+	if err != nil {
+		logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error cancelling webhook: %w", err))
+		writeError(w, http.StatusInternalServerError, errors.New("failed to cancel the webhook"))
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, cancelResponse{WebhookID: webhookID, Status: "cancelled"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,276 @@
+package api
+
+/*
+These tests check the validation and authentication of the ingestion API, and that accepted webhooks reach the
+adapter with a webhook ID.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sendhooks/adapter"
+	"sendhooks/logging"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockAdapter struct {
+	mu       sync.Mutex
+	enqueued []adapter.WebhookPayload
+	// cancelled lists the cancelled webhooks, and statuses the published statuses.
+	cancelled []string
+	statuses  []string
+	// published feeds the status watchers.
+	published chan adapter.WebhookDeliveryStatus
+}
+
+func (m *mockAdapter) Connect() error { return nil }
+
+func (m *mockAdapter) SubscribeToQueue(ctx context.Context, queue chan<- adapter.WebhookPayload) error {
+	return nil
+}
+
+func (m *mockAdapter) PublishStatus(ctx context.Context, webhookID, url, created, delivered, status, deliveryError string, payloadSize int, numberOfTries int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.statuses = append(m.statuses, status)
+	return nil
+}
+
+func (m *mockAdapter) Acknowledge(ctx context.Context, payload adapter.WebhookPayload) error {
+	return nil
+}
+
+func (m *mockAdapter) ScheduleRetry(ctx context.Context, payload adapter.WebhookPayload, retryAt time.Time) error {
+	return nil
+}
+
+func (m *mockAdapter) DeadLetter(ctx context.Context, payload adapter.WebhookPayload, lastError string) error {
+	return nil
+}
+
+func (m *mockAdapter) Enqueue(ctx context.Context, payload adapter.WebhookPayload) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enqueued = append(m.enqueued, payload)
+	return int64(len(m.enqueued)), nil
+}
+
+func (m *mockAdapter) CancelWebhook(ctx context.Context, webhookID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, payload := range m.enqueued {
+		if payload.WebhookID == webhookID {
+			m.cancelled = append(m.cancelled, webhookID)
+			return payload.URL, nil
+		}
+	}
+	return "", adapter.ErrWebhookNotFound
+}
+
+func (m *mockAdapter) WebhookCancelled(ctx context.Context, webhookID string) (bool, error) {
+	return false, nil
+}
+
+func (m *mockAdapter) WatchStatuses(ctx context.Context, statuses chan<- adapter.WebhookDeliveryStatus) error {
+	for {
+		select {
+		case status := <-m.published:
+			select {
+			case statuses <- status:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func newTestHandler(tokens ...string) (http.Handler, *mockAdapter) {
+	logging.WebhookLogger = func(errorType string, message interface{}) error {
+		return nil
+	}
+
+	// Without a token, the handler is explicitly unauthenticated.
+	unauthenticated := ""
+	if len(tokens) == 0 {
+		unauthenticated = "true"
+	}
+
+	queueAdapter := &mockAdapter{}
+	server := &Server{
+		config:       adapter.Configuration{Http: adapter.HttpConfig{HttpAuthTokens: tokens, HttpAllowUnauthenticated: unauthenticated}},
+		queueAdapter: queueAdapter,
+	}
+
+	return server.Handler(), queueAdapter
+}
+
+func post(handler http.Handler, path, body, token string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestEnqueueWebhook(t *testing.T) {
+	t.Run("Webhook ID is assigned when missing", func(t *testing.T) {
+		handler, queueAdapter := newTestHandler()
+
+		recorder := post(handler, "/v1/webhooks", `{"url": "https://example.com/hooks", "data": {"event": "created"}}`, "")
+		assert.Equal(t, http.StatusAccepted, recorder.Code)
+
+		var response enqueueResponse
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.Len(t, response.WebhookID, 36)
+		assert.Equal(t, int64(1), response.Position)
+
+		assert.Len(t, queueAdapter.enqueued, 1)
+		assert.Equal(t, response.WebhookID, queueAdapter.enqueued[0].WebhookID)
+	})
+
+	t.Run("Webhook ID is kept when set", func(t *testing.T) {
+		handler, queueAdapter := newTestHandler()
+
+		recorder := post(handler, "/v1/webhooks", `{"url": "https://example.com/hooks", "webhookId": "42"}`, "")
+		assert.Equal(t, http.StatusAccepted, recorder.Code)
+		assert.Equal(t, "42", queueAdapter.enqueued[0].WebhookID)
+		assert.Len(t, queueAdapter.enqueued[0].EnqueueID, 36)
+	})
+
+	t.Run("Invalid payloads are rejected", func(t *testing.T) {
+		handler, queueAdapter := newTestHandler()
+
+		for _, body := range []string{
+			`{"webhookId": "42"}`,
+			`{"url": "example.com/hooks"}`,
+			`{"url": "ftp://example.com/hooks"}`,
+			`{"url": "https://example.com/hooks", "attempts": [{"error": "failed"}]}`,
+			`{"url": "https://example.com/hooks", "enqueueId": "1"}`,
+			`{"url": "https://example.com/hooks", "unknown": true}`,
+			`{"url": "https://example.com/hooks", "expiresAt": "tomorrow"}`,
+			`{"url": "https://example.com/hooks", "priority": "urgent"}`,
+			`not json`,
+		} {
+			recorder := post(handler, "/v1/webhooks", body, "")
+			assert.Equal(t, http.StatusBadRequest, recorder.Code, body)
+		}
+
+		assert.Empty(t, queueAdapter.enqueued)
+	})
+
+	t.Run("Requests without a valid token are rejected", func(t *testing.T) {
+		handler, queueAdapter := newTestHandler("secret")
+
+		recorder := post(handler, "/v1/webhooks", `{"url": "https://example.com/hooks"}`, "")
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+		recorder = post(handler, "/v1/webhooks", `{"url": "https://example.com/hooks"}`, "wrong")
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+		recorder = post(handler, "/v1/webhooks", `{"url": "https://example.com/hooks"}`, "secret")
+		assert.Equal(t, http.StatusAccepted, recorder.Code)
+		assert.Len(t, queueAdapter.enqueued, 1)
+	})
+
+	t.Run("API without a token is refused unless explicitly allowed", func(t *testing.T) {
+		_, err := NewServer(adapter.Configuration{}, &mockAdapter{})
+		assert.Error(t, err)
+
+		_, err = NewServer(adapter.Configuration{Http: adapter.HttpConfig{HttpAllowUnauthenticated: "true"}}, &mockAdapter{})
+		assert.NoError(t, err)
+
+		handler := (&Server{queueAdapter: &mockAdapter{}}).Handler()
+		recorder := post(handler, "/v1/webhooks", `{"url": "https://example.com/hooks"}`, "")
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+}
+
+func TestCancelWebhook(t *testing.T) {
+	t.Run("Webhook is cancelled", func(t *testing.T) {
+		handler, queueAdapter := newTestHandler()
+		queueAdapter.enqueued = []adapter.WebhookPayload{{URL: "https://example.com/hooks", WebhookID: "42"}}
+
+		recorder := post(handler, "/v1/webhooks/42/cancel", "", "")
+		assert.Equal(t, http.StatusAccepted, recorder.Code)
+
+		var response cancelResponse
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.Equal(t, cancelResponse{WebhookID: "42", Status: "cancelled"}, response)
+
+		assert.Equal(t, []string{"42"}, queueAdapter.cancelled)
+		assert.Equal(t, []string{"cancelled"}, queueAdapter.statuses)
+	})
+
+	t.Run("Unknown webhook is not found", func(t *testing.T) {
+		handler, queueAdapter := newTestHandler()
+
+		recorder := post(handler, "/v1/webhooks/42/cancel", "", "")
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+		assert.Empty(t, queueAdapter.cancelled)
+		assert.Empty(t, queueAdapter.statuses)
+	})
+
+	t.Run("Only POST cancels", func(t *testing.T) {
+		handler, queueAdapter := newTestHandler()
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/webhooks/42/cancel", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+		assert.Equal(t, http.MethodPost, recorder.Header().Get("Allow"))
+
+		recorder = post(handler, "/v1/webhooks/42/cancel/now", "", "")
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+		assert.Empty(t, queueAdapter.cancelled)
+	})
+}
+
+func TestEnqueueBatch(t *testing.T) {
+	t.Run("Every webhook is queued", func(t *testing.T) {
+		handler, queueAdapter := newTestHandler()
+
+		recorder := post(handler, "/v1/webhooks/batch", `[{"url": "https://example.com/a"}, {"url": "https://example.com/b", "webhookId": "b"}]`, "")
+		assert.Equal(t, http.StatusAccepted, recorder.Code)
+
+		var response batchResponse
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.Len(t, response.Webhooks, 2)
+		assert.Equal(t, "b", response.Webhooks[1].WebhookID)
+		assert.Len(t, queueAdapter.enqueued, 2)
+	})
+
+	t.Run("Nothing is queued when a webhook is invalid", func(t *testing.T) {
+		handler, queueAdapter := newTestHandler()
+
+		recorder := post(handler, "/v1/webhooks/batch", `[{"url": "https://example.com/a"}, {"webhookId": "b"}]`, "")
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "webhook 1")
+		assert.Empty(t, queueAdapter.enqueued)
+	})
+}
+
+func TestJWKS(t *testing.T) {
+	handler, _ := newTestHandler("secret")
+
+	// The public keys are served without authentication.
+	request := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"keys": []}`, recorder.Body.String())
+}
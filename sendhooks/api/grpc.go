@@ -0,0 +1,210 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"sendhooks/adapter"
+	"sendhooks/api/webhookspb"
+	"sendhooks/logging"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GrpcServer implements the WebhookService of api/proto/sendhooks/v1/webhooks.proto.
+type GrpcServer struct {
+	webhookspb.UnimplementedWebhookServiceServer
+
+	config       adapter.Configuration
+	queueAdapter adapter.Adapter
+}
+
+// NewGrpcServer creates the gRPC server of the API, with the WebhookService registered.
+// It fails without an authentication token, unless unauthenticated calls are explicitly allowed.
+func NewGrpcServer(config adapter.Configuration, queueAdapter adapter.Adapter) (*grpc.Server, error) {
+	if len(config.Grpc.GrpcAuthTokens) == 0 && strings.ToLower(config.Grpc.GrpcAllowUnauthenticated) != "true" {
+		return nil, errors.New("grpcAuthTokens is empty, set grpcAllowUnauthenticated to serve the API without authentication")
+	}
+
+	service := &GrpcServer{config: config, queueAdapter: queueAdapter}
+
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(service.authenticateUnary),
+		grpc.StreamInterceptor(service.authenticateStream),
+	)
+	webhookspb.RegisterWebhookServiceServer(server, service)
+
+	return server, nil
+}
+
+// checkToken rejects the calls without one of the configured bearer tokens. Without a token, every
+// call is rejected unless unauthenticated calls are allowed.
+func (g *GrpcServer) checkToken(ctx context.Context) error {
+	tokens := g.config.Grpc.GrpcAuthTokens
+	if len(tokens) == 0 && strings.ToLower(g.config.Grpc.GrpcAllowUnauthenticated) == "true" {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, authorization := range md.Get("authorization") {
+		if authorized(authorization, tokens) {
+			return nil
+		}
+	}
+
+	return status.Error(codes.Unauthenticated, "unauthorized")
+}
+
+func (g *GrpcServer) authenticateUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := g.checkToken(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (g *GrpcServer) authenticateStream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := g.checkToken(stream.Context()); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// Enqueue validates a webhook and queues it.
+func (g *GrpcServer) Enqueue(ctx context.Context, req *webhookspb.EnqueueRequest) (*webhookspb.EnqueueResponse, error) {
+	enqueuer, err := g.enqueuer()
+	if err != nil {
+		return nil, err
+	}
+
+	payload := fromProto(req.GetWebhook())
+	if err := preparePayload(&payload); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	position, err := enqueuer.Enqueue(ctx, payload)
+	if err != nil {
+		logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error enqueueing webhook: %w", err))
+		return nil, status.Error(codes.Internal, "failed to enqueue the webhook")
+	}
+
+	return &webhookspb.EnqueueResponse{WebhookId: payload.WebhookID, Position: position}, nil
+}
+
+// EnqueueBatch validates all the webhooks, then queues them.
+func (g *GrpcServer) EnqueueBatch(ctx context.Context, req *webhookspb.EnqueueBatchRequest) (*webhookspb.EnqueueBatchResponse, error) {
+	enqueuer, err := g.enqueuer()
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := req.GetWebhooks()
+	if len(webhooks) == 0 || len(webhooks) > maxBatchSize {
+		return nil, status.Errorf(codes.InvalidArgument, "a batch holds between 1 and %d webhooks", maxBatchSize)
+	}
+
+	payloads := make([]adapter.WebhookPayload, len(webhooks))
+	for i, webhook := range webhooks {
+		payloads[i] = fromProto(webhook)
+		if err := preparePayload(&payloads[i]); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "webhook %d: %v", i, err)
+		}
+	}
+
+	response := &webhookspb.EnqueueBatchResponse{}
+	for i, payload := range payloads {
+		position, err := enqueuer.Enqueue(ctx, payload)
+		if err != nil {
+			logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error enqueueing webhook: %w", err))
+			return nil, status.Errorf(codes.Internal, "failed to enqueue webhook %d, the %d webhooks before it were queued", i, i)
+		}
+
+		response.Webhooks = append(response.Webhooks, &webhookspb.EnqueueResponse{WebhookId: payload.WebhookID, Position: position})
+	}
+
+	return response, nil
+}
+
+// WatchStatus streams the statuses of a webhook ID or a URL until the client cancels the call.
+func (g *GrpcServer) WatchStatus(req *webhookspb.WatchStatusRequest, stream webhookspb.WebhookService_WatchStatusServer) error {
+	webhookID, url := req.GetWebhookId(), req.GetUrl()
+	if webhookID == "" && url == "" {
+		return status.Error(codes.InvalidArgument, "webhook_id or url is required")
+	}
+
+	watcher, ok := g.queueAdapter.(adapter.StatusWatcher)
+	if !ok {
+		return status.Errorf(codes.Unimplemented, "the %s broker does not support watching statuses", g.config.Broker)
+	}
+
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	statuses := make(chan adapter.WebhookDeliveryStatus)
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- watcher.WatchStatuses(ctx, statuses)
+	}()
+
+	for {
+		select {
+		case deliveryStatus := <-statuses:
+			if (webhookID != "" && deliveryStatus.WebhookID != webhookID) || (url != "" && deliveryStatus.URL != url) {
+				continue
+			}
+
+			if err := stream.Send(toProto(deliveryStatus)); err != nil {
+				return err
+			}
+		case err := <-watchErr:
+			if stream.Context().Err() != nil {
+				return nil
+			}
+			logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error watching statuses: %w", err))
+			return status.Error(codes.Unavailable, "failed to watch the statuses")
+		}
+	}
+}
+
+// enqueuer returns the adapter if it can queue webhooks.
+func (g *GrpcServer) enqueuer() (adapter.Enqueuer, error) {
+	enqueuer, ok := g.queueAdapter.(adapter.Enqueuer)
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "the %s broker does not support enqueueing", g.config.Broker)
+	}
+	return enqueuer, nil
+}
+
+func fromProto(webhook *webhookspb.WebhookPayload) adapter.WebhookPayload {
+	return adapter.WebhookPayload{
+		URL:            webhook.GetUrl(),
+		WebhookID:      webhook.GetWebhookId(),
+		Data:           webhook.GetData().AsMap(),
+		SecretHash:     webhook.GetSecretHash(),
+		MetaData:       webhook.GetMetaData().AsMap(),
+		IdempotencyKey: webhook.GetIdempotencyKey(),
+		DeliverAt:      webhook.GetDeliverAt(),
+		DelaySeconds:   int(webhook.GetDelaySeconds()),
+		OrderingKey:    webhook.GetOrderingKey(),
+		RetryPolicy:    webhook.GetRetryPolicy(),
+		ExpiresAt:      webhook.GetExpiresAt(),
+		Priority:       webhook.GetPriority(),
+	}
+}
+
+func toProto(deliveryStatus adapter.WebhookDeliveryStatus) *webhookspb.WebhookDeliveryStatus {
+	return &webhookspb.WebhookDeliveryStatus{
+		WebhookId:     deliveryStatus.WebhookID,
+		Status:        deliveryStatus.Status,
+		DeliveryError: deliveryStatus.DeliveryError,
+		Url:           deliveryStatus.URL,
+		Created:       deliveryStatus.Created,
+		Delivered:     deliveryStatus.Delivered,
+		PayloadSize:   int32(deliveryStatus.PayloadSize),
+		NumberOfTries: int32(deliveryStatus.NumberOfTries),
+	}
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"sendhooks/adapter"
+	"sendhooks/api/webhookspb"
+	"sendhooks/logging"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func newTestClient(t *testing.T, tokens ...string) (webhookspb.WebhookServiceClient, *mockAdapter) {
+	logging.WebhookLogger = func(errorType string, message interface{}) error {
+		return nil
+	}
+
+	// Without a token, the server is explicitly unauthenticated.
+	unauthenticated := ""
+	if len(tokens) == 0 {
+		unauthenticated = "true"
+	}
+
+	queueAdapter := &mockAdapter{published: make(chan adapter.WebhookDeliveryStatus)}
+	server, err := NewGrpcServer(adapter.Configuration{Grpc: adapter.GrpcConfig{GrpcAuthTokens: tokens, GrpcAllowUnauthenticated: unauthenticated}}, queueAdapter)
+	assert.NoError(t, err)
+
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	connection, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, address string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	assert.NoError(t, err)
+	t.Cleanup(func() { connection.Close() })
+
+	return webhookspb.NewWebhookServiceClient(connection), queueAdapter
+}
+
+func TestGrpcEnqueue(t *testing.T) {
+	t.Run("Webhook is queued with its data", func(t *testing.T) {
+		client, queueAdapter := newTestClient(t)
+
+		data, err := structpb.NewStruct(map[string]interface{}{"event": "created"})
+		assert.NoError(t, err)
+
+		response, err := client.Enqueue(context.Background(), &webhookspb.EnqueueRequest{
+			Webhook: &webhookspb.WebhookPayload{Url: "https://example.com/hooks", Data: data},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, response.WebhookId, 36)
+		assert.Equal(t, int64(1), response.Position)
+
+		assert.Len(t, queueAdapter.enqueued, 1)
+		assert.Equal(t, "created", queueAdapter.enqueued[0].Data["event"])
+	})
+
+	t.Run("Delayed webhook keeps its delay", func(t *testing.T) {
+		client, queueAdapter := newTestClient(t)
+
+		_, err := client.Enqueue(context.Background(), &webhookspb.EnqueueRequest{
+			Webhook: &webhookspb.WebhookPayload{Url: "https://example.com/hooks", DelaySeconds: 600, OrderingKey: "order-42"},
+		})
+		assert.NoError(t, err)
+
+		assert.Len(t, queueAdapter.enqueued, 1)
+		assert.Equal(t, 600, queueAdapter.enqueued[0].DelaySeconds)
+		assert.Equal(t, "order-42", queueAdapter.enqueued[0].OrderingKey)
+	})
+
+	t.Run("Invalid webhooks are rejected", func(t *testing.T) {
+		client, queueAdapter := newTestClient(t)
+
+		_, err := client.EnqueueBatch(context.Background(), &webhookspb.EnqueueBatchRequest{
+			Webhooks: []*webhookspb.WebhookPayload{{Url: "https://example.com/a"}, {Url: "example.com/b"}},
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		assert.Empty(t, queueAdapter.enqueued)
+	})
+
+	t.Run("Calls without a valid token are rejected", func(t *testing.T) {
+		client, _ := newTestClient(t, "secret")
+		request := &webhookspb.EnqueueRequest{Webhook: &webhookspb.WebhookPayload{Url: "https://example.com/hooks"}}
+
+		_, err := client.Enqueue(context.Background(), request)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+		_, err = client.Enqueue(ctx, request)
+		assert.NoError(t, err)
+	})
+
+	t.Run("API without a token is refused unless explicitly allowed", func(t *testing.T) {
+		_, err := NewGrpcServer(adapter.Configuration{}, &mockAdapter{})
+		assert.Error(t, err)
+
+		service := &GrpcServer{queueAdapter: &mockAdapter{}}
+		assert.Equal(t, codes.Unauthenticated, status.Code(service.checkToken(context.Background())))
+	})
+}
+
+func TestGrpcWatchStatus(t *testing.T) {
+	client, queueAdapter := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchStatus(ctx, &webhookspb.WatchStatusRequest{
+		Target: &webhookspb.WatchStatusRequest_WebhookId{WebhookId: "webhook-1"},
+	})
+	assert.NoError(t, err)
+
+	go func() {
+		for _, webhookID := range []string{"webhook-2", "webhook-1"} {
+			select {
+			case queueAdapter.published <- adapter.WebhookDeliveryStatus{WebhookID: webhookID, Status: "success"}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Only the statuses of the watched webhook are streamed.
+	deliveryStatus, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "webhook-1", deliveryStatus.WebhookId)
+	assert.Equal(t, "success", deliveryStatus.Status)
+}
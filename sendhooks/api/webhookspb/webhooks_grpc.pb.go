@@ -0,0 +1,231 @@
+// The gRPC API of sendhooks. Producers queue webhooks with Enqueue and EnqueueBatch, and follow
+// their delivery with WatchStatus.
+//
+// The Go code in sendhooks/api/webhookspb is generated from this file with:
+//
+//   protoc --proto_path=api/proto \
+//     --go_out=. --go_opt=module=sendhooks \
+//     --go-grpc_out=. --go-grpc_opt=module=sendhooks \
+//     api/proto/sendhooks/v1/webhooks.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.25.3
+// source: sendhooks/v1/webhooks.proto
+
+package webhookspb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	WebhookService_Enqueue_FullMethodName      = "/sendhooks.v1.WebhookService/Enqueue"
+	WebhookService_EnqueueBatch_FullMethodName = "/sendhooks.v1.WebhookService/EnqueueBatch"
+	WebhookService_WatchStatus_FullMethodName  = "/sendhooks.v1.WebhookService/WatchStatus"
+)
+
+// WebhookServiceClient is the client API for WebhookService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type WebhookServiceClient interface {
+	// Enqueue validates a webhook and queues it in the configured broker. A webhook ID is assigned
+	// when it's missing.
+	Enqueue(ctx context.Context, in *EnqueueRequest, opts ...grpc.CallOption) (*EnqueueResponse, error)
+	// EnqueueBatch validates all the webhooks before queueing any of them.
+	EnqueueBatch(ctx context.Context, in *EnqueueBatchRequest, opts ...grpc.CallOption) (*EnqueueBatchResponse, error)
+	// WatchStatus streams the status updates published after the call for a webhook ID or a URL.
+	// Open the stream before queueing the webhook to receive all its updates.
+	WatchStatus(ctx context.Context, in *WatchStatusRequest, opts ...grpc.CallOption) (WebhookService_WatchStatusClient, error)
+}
+
+type webhookServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewWebhookServiceClient(cc grpc.ClientConnInterface) WebhookServiceClient {
+	return &webhookServiceClient{cc}
+}
+
+func (c *webhookServiceClient) Enqueue(ctx context.Context, in *EnqueueRequest, opts ...grpc.CallOption) (*EnqueueResponse, error) {
+	out := new(EnqueueResponse)
+	err := c.cc.Invoke(ctx, WebhookService_Enqueue_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *webhookServiceClient) EnqueueBatch(ctx context.Context, in *EnqueueBatchRequest, opts ...grpc.CallOption) (*EnqueueBatchResponse, error) {
+	out := new(EnqueueBatchResponse)
+	err := c.cc.Invoke(ctx, WebhookService_EnqueueBatch_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *webhookServiceClient) WatchStatus(ctx context.Context, in *WatchStatusRequest, opts ...grpc.CallOption) (WebhookService_WatchStatusClient, error) {
+	stream, err := c.cc.NewStream(ctx, &WebhookService_ServiceDesc.Streams[0], WebhookService_WatchStatus_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &webhookServiceWatchStatusClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type WebhookService_WatchStatusClient interface {
+	Recv() (*WebhookDeliveryStatus, error)
+	grpc.ClientStream
+}
+
+type webhookServiceWatchStatusClient struct {
+	grpc.ClientStream
+}
+
+func (x *webhookServiceWatchStatusClient) Recv() (*WebhookDeliveryStatus, error) {
+	m := new(WebhookDeliveryStatus)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WebhookServiceServer is the server API for WebhookService service.
+// All implementations must embed UnimplementedWebhookServiceServer
+// for forward compatibility
+type WebhookServiceServer interface {
+	// Enqueue validates a webhook and queues it in the configured broker. A webhook ID is assigned
+	// when it's missing.
+	Enqueue(context.Context, *EnqueueRequest) (*EnqueueResponse, error)
+	// EnqueueBatch validates all the webhooks before queueing any of them.
+	EnqueueBatch(context.Context, *EnqueueBatchRequest) (*EnqueueBatchResponse, error)
+	// WatchStatus streams the status updates published after the call for a webhook ID or a URL.
+	// Open the stream before queueing the webhook to receive all its updates.
+	WatchStatus(*WatchStatusRequest, WebhookService_WatchStatusServer) error
+	mustEmbedUnimplementedWebhookServiceServer()
+}
+
+// UnimplementedWebhookServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedWebhookServiceServer struct {
+}
+
+func (UnimplementedWebhookServiceServer) Enqueue(context.Context, *EnqueueRequest) (*EnqueueResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Enqueue not implemented")
+}
+func (UnimplementedWebhookServiceServer) EnqueueBatch(context.Context, *EnqueueBatchRequest) (*EnqueueBatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EnqueueBatch not implemented")
+}
+func (UnimplementedWebhookServiceServer) WatchStatus(*WatchStatusRequest, WebhookService_WatchStatusServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchStatus not implemented")
+}
+func (UnimplementedWebhookServiceServer) mustEmbedUnimplementedWebhookServiceServer() {}
+
+// UnsafeWebhookServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to WebhookServiceServer will
+// result in compilation errors.
+type UnsafeWebhookServiceServer interface {
+	mustEmbedUnimplementedWebhookServiceServer()
+}
+
+func RegisterWebhookServiceServer(s grpc.ServiceRegistrar, srv WebhookServiceServer) {
+	s.RegisterService(&WebhookService_ServiceDesc, srv)
+}
+
+func _WebhookService_Enqueue_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EnqueueRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WebhookServiceServer).Enqueue(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WebhookService_Enqueue_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WebhookServiceServer).Enqueue(ctx, req.(*EnqueueRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WebhookService_EnqueueBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EnqueueBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WebhookServiceServer).EnqueueBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WebhookService_EnqueueBatch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WebhookServiceServer).EnqueueBatch(ctx, req.(*EnqueueBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WebhookService_WatchStatus_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchStatusRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WebhookServiceServer).WatchStatus(m, &webhookServiceWatchStatusServer{stream})
+}
+
+type WebhookService_WatchStatusServer interface {
+	Send(*WebhookDeliveryStatus) error
+	grpc.ServerStream
+}
+
+type webhookServiceWatchStatusServer struct {
+	grpc.ServerStream
+}
+
+func (x *webhookServiceWatchStatusServer) Send(m *WebhookDeliveryStatus) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// WebhookService_ServiceDesc is the grpc.ServiceDesc for WebhookService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var WebhookService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sendhooks.v1.WebhookService",
+	HandlerType: (*WebhookServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Enqueue",
+			Handler:    _WebhookService_Enqueue_Handler,
+		},
+		{
+			MethodName: "EnqueueBatch",
+			Handler:    _WebhookService_EnqueueBatch_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchStatus",
+			Handler:       _WebhookService_WatchStatus_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "sendhooks/v1/webhooks.proto",
+}
@@ -0,0 +1,92 @@
+package cancellation
+
+/*
+This package cancels the webhooks of the brokers which can't look up a message by its webhook ID. The
+webhooks are tracked when they are enqueued or scheduled for a retry, until they are acknowledged, so a
+cancellation can tell the pending webhooks from the unknown ones. The cancelled webhook IDs are checked
+by the workers before every attempt. Both are kept in memory, or in Redis to share them between the
+instances.
+*/
+
+import (
+	"context"
+	"io"
+
+	"sendhooks/adapter"
+	"sendhooks/utils"
+)
+
+// Store keeps the pending and the cancelled webhooks for the retention.
+type Store interface {
+	// Track remembers the URL of a pending webhook.
+	Track(ctx context.Context, webhookID, url string) error
+	// Forget forgets a webhook which isn't pending anymore. Its cancellation is kept.
+	Forget(ctx context.Context, webhookID string) error
+	// Cancel marks a pending webhook as cancelled and returns its URL. It returns false when the
+	// webhook isn't pending.
+	Cancel(ctx context.Context, webhookID string) (string, bool, error)
+	Cancelled(ctx context.Context, webhookID string) (bool, error)
+}
+
+// Registry tracks the pending webhooks of a broker and cancels them.
+type Registry struct {
+	store Store
+}
+
+// NewRegistry creates the registry of the configuration, with the configured store. The Redis keys
+// start with the prefix, which tells the queues apart.
+func NewRegistry(config adapter.Configuration, prefix string) (*Registry, error) {
+	if config.CancelStore != "redis" {
+		return NewRegistryWithStore(NewMemoryStore()), nil
+	}
+
+	client, err := utils.NewRedisClient(config.Redis, config.NumWorkers)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRegistryWithStore(NewRedisStore(client, prefix)), nil
+}
+
+// NewRegistryWithStore creates a registry keeping the webhooks in the store.
+func NewRegistryWithStore(store Store) *Registry {
+	return &Registry{store: store}
+}
+
+// Track remembers the webhook until it's acknowledged.
+func (r *Registry) Track(ctx context.Context, payload adapter.WebhookPayload) error {
+	return r.store.Track(ctx, payload.WebhookID, payload.URL)
+}
+
+// Forget forgets an acknowledged webhook, which can't be cancelled anymore.
+func (r *Registry) Forget(ctx context.Context, webhookID string) error {
+	return r.store.Forget(ctx, webhookID)
+}
+
+// Cancel marks a pending webhook as cancelled and returns its URL, or adapter.ErrWebhookNotFound.
+func (r *Registry) Cancel(ctx context.Context, webhookID string) (string, error) {
+	url, found, err := r.store.Cancel(ctx, webhookID)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", adapter.ErrWebhookNotFound
+	}
+	return url, nil
+}
+
+// Cancelled tells if the webhook was cancelled.
+func (r *Registry) Cancelled(ctx context.Context, webhookID string) (bool, error) {
+	return r.store.Cancelled(ctx, webhookID)
+}
+
+// Close closes the connection of the store, if it has one.
+func (r *Registry) Close() error {
+	if r == nil {
+		return nil
+	}
+	if closer, ok := r.store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package cancellation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"sendhooks/adapter"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+// testRegistry checks that only the pending webhooks are cancelled.
+func testRegistry(t *testing.T, store Store) {
+	ctx := context.Background()
+	registry := NewRegistryWithStore(store)
+
+	_, err := registry.Cancel(ctx, "webhook-1")
+	assert.ErrorIs(t, err, adapter.ErrWebhookNotFound)
+
+	assert.NoError(t, registry.Track(ctx, adapter.WebhookPayload{WebhookID: "webhook-1", URL: "http://example.com/1"}))
+	assert.NoError(t, registry.Track(ctx, adapter.WebhookPayload{WebhookID: "webhook-2", URL: "http://example.com/2"}))
+
+	url, err := registry.Cancel(ctx, "webhook-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com/1", url)
+
+	cancelled, err := registry.Cancelled(ctx, "webhook-1")
+	assert.NoError(t, err)
+	assert.True(t, cancelled)
+	cancelled, err = registry.Cancelled(ctx, "webhook-2")
+	assert.NoError(t, err)
+	assert.False(t, cancelled)
+
+	// An acknowledged webhook can't be cancelled anymore.
+	assert.NoError(t, registry.Forget(ctx, "webhook-2"))
+	_, err = registry.Cancel(ctx, "webhook-2")
+	assert.ErrorIs(t, err, adapter.ErrWebhookNotFound)
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	testRegistry(t, store)
+
+	// The cancellation is forgotten after the retention.
+	now := time.Now()
+	store.now = func() time.Time { return now.Add(adapter.CancelRetention + time.Minute) }
+	cancelled, err := store.Cancelled(context.Background(), "webhook-1")
+	assert.NoError(t, err)
+	assert.False(t, cancelled)
+}
+
+func TestRedisStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), "sendhooks:cancel:hooks:")
+	testRegistry(t, store)
+
+	// The cancellation is forgotten after the retention.
+	server.FastForward(adapter.CancelRetention)
+	cancelled, err := store.Cancelled(context.Background(), "webhook-1")
+	assert.NoError(t, err)
+	assert.False(t, cancelled)
+	assert.NoError(t, store.Close())
+}
@@ -0,0 +1,151 @@
+package cancellation
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"sendhooks/adapter"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// sweepInterval is how often the memory store forgets the expired webhooks.
+const sweepInterval = time.Minute
+
+type entry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// MemoryStore keeps the webhooks of a single instance.
+type MemoryStore struct {
+	mu        sync.Mutex
+	pending   map[string]entry
+	cancelled map[string]entry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{pending: map[string]entry{}, cancelled: map[string]entry{}, now: time.Now}
+}
+
+// sweep forgets the expired webhooks, so the memory doesn't grow with the webhooks that are never
+// acknowledged.
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+
+	for _, entries := range []map[string]entry{m.pending, m.cancelled} {
+		for id, e := range entries {
+			if !now.Before(e.expiresAt) {
+				delete(entries, id)
+			}
+		}
+	}
+	m.lastSweep = now
+}
+
+func (m *MemoryStore) Track(ctx context.Context, webhookID, url string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+	m.pending[webhookID] = entry{value: url, expiresAt: now.Add(adapter.CancelRetention)}
+	return nil
+}
+
+func (m *MemoryStore) Forget(ctx context.Context, webhookID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.pending, webhookID)
+	return nil
+}
+
+func (m *MemoryStore) Cancel(ctx context.Context, webhookID string) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	pending, ok := m.pending[webhookID]
+	if !ok || !now.Before(pending.expiresAt) {
+		return "", false, nil
+	}
+
+	m.cancelled[webhookID] = entry{expiresAt: now.Add(adapter.CancelRetention)}
+	return pending.value, true, nil
+}
+
+func (m *MemoryStore) Cancelled(ctx context.Context, webhookID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cancelled, ok := m.cancelled[webhookID]
+	return ok && m.now().Before(cancelled.expiresAt), nil
+}
+
+// cancelScript cancels a pending webhook atomically, and returns its URL.
+var cancelScript = redis.NewScript(`
+local url = redis.call('GET', KEYS[1])
+if not url then
+	return false
+end
+
+redis.call('SET', KEYS[2], '1', 'PX', ARGV[1])
+return url
+`)
+
+// RedisStore keeps the webhooks in Redis, shared by all the instances.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore creates a store keeping the webhooks in keys starting with the prefix.
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (r *RedisStore) pendingKey(webhookID string) string {
+	return r.prefix + "pending:" + webhookID
+}
+
+func (r *RedisStore) cancelledKey(webhookID string) string {
+	return r.prefix + "cancelled:" + webhookID
+}
+
+func (r *RedisStore) Track(ctx context.Context, webhookID, url string) error {
+	return r.client.Set(ctx, r.pendingKey(webhookID), url, adapter.CancelRetention).Err()
+}
+
+func (r *RedisStore) Forget(ctx context.Context, webhookID string) error {
+	return r.client.Del(ctx, r.pendingKey(webhookID)).Err()
+}
+
+func (r *RedisStore) Cancel(ctx context.Context, webhookID string) (string, bool, error) {
+	keys := []string{r.pendingKey(webhookID), r.cancelledKey(webhookID)}
+	url, err := cancelScript.Run(ctx, r.client, keys, adapter.CancelRetention.Milliseconds()).Text()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return url, true, nil
+}
+
+func (r *RedisStore) Cancelled(ctx context.Context, webhookID string) (bool, error) {
+	count, err := r.client.Exists(ctx, r.cancelledKey(webhookID)).Result()
+	return count > 0, err
+}
+
+// Close closes the Redis client of the store.
+func (r *RedisStore) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,208 @@
+package client
+
+/*
+This package lets Go producers enqueue webhooks straight into the broker of the engine. It goes through the adapter
+of the configured broker, so the payloads are serialised and routed exactly as the engine reads them, and it can
+watch the delivery statuses of a webhook.
+
+The local broker keeps its queue in a file locked by the engine, so producers use the HTTP API with it instead.
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"sendhooks/adapter"
+	"sendhooks/adapter/adapter_manager"
+	"sendhooks/utils"
+)
+
+// Webhook is a webhook to enqueue.
+type Webhook struct {
+	URL      string
+	Data     map[string]interface{}
+	MetaData map[string]interface{}
+	// SecretHash is sent as it is in the legacy signing mode.
+	SecretHash string
+	// WebhookID defaults to the ID of the idempotency key, or to a random ID.
+	WebhookID string
+	// IdempotencyKey identifies the webhook across enqueue retries: the same key gives the same
+	// webhook ID, so the receivers see a single webhook.
+	IdempotencyKey string
+	// DeliverAt delays the delivery until this time.
+	DeliverAt time.Time
+	// Delay delays the delivery from the enqueue time. It's ignored when DeliverAt is set.
+	Delay time.Duration
+	// OrderingKey delivers the webhooks sharing it one at a time, in the order they are enqueued.
+	OrderingKey string
+	// RetryPolicy is the name of a retry policy of the configuration.
+	RetryPolicy string
+	// ExpiresAt stops the delivery at this time: an undelivered webhook isn't retried past it.
+	ExpiresAt time.Time
+	// Priority is adapter.PriorityHigh, adapter.PriorityNormal or adapter.PriorityLow. It defaults
+	// to normal.
+	Priority string
+}
+
+// Enqueued is a webhook accepted by the broker.
+type Enqueued struct {
+	WebhookID string
+	// Position is the number of webhooks waiting in the queue, or -1 when the broker doesn't
+	// tell it.
+	Position int64
+}
+
+// Client enqueues webhooks and watches their statuses. It must be closed once done.
+type Client struct {
+	broker   string
+	enqueuer adapter.Enqueuer
+	watcher  adapter.StatusWatcher
+	closer   io.Closer
+}
+
+// New connects to the broker of the configuration, which is the one of the engine.
+func New(config adapter.Configuration) (*Client, error) {
+	if config.Broker == "local" {
+		return nil, errors.New("the local broker is only reachable through the HTTP API")
+	}
+
+	queueAdapter, err := adapter_manager.NewAdapter(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := queueAdapter.Connect(); err != nil {
+		return nil, fmt.Errorf("error connecting to the %s broker: %w", config.Broker, err)
+	}
+
+	closer, _ := queueAdapter.(io.Closer)
+
+	enqueuer, ok := queueAdapter.(adapter.Enqueuer)
+	if !ok {
+		if closer != nil {
+			closer.Close()
+		}
+		return nil, fmt.Errorf("the %s broker does not support enqueueing", config.Broker)
+	}
+
+	watcher, _ := queueAdapter.(adapter.StatusWatcher)
+
+	return &Client{broker: config.Broker, enqueuer: enqueuer, watcher: watcher, closer: closer}, nil
+}
+
+// Close closes the connections of the client to the broker.
+func (c *Client) Close() error {
+	if c.closer == nil {
+		return nil
+	}
+	return c.closer.Close()
+}
+
+// Enqueue validates a webhook and queues it.
+func (c *Client) Enqueue(ctx context.Context, webhook Webhook) (Enqueued, error) {
+	payload, err := c.payload(webhook)
+	if err != nil {
+		return Enqueued{}, err
+	}
+
+	position, err := c.enqueuer.Enqueue(ctx, payload)
+	if err != nil {
+		return Enqueued{}, err
+	}
+
+	return Enqueued{WebhookID: payload.WebhookID, Position: position}, nil
+}
+
+// payload converts a webhook to the payload read by the engine.
+func (c *Client) payload(webhook Webhook) (adapter.WebhookPayload, error) {
+	target, err := url.Parse(webhook.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return adapter.WebhookPayload{}, errors.New("url must be an absolute http or https URL")
+	}
+
+	switch webhook.Priority {
+	case "", adapter.PriorityHigh, adapter.PriorityNormal, adapter.PriorityLow:
+	default:
+		return adapter.WebhookPayload{}, errors.New("priority must be high, normal or low")
+	}
+
+	payload := adapter.WebhookPayload{
+		URL:            webhook.URL,
+		WebhookID:      webhook.WebhookID,
+		Data:           webhook.Data,
+		SecretHash:     webhook.SecretHash,
+		MetaData:       webhook.MetaData,
+		IdempotencyKey: webhook.IdempotencyKey,
+		OrderingKey:    webhook.OrderingKey,
+		RetryPolicy:    webhook.RetryPolicy,
+		Priority:       webhook.Priority,
+	}
+
+	if payload.WebhookID == "" && payload.IdempotencyKey != "" {
+		payload.WebhookID = utils.WebhookIDForKey(payload.IdempotencyKey)
+	}
+
+	if payload.WebhookID == "" {
+		payload.WebhookID, err = utils.NewWebhookID()
+		if err != nil {
+			return adapter.WebhookPayload{}, err
+		}
+	}
+
+	payload.EnqueueID, err = utils.NewWebhookID()
+	if err != nil {
+		return adapter.WebhookPayload{}, err
+	}
+
+	deliverAt := webhook.DeliverAt
+	if deliverAt.IsZero() && webhook.Delay > 0 {
+		deliverAt = time.Now().Add(webhook.Delay)
+	}
+	if !deliverAt.IsZero() {
+		payload.DeliverAt = deliverAt.UTC().Format(time.RFC3339)
+	}
+
+	if !webhook.ExpiresAt.IsZero() {
+		payload.ExpiresAt = webhook.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+
+	return payload, nil
+}
+
+// WatchStatus sends the statuses of a webhook until the context is cancelled. Only the statuses
+// published after the call are sent.
+func (c *Client) WatchStatus(ctx context.Context, webhookID string, statuses chan<- adapter.WebhookDeliveryStatus) error {
+	if c.watcher == nil {
+		return fmt.Errorf("the %s broker does not support watching statuses", c.broker)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	all := make(chan adapter.WebhookDeliveryStatus)
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- c.watcher.WatchStatuses(ctx, all)
+	}()
+
+	for {
+		select {
+		case status := <-all:
+			if status.WebhookID != webhookID {
+				continue
+			}
+
+			select {
+			case statuses <- status:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case err := <-watchErr:
+			return err
+		}
+	}
+}
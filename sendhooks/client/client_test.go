@@ -0,0 +1,119 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"sendhooks/adapter"
+	redisadapter "sendhooks/adapter/redis_adapter"
+	"sendhooks/logging"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClient(t *testing.T) (*Client, *miniredis.Miniredis, adapter.Configuration) {
+	logging.WebhookLogger = func(errorType string, message interface{}) error {
+		return nil
+	}
+
+	server := miniredis.RunT(t)
+	config := adapter.Configuration{
+		Broker: "redis",
+		Redis: adapter.RedisConfig{
+			RedisAddress:          server.Addr(),
+			RedisStreamName:       "hooks",
+			RedisStreamStatusName: "hooks-status",
+		},
+	}
+
+	client, err := New(config)
+	assert.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, client.Close()) })
+
+	return client, server, config
+}
+
+func TestEnqueue(t *testing.T) {
+	client, server, _ := newTestClient(t)
+	ctx := context.Background()
+
+	deliverAt := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	enqueued, err := client.Enqueue(ctx, Webhook{
+		URL:            "https://example.com/hooks",
+		Data:           map[string]interface{}{"event": "created"},
+		IdempotencyKey: "order-42",
+		DeliverAt:      deliverAt,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1), enqueued.Position)
+
+	// The payload is written with the field names read by the engine, in the retry set until it's
+	// due.
+	members, err := server.ZMembers("hooks:retries")
+	assert.NoError(t, err)
+	assert.Len(t, members, 1)
+
+	var payload adapter.WebhookPayload
+	assert.NoError(t, json.Unmarshal([]byte(members[0]), &payload))
+	assert.Equal(t, "https://example.com/hooks", payload.URL)
+	assert.Equal(t, enqueued.WebhookID, payload.WebhookID)
+	assert.Equal(t, "order-42", payload.IdempotencyKey)
+	assert.Equal(t, "2030-01-01T12:00:00Z", payload.DeliverAt)
+	assert.NotEmpty(t, payload.EnqueueID)
+
+	// The same idempotency key gives the same webhook ID.
+	again, err := client.Enqueue(ctx, Webhook{URL: "https://example.com/hooks", IdempotencyKey: "order-42"})
+	assert.NoError(t, err)
+	assert.Equal(t, enqueued.WebhookID, again.WebhookID)
+	assert.Equal(t, int64(1), again.Position)
+
+	_, err = client.Enqueue(ctx, Webhook{URL: "example.com/hooks"})
+	assert.Error(t, err)
+}
+
+func TestWatchStatus(t *testing.T) {
+	client, _, config := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	statuses := make(chan adapter.WebhookDeliveryStatus)
+	go client.WatchStatus(ctx, "webhook-1", statuses)
+
+	// The statuses are published until the watcher starts reading them.
+	engine := redisadapter.NewRedisAdapter(config)
+	assert.NoError(t, engine.Connect())
+	go func() {
+		for ctx.Err() == nil {
+			engine.PublishStatus(ctx, "webhook-2", "https://example.com/hooks", "", "", "success", "", 0, 1)
+			engine.PublishStatus(ctx, "webhook-1", "https://example.com/hooks", "", "", "retrying", "failed", 0, 1)
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	select {
+	case status := <-statuses:
+		assert.Equal(t, "webhook-1", status.WebhookID)
+		assert.Equal(t, "retrying", status.Status)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no status received")
+	}
+}
+
+func TestClose(t *testing.T) {
+	_, _, config := newTestClient(t)
+	client, err := New(config)
+	assert.NoError(t, err)
+	assert.NoError(t, client.Close())
+
+	// The connections are closed, so the client can't enqueue anymore.
+	_, err = client.Enqueue(context.Background(), Webhook{URL: "https://example.com/hooks"})
+	assert.Error(t, err)
+}
+
+func TestLocalBroker(t *testing.T) {
+	_, err := New(adapter.Configuration{Broker: "local"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"sendhooks/adapter"
+)
+
+// runCommand runs an administration command instead of starting the engine.
+func runCommand(ctx context.Context, queueAdapter adapter.Adapter, args []string) error {
+	switch args[0] {
+	case "dlq":
+		return runDeadLetterCommand(ctx, queueAdapter, args[1:])
+	case "cancel":
+		return runCancelCommand(ctx, queueAdapter, args[1:])
+	default:
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+}
+
+// runDeadLetterCommand lists, inspects, redrives or purges the dead letters.
+//
+//	sendhooks dlq list [-url URL] [-webhook-id ID] [-from RFC3339] [-to RFC3339]
+//	sendhooks dlq inspect ID
+//	sendhooks dlq redrive [-id ID] [-url URL] [-webhook-id ID] [-from RFC3339] [-to RFC3339]
+//	sendhooks dlq purge [-id ID] [-url URL] [-webhook-id ID] [-from RFC3339] [-to RFC3339]
+func runDeadLetterCommand(ctx context.Context, queueAdapter adapter.Adapter, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: sendhooks dlq <list|inspect|redrive|purge> [flags]")
+	}
+
+	deadLetterQueue, ok := queueAdapter.(adapter.DeadLetterQueue)
+	if !ok {
+		return errors.New("the configured broker doesn't support dead-letter inspection")
+	}
+
+	action := args[0]
+	if action == "inspect" {
+		if len(args) != 2 {
+			return errors.New("usage: sendhooks dlq inspect ID")
+		}
+
+		deadLetter, err := deadLetterQueue.GetDeadLetter(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		return printJSON(deadLetter)
+	}
+
+	filter, err := parseDeadLetterFilter(action, args[1:])
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "list":
+		deadLetters, err := deadLetterQueue.ListDeadLetters(ctx, filter)
+		if err != nil {
+			return err
+		}
+		return printJSON(deadLetters)
+	case "redrive":
+		redriven, err := deadLetterQueue.RedriveDeadLetters(ctx, filter)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d dead letters redriven\n", redriven)
+	case "purge":
+		purged, err := deadLetterQueue.PurgeDeadLetters(ctx, filter)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d dead letters purged\n", purged)
+	default:
+		return fmt.Errorf("unknown dlq action: %s", action)
+	}
+
+	return nil
+}
+
+// runCancelCommand stops the delivery of a webhook.
+//
+//	sendhooks cancel WEBHOOK_ID
+func runCancelCommand(ctx context.Context, queueAdapter adapter.Adapter, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: sendhooks cancel WEBHOOK_ID")
+	}
+
+	err := adapter.Cancel(ctx, queueAdapter, args[0])
+	if errors.Is(err, adapter.ErrCancelNotSupported) {
+		return errors.New("the configured broker doesn't support cancellation")
+	}
+	if errors.Is(err, adapter.ErrWebhookNotFound) {
+		return fmt.Errorf("webhook %s is not waiting for delivery", args[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("webhook %s cancelled\n", args[0])
+	return nil
+}
+
+func parseDeadLetterFilter(action string, args []string) (adapter.DeadLetterFilter, error) {
+	var filter adapter.DeadLetterFilter
+	var from, to string
+
+	flags := flag.NewFlagSet("dlq "+action, flag.ContinueOnError)
+	flags.StringVar(&filter.ID, "id", "", "dead letter ID")
+	flags.StringVar(&filter.URL, "url", "", "webhook URL")
+	flags.StringVar(&filter.WebhookID, "webhook-id", "", "webhook ID")
+	flags.StringVar(&from, "from", "", "oldest failure time (RFC3339)")
+	flags.StringVar(&to, "to", "", "newest failure time (RFC3339)")
+
+	if err := flags.Parse(args); err != nil {
+		return filter, err
+	}
+
+	var err error
+	if from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return filter, fmt.Errorf("invalid -from value: %w", err)
+		}
+	}
+	if to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return filter, fmt.Errorf("invalid -to value: %w", err)
+		}
+	}
+
+	return filter, nil
+}
+
+func printJSON(value interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
@@ -0,0 +1,66 @@
+package dedupe
+
+/*
+This package suppresses the webhooks enqueued twice, typically by producers retrying after a timeout. The first message
+read with an idempotency key claims it for the deduplication window, and the other messages with the key are
+duplicates. The claims are kept in memory, or in Redis to share them between the instances.
+*/
+
+import (
+	"context"
+	"time"
+
+	"sendhooks/adapter"
+	"sendhooks/utils"
+)
+
+// Store keeps the claims of the idempotency keys.
+type Store interface {
+	// Claim claims the key for the owner during the window, unless it's already claimed. It
+	// returns the owner of the key, which is the given owner when the claim succeeded.
+	Claim(ctx context.Context, key, owner string, window time.Duration) (string, error)
+}
+
+// Deduplicator tells the duplicates of the webhooks apart.
+type Deduplicator struct {
+	store  Store
+	window time.Duration
+}
+
+// NewDeduplicator creates the deduplicator of the configuration, with the configured store. It
+// returns nil when the deduplication is disabled.
+func NewDeduplicator(config adapter.Configuration) (*Deduplicator, error) {
+	settings := config.Deduplication
+	if settings.DeduplicationWindow <= 0 {
+		return nil, nil
+	}
+
+	window := time.Duration(settings.DeduplicationWindow) * time.Second
+	if settings.DeduplicationStore != "redis" {
+		return NewDeduplicatorWithStore(NewMemoryStore(), window), nil
+	}
+
+	client, err := utils.NewRedisClient(config.Redis, config.NumWorkers)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDeduplicatorWithStore(NewRedisStore(client, "sendhooks:dedupe:"), window), nil
+}
+
+// NewDeduplicatorWithStore creates a deduplicator keeping its claims in the store.
+func NewDeduplicatorWithStore(store Store, window time.Duration) *Deduplicator {
+	return &Deduplicator{store: store, window: window}
+}
+
+// Duplicate tells if another message already claimed the idempotency key of the webhook. A message
+// read again by the broker, with the same enqueue ID or message ID, is not a duplicate of itself.
+func (d *Deduplicator) Duplicate(ctx context.Context, payload adapter.WebhookPayload) (bool, error) {
+	claimant := payload.EnqueueIDOrMessageID()
+	owner, err := d.store.Claim(ctx, payload.IdempotencyKeyOrID(), claimant, d.window)
+	if err != nil {
+		return false, err
+	}
+
+	return owner != claimant, nil
+}
@@ -0,0 +1,86 @@
+package dedupe
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"sendhooks/adapter"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+// testDeduplicator checks that only the first message with an idempotency key is delivered.
+func testDeduplicator(t *testing.T, store Store) {
+	ctx := context.Background()
+	deduplicator := NewDeduplicatorWithStore(store, time.Minute)
+
+	first := adapter.WebhookPayload{WebhookID: "webhook-1", MessageID: "1-0"}
+	duplicate, err := deduplicator.Duplicate(ctx, first)
+	assert.NoError(t, err)
+	assert.False(t, duplicate)
+
+	// The same message read again is not a duplicate.
+	duplicate, err = deduplicator.Duplicate(ctx, first)
+	assert.NoError(t, err)
+	assert.False(t, duplicate)
+
+	duplicate, err = deduplicator.Duplicate(ctx, adapter.WebhookPayload{WebhookID: "webhook-1", MessageID: "2-0"})
+	assert.NoError(t, err)
+	assert.True(t, duplicate)
+
+	// The idempotency key is checked instead of the webhook ID.
+	duplicate, err = deduplicator.Duplicate(ctx, adapter.WebhookPayload{WebhookID: "webhook-2", IdempotencyKey: "order-42", MessageID: "3-0"})
+	assert.NoError(t, err)
+	assert.False(t, duplicate)
+	duplicate, err = deduplicator.Duplicate(ctx, adapter.WebhookPayload{WebhookID: "webhook-3", IdempotencyKey: "order-42", MessageID: "4-0"})
+	assert.NoError(t, err)
+	assert.True(t, duplicate)
+
+	// A message redelivered with a new message ID keeps its enqueue ID, it's not a duplicate of
+	// itself.
+	enqueued := adapter.WebhookPayload{WebhookID: "webhook-4", EnqueueID: "enqueue-1", MessageID: "1-1"}
+	duplicate, err = deduplicator.Duplicate(ctx, enqueued)
+	assert.NoError(t, err)
+	assert.False(t, duplicate)
+	enqueued.MessageID = "2-1"
+	duplicate, err = deduplicator.Duplicate(ctx, enqueued)
+	assert.NoError(t, err)
+	assert.False(t, duplicate)
+
+	duplicate, err = deduplicator.Duplicate(ctx, adapter.WebhookPayload{WebhookID: "webhook-4", EnqueueID: "enqueue-2", MessageID: "1-1"})
+	assert.NoError(t, err)
+	assert.True(t, duplicate)
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	testDeduplicator(t, store)
+
+	// A claim expires after the window.
+	now := time.Now()
+	store.now = func() time.Time { return now.Add(2 * time.Minute) }
+	owner, err := store.Claim(context.Background(), "webhook-1", "5-0", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "5-0", owner)
+}
+
+func TestRedisStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), "sendhooks:dedupe:")
+	testDeduplicator(t, store)
+
+	// A claim expires after the window.
+	server.FastForward(2 * time.Minute)
+	owner, err := store.Claim(context.Background(), "webhook-1", "5-0", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "5-0", owner)
+}
+
+func TestNewDeduplicator(t *testing.T) {
+	deduplicator, err := NewDeduplicator(adapter.Configuration{})
+	assert.NoError(t, err)
+	assert.Nil(t, deduplicator)
+}
@@ -0,0 +1,76 @@
+package dedupe
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type claim struct {
+	owner     string
+	expiresAt time.Time
+}
+
+// MemoryStore keeps the claims of a single instance.
+type MemoryStore struct {
+	mu        sync.Mutex
+	claims    map[string]claim
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{claims: map[string]claim{}, now: time.Now}
+}
+
+func (m *MemoryStore) Claim(ctx context.Context, key, owner string, window time.Duration) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+
+	// The expired claims are swept once per window, so the memory doesn't grow with the keys.
+	if now.Sub(m.lastSweep) >= window {
+		for k, c := range m.claims {
+			if !now.Before(c.expiresAt) {
+				delete(m.claims, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	if c, ok := m.claims[key]; ok && now.Before(c.expiresAt) {
+		return c.owner, nil
+	}
+
+	m.claims[key] = claim{owner: owner, expiresAt: now.Add(window)}
+	return owner, nil
+}
+
+// claimScript claims a key atomically, or returns its owner.
+var claimScript = redis.NewScript(`
+local owner = redis.call('GET', KEYS[1])
+if owner then
+	return owner
+end
+
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return ARGV[1]
+`)
+
+// RedisStore keeps the claims in Redis, shared by all the instances.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore creates a store keeping the claims in keys starting with the prefix.
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (r *RedisStore) Claim(ctx context.Context, key, owner string, window time.Duration) (string, error) {
+	return claimScript.Run(ctx, r.client, []string{r.prefix + key}, owner, window.Milliseconds()).Text()
+}
@@ -21,13 +21,11 @@ var (
 	logFile     *os.File
 	logFileName string
 	logMutex    sync.Mutex
+	// setupOnce opens the log file on the first message, so that importing the package, for
+	// example through the client package, doesn't create a log file.
+	setupOnce sync.Once
 )
 
-func init() {
-	setupLogFile()
-	go rotateLogFileDaily()
-}
-
 // setupLogFile initializes the log file.
 func setupLogFile() {
 	var err error
@@ -80,6 +78,11 @@ var WebhookLogger = func(errorType string, message interface{}) error {
 	logMutex.Lock()
 	defer logMutex.Unlock()
 
+	setupOnce.Do(func() {
+		setupLogFile()
+		go rotateLogFileDaily()
+	})
+
 	// Log the entry
 	entry := logger.WithFields(logrus.Fields{
 		"date": currentDateTime(),
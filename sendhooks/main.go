@@ -5,13 +5,17 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
+	"os"
 	"runtime"
 	"sync"
 
 	"sendhooks/adapter"
 	"sendhooks/adapter/adapter_manager"
-	redisadapter "sendhooks/adapter/redis_adapter"
+	"sendhooks/api"
 	"sendhooks/logging"
+	"sendhooks/queue"
+	"sendhooks/sender"
 )
 
 func main() {
@@ -21,34 +25,83 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	err := logging.WebhookLogger(logging.EventType, "starting sendhooks engine")
-	if err != nil {
-		log.Fatalf("Failed to log sendhooks event: %v", err)
+	conf := adapter_manager.GetConfig()
+
+	// An invalid signing key would fail every delivery, so the keys are checked before starting.
+	if err := sender.ValidateSigningKeys(conf); err != nil {
+		log.Fatalf("Invalid signing keys: %v", err)
 	}
 
-	var queueAdapter adapter.Adapter
-	conf := adapter_manager.GetConfig()
+	if err := queue.ValidateRetryPolicies(conf); err != nil {
+		log.Fatalf("Invalid retry policies: %v", err)
+	}
 
-	if conf.Broker == "redis" {
-		queueAdapter = redisadapter.NewRedisAdapter(conf)
+	queueAdapter, err := adapter_manager.NewAdapter(conf)
+	if err != nil {
+		log.Fatalf("Failed to create the broker adapter: %v", err)
 	}
 
 	err = queueAdapter.Connect()
 	if err != nil {
-		log.Fatalf("Failed to connect to Redis: %v", err)
+		log.Fatalf("Failed to connect to broker: %v", err)
+	}
+
+	if len(os.Args) > 1 {
+		if err := runCommand(ctx, queueAdapter, os.Args[1:]); err != nil {
+			log.Fatalf("Command failed: %v", err)
+		}
+		return
+	}
+
+	err = logging.WebhookLogger(logging.EventType, "starting sendhooks engine")
+	if err != nil {
+		log.Fatalf("Failed to log sendhooks event: %v", err)
+	}
+
+	if conf.Http.HttpListenAddress != "" {
+		server, err := api.NewServer(conf, queueAdapter)
+		if err != nil {
+			log.Fatalf("Failed to create the HTTP API: %v", err)
+		}
+
+		go func() {
+			if err := server.ListenAndServe(); err != nil {
+				log.Fatalf("Failed to start the HTTP API: %v", err)
+			}
+		}()
+	}
+
+	if conf.Grpc.GrpcListenAddress != "" {
+		listener, err := net.Listen("tcp", conf.Grpc.GrpcListenAddress)
+		if err != nil {
+			log.Fatalf("Failed to listen for the gRPC API: %v", err)
+		}
+
+		server, err := api.NewGrpcServer(conf, queueAdapter)
+		if err != nil {
+			log.Fatalf("Failed to create the gRPC API: %v", err)
+		}
+
+		go func() {
+			if err := server.Serve(listener); err != nil {
+				log.Fatalf("Failed to start the gRPC API: %v", err)
+			}
+		}()
 	}
 
 	// Define the size of the channel and the number of workers
 	webhookQueue := make(chan adapter.WebhookPayload, conf.ChannelSize)
 	numWorkers := conf.NumWorkers
 
-	// Start the worker pool
+	// Start the worker pool. The workers share the rate limits, the in-flight caps, the circuits and
+	// the ordering keys of the instance.
+	deliveries := queue.NewWorker(conf)
 	var wg sync.WaitGroup
 	wg.Add(numWorkers)
 	for i := 0; i < numWorkers; i++ {
 		go func() {
 			defer wg.Done()
-			queueAdapter.ProcessWebhooks(ctx, webhookQueue, queueAdapter)
+			deliveries.ProcessWebhooks(ctx, webhookQueue, queueAdapter)
 		}()
 	}
 
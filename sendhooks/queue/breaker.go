@@ -0,0 +1,183 @@
+package queue
+
+import (
+	"net/url"
+	"sync"
+	"time"
+
+	"sendhooks/adapter"
+)
+
+const (
+	defaultBreakerMinRequests = 10
+	defaultBreakerWindow      = time.Minute
+	defaultBreakerCooldown    = 30 * time.Second
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// status is the delivery status published when the circuit enters the state.
+func (s circuitState) status() string {
+	switch s {
+	case circuitOpen:
+		return "circuit_open"
+	case circuitHalfOpen:
+		return "circuit_half_open"
+	default:
+		return "circuit_closed"
+	}
+}
+
+type circuit struct {
+	state       circuitState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probing     bool
+}
+
+// circuitBreakers keeps a circuit per endpoint, or per destination host for the webhooks to URLs
+// outside the endpoints section.
+type circuitBreakers struct {
+	config      adapter.Configuration
+	ratio       float64
+	minRequests int
+	window      time.Duration
+	cooldown    time.Duration
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+	now      func() time.Time
+}
+
+// newCircuitBreakers returns nil when the circuit breaker is disabled.
+func newCircuitBreakers(config adapter.Configuration) *circuitBreakers {
+	settings := config.CircuitBreaker
+	if settings.CircuitBreakerFailureRatio <= 0 {
+		return nil
+	}
+
+	breakers := &circuitBreakers{
+		config:      config,
+		ratio:       settings.CircuitBreakerFailureRatio,
+		minRequests: defaultBreakerMinRequests,
+		window:      defaultBreakerWindow,
+		cooldown:    defaultBreakerCooldown,
+		circuits:    map[string]*circuit{},
+		now:         time.Now,
+	}
+
+	if settings.CircuitBreakerMinRequests > 0 {
+		breakers.minRequests = settings.CircuitBreakerMinRequests
+	}
+	if settings.CircuitBreakerWindow > 0 {
+		breakers.window = time.Duration(settings.CircuitBreakerWindow) * time.Second
+	}
+	if settings.CircuitBreakerCooldown > 0 {
+		breakers.cooldown = time.Duration(settings.CircuitBreakerCooldown) * time.Second
+	}
+
+	return breakers
+}
+
+// allow tells if a request to the URL can be sent. Otherwise, it returns when to try again. It
+// also tells if the circuit just became half-open, the request being its probe.
+func (b *circuitBreakers) allow(webhookURL string) (bool, time.Time, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuitFor(webhookURL)
+	now := b.now()
+
+	switch c.state {
+	case circuitOpen:
+		reopensAt := c.openedAt.Add(b.cooldown)
+		if now.Before(reopensAt) {
+			return false, reopensAt, false
+		}
+
+		c.state = circuitHalfOpen
+		c.probing = true
+		return true, time.Time{}, true
+	case circuitHalfOpen:
+		// A single probe is sent, the other deliveries wait for its outcome.
+		if c.probing {
+			return false, now.Add(b.cooldown), false
+		}
+
+		c.probing = true
+		return true, time.Time{}, false
+	default:
+		return true, time.Time{}, false
+	}
+}
+
+// record counts the outcome of a request to the URL. It returns the state of the circuit and
+// whether it changed.
+func (b *circuitBreakers) record(webhookURL string, success bool) (circuitState, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuitFor(webhookURL)
+	now := b.now()
+
+	if c.state == circuitHalfOpen {
+		c.probing = false
+		if success {
+			*c = circuit{state: circuitClosed, windowStart: now}
+		} else {
+			c.state = circuitOpen
+			c.openedAt = now
+		}
+		return c.state, true
+	}
+
+	if c.state == circuitOpen {
+		// The request was sent before the circuit opened.
+		return c.state, false
+	}
+
+	if now.Sub(c.windowStart) > b.window {
+		c.windowStart = now
+		c.requests = 0
+		c.failures = 0
+	}
+
+	c.requests++
+	if !success {
+		c.failures++
+	}
+
+	if c.requests >= b.minRequests && float64(c.failures)/float64(c.requests) >= b.ratio {
+		c.state = circuitOpen
+		c.openedAt = now
+		return c.state, true
+	}
+
+	return c.state, false
+}
+
+// circuitFor returns the circuit of the URL. It must be called with the mutex held.
+func (b *circuitBreakers) circuitFor(webhookURL string) *circuit {
+	key := webhookURL
+	if endpoint, ok := b.config.EndpointFor(webhookURL); ok {
+		key = "endpoint:" + endpoint.EndpointUrl
+	} else if parsed, err := url.Parse(webhookURL); err == nil {
+		key = "host:" + parsed.Host
+	}
+
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{windowStart: b.now()}
+		b.circuits[key] = c
+	}
+
+	return c
+}
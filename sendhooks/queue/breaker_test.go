@@ -0,0 +1,105 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"sendhooks/adapter"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBreakers(now *time.Time) *circuitBreakers {
+	breakers := newCircuitBreakers(adapter.Configuration{
+		CircuitBreaker: adapter.CircuitBreakerConfig{
+			CircuitBreakerFailureRatio: 0.5,
+			CircuitBreakerMinRequests:  4,
+			CircuitBreakerCooldown:     30,
+		},
+	})
+	breakers.now = func() time.Time { return *now }
+	return breakers
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Run("Disabled without a failure ratio", func(t *testing.T) {
+		assert.Nil(t, newCircuitBreakers(adapter.Configuration{}))
+	})
+
+	t.Run("Circuit opens, probes and closes", func(t *testing.T) {
+		now := time.Unix(1700000000, 0)
+		breakers := newTestBreakers(&now)
+		url := "https://example.com/hooks"
+
+		// The ratio is only checked once there are enough requests.
+		for _, success := range []bool{false, false, true} {
+			state, changed := breakers.record(url, success)
+			assert.Equal(t, circuitClosed, state)
+			assert.False(t, changed)
+		}
+
+		state, changed := breakers.record(url, false)
+		assert.Equal(t, circuitOpen, state)
+		assert.True(t, changed)
+
+		// The deliveries are parked until the end of the cool-down. Other hosts are not affected.
+		allowed, retryAt, _ := breakers.allow(url)
+		assert.False(t, allowed)
+		assert.Equal(t, now.Add(30*time.Second), retryAt)
+
+		allowed, _, _ = breakers.allow("https://other.com/hooks")
+		assert.True(t, allowed)
+
+		// After the cool-down, a single probe goes through.
+		now = now.Add(30 * time.Second)
+		allowed, _, halfOpened := breakers.allow(url)
+		assert.True(t, allowed)
+		assert.True(t, halfOpened)
+
+		allowed, _, _ = breakers.allow(url)
+		assert.False(t, allowed)
+
+		state, changed = breakers.record(url, true)
+		assert.Equal(t, circuitClosed, state)
+		assert.True(t, changed)
+
+		allowed, _, _ = breakers.allow(url)
+		assert.True(t, allowed)
+	})
+
+	t.Run("Failed probe opens the circuit again", func(t *testing.T) {
+		now := time.Unix(1700000000, 0)
+		breakers := newTestBreakers(&now)
+		url := "https://example.com/hooks"
+
+		for i := 0; i < 4; i++ {
+			breakers.record(url, false)
+		}
+
+		now = now.Add(30 * time.Second)
+		allowed, _, _ := breakers.allow(url)
+		assert.True(t, allowed)
+
+		state, changed := breakers.record(url, false)
+		assert.Equal(t, circuitOpen, state)
+		assert.True(t, changed)
+
+		allowed, retryAt, _ := breakers.allow(url)
+		assert.False(t, allowed)
+		assert.Equal(t, now.Add(30*time.Second), retryAt)
+	})
+
+	t.Run("Failures of old windows are forgotten", func(t *testing.T) {
+		now := time.Unix(1700000000, 0)
+		breakers := newTestBreakers(&now)
+		url := "https://example.com/hooks"
+
+		for i := 0; i < 3; i++ {
+			breakers.record(url, false)
+		}
+
+		now = now.Add(2 * time.Minute)
+		state, _ := breakers.record(url, false)
+		assert.Equal(t, circuitClosed, state)
+	})
+}
@@ -0,0 +1,102 @@
+package queue
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"sendhooks/adapter"
+)
+
+// busyEndpointDelay is how long a webhook waits in the broker when its endpoint has no free slot.
+const busyEndpointDelay = time.Second
+
+// defaultMaxInFlight is the global cap without one in the configuration. The webhooks waiting for a
+// global slot are the ones picked by priority.
+const defaultMaxInFlight = 100
+
+// inFlight caps the requests in flight, globally and per destination, so that a slow receiver
+// can't hold all the workers.
+type inFlight struct {
+	config adapter.Configuration
+	// global holds a token per request in flight. It's nil without a global cap.
+	global chan struct{}
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newInFlight(config adapter.Configuration) *inFlight {
+	maxInFlight := config.MaxInFlight
+	if maxInFlight == 0 {
+		maxInFlight = defaultMaxInFlight
+	}
+
+	slots := &inFlight{config: config, counts: map[string]int{}}
+	if maxInFlight > 0 {
+		slots.global = make(chan struct{}, maxInFlight)
+	}
+	return slots
+}
+
+// acquire waits for a global slot. It returns false when the context is cancelled first.
+func (f *inFlight) acquire(ctx context.Context) bool {
+	if f.global == nil {
+		return true
+	}
+
+	select {
+	case f.global <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (f *inFlight) release() {
+	if f.global != nil {
+		<-f.global
+	}
+}
+
+// tryAcquireDestination takes a slot of the destination of the URL without waiting, so that a busy
+// destination doesn't hold the webhooks of the others. The returned function releases the slot.
+func (f *inFlight) tryAcquireDestination(webhookURL string) (func(), bool) {
+	key, limit := f.destinationFor(webhookURL)
+	if limit <= 0 {
+		return func() {}, true
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.counts[key] >= limit {
+		return nil, false
+	}
+	f.counts[key]++
+
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		f.counts[key]--
+		if f.counts[key] == 0 {
+			delete(f.counts, key)
+		}
+	}, true
+}
+
+// destinationFor returns the endpoint of the URL when it has a cap, or its host.
+func (f *inFlight) destinationFor(webhookURL string) (string, int) {
+	if endpoint, ok := f.config.EndpointFor(webhookURL); ok && endpoint.EndpointMaxInFlight > 0 {
+		return "endpoint:" + endpoint.EndpointUrl, endpoint.EndpointMaxInFlight
+	}
+
+	host := webhookURL
+	if parsed, err := url.Parse(webhookURL); err == nil {
+		host = parsed.Host
+	}
+
+	return "host:" + host, f.config.MaxInFlightPerHost
+}
@@ -0,0 +1,57 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"sendhooks/adapter"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInFlight(t *testing.T) {
+	t.Run("Destinations are capped separately", func(t *testing.T) {
+		slots := newInFlight(adapter.Configuration{
+			MaxInFlightPerHost: 1,
+			Endpoints: []adapter.EndpointConfig{
+				{EndpointUrl: "https://example.com/bulk", EndpointMaxInFlight: 2},
+			},
+		})
+
+		release, ok := slots.tryAcquireDestination("https://example.com/a")
+		assert.True(t, ok)
+
+		// The host is full, the other hosts and the endpoint with its own cap are not.
+		_, ok = slots.tryAcquireDestination("https://example.com/b")
+		assert.False(t, ok)
+		_, ok = slots.tryAcquireDestination("https://other.com/a")
+		assert.True(t, ok)
+		_, ok = slots.tryAcquireDestination("https://example.com/bulk/1")
+		assert.True(t, ok)
+		_, ok = slots.tryAcquireDestination("https://example.com/bulk/2")
+		assert.True(t, ok)
+		_, ok = slots.tryAcquireDestination("https://example.com/bulk/3")
+		assert.False(t, ok)
+
+		release()
+		_, ok = slots.tryAcquireDestination("https://example.com/b")
+		assert.True(t, ok)
+	})
+
+	t.Run("The global cap waits for a free slot", func(t *testing.T) {
+		slots := newInFlight(adapter.Configuration{MaxInFlight: 1})
+		assert.True(t, slots.acquire(context.Background()))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.False(t, slots.acquire(ctx))
+
+		slots.release()
+		assert.True(t, slots.acquire(context.Background()))
+	})
+
+	t.Run("The global cap has a default and can be removed", func(t *testing.T) {
+		assert.Equal(t, defaultMaxInFlight, cap(newInFlight(adapter.Configuration{}).global))
+		assert.Nil(t, newInFlight(adapter.Configuration{MaxInFlight: -1}).global)
+	})
+}
@@ -0,0 +1,50 @@
+package queue
+
+import (
+	"sync"
+
+	"sendhooks/adapter"
+)
+
+// disabledEndpoints keeps the endpoints that answered 410 Gone. The webhooks to them are
+// dead-lettered without being sent, until the instance restarts.
+type disabledEndpoints struct {
+	config adapter.Configuration
+
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+func newDisabledEndpoints(config adapter.Configuration) *disabledEndpoints {
+	return &disabledEndpoints{config: config, keys: map[string]bool{}}
+}
+
+// disable disables the endpoint of the URL. It returns false when it was already disabled.
+func (d *disabledEndpoints) disable(webhookURL string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := d.keyFor(webhookURL)
+	if d.keys[key] {
+		return false
+	}
+
+	d.keys[key] = true
+	return true
+}
+
+func (d *disabledEndpoints) disabled(webhookURL string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.keys[d.keyFor(webhookURL)]
+}
+
+// keyFor returns the endpoint of the URL, or the URL itself: a path gone from a host doesn't
+// disable the others.
+func (d *disabledEndpoints) keyFor(webhookURL string) string {
+	if endpoint, ok := d.config.EndpointFor(webhookURL); ok {
+		return "endpoint:" + endpoint.EndpointUrl
+	}
+	return "url:" + webhookURL
+}
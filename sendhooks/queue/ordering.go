@@ -0,0 +1,73 @@
+package queue
+
+import (
+	"sync"
+
+	"sendhooks/adapter"
+)
+
+// orderedKey holds the webhooks of an ordering key waiting behind the one being delivered.
+type orderedKey struct {
+	current adapter.WebhookPayload
+	pending []adapter.WebhookPayload
+}
+
+// orderedKeys delivers the webhooks of each ordering key one at a time. The followers of a key
+// are held in memory until the webhooks before them are delivered or dead-lettered.
+type orderedKeys struct {
+	mu   sync.Mutex
+	keys map[string]*orderedKey
+}
+
+func newOrderedKeys() *orderedKeys {
+	return &orderedKeys{keys: map[string]*orderedKey{}}
+}
+
+// push queues a webhook behind the others of its key. It returns true when the key was idle, so
+// the caller must start delivering it.
+func (o *orderedKeys) push(payload adapter.WebhookPayload) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	key, ok := o.keys[payload.OrderingKey]
+	if !ok {
+		o.keys[payload.OrderingKey] = &orderedKey{current: payload}
+		return true
+	}
+
+	// A message reclaimed by the broker while it waits here is already queued.
+	if payload.MessageID != "" {
+		if key.current.MessageID == payload.MessageID {
+			return false
+		}
+		for _, pending := range key.pending {
+			if pending.MessageID == payload.MessageID {
+				return false
+			}
+		}
+	}
+
+	key.pending = append(key.pending, payload)
+	return false
+}
+
+// next returns the webhook following the current one of the key. When there is none, the key
+// becomes idle and next returns false.
+func (o *orderedKeys) next(orderingKey string) (adapter.WebhookPayload, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	key, ok := o.keys[orderingKey]
+	if !ok {
+		return adapter.WebhookPayload{}, false
+	}
+
+	if len(key.pending) == 0 {
+		delete(o.keys, orderingKey)
+		return adapter.WebhookPayload{}, false
+	}
+
+	key.current = key.pending[0]
+	key.pending = key.pending[1:]
+	return key.current, true
+}
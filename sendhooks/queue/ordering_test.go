@@ -0,0 +1,51 @@
+package queue
+
+import (
+	"testing"
+
+	"sendhooks/adapter"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderedKeys(t *testing.T) {
+	t.Run("Webhooks of a key are returned in order", func(t *testing.T) {
+		keys := newOrderedKeys()
+
+		assert.True(t, keys.push(adapter.WebhookPayload{WebhookID: "webhook-1", OrderingKey: "a"}))
+		assert.False(t, keys.push(adapter.WebhookPayload{WebhookID: "webhook-2", OrderingKey: "a"}))
+		assert.False(t, keys.push(adapter.WebhookPayload{WebhookID: "webhook-3", OrderingKey: "a"}))
+
+		// Another key doesn't wait for the first one.
+		assert.True(t, keys.push(adapter.WebhookPayload{WebhookID: "webhook-4", OrderingKey: "b"}))
+
+		next, ok := keys.next("a")
+		assert.True(t, ok)
+		assert.Equal(t, "webhook-2", next.WebhookID)
+		next, ok = keys.next("a")
+		assert.True(t, ok)
+		assert.Equal(t, "webhook-3", next.WebhookID)
+
+		_, ok = keys.next("a")
+		assert.False(t, ok)
+		_, ok = keys.next("b")
+		assert.False(t, ok)
+
+		assert.True(t, keys.push(adapter.WebhookPayload{WebhookID: "webhook-5", OrderingKey: "a"}))
+	})
+
+	t.Run("Reclaimed messages are not queued twice", func(t *testing.T) {
+		keys := newOrderedKeys()
+
+		assert.True(t, keys.push(adapter.WebhookPayload{WebhookID: "webhook-1", MessageID: "1-0", OrderingKey: "a"}))
+		assert.False(t, keys.push(adapter.WebhookPayload{WebhookID: "webhook-2", MessageID: "2-0", OrderingKey: "a"}))
+		assert.False(t, keys.push(adapter.WebhookPayload{WebhookID: "webhook-1", MessageID: "1-0", OrderingKey: "a"}))
+		assert.False(t, keys.push(adapter.WebhookPayload{WebhookID: "webhook-2", MessageID: "2-0", OrderingKey: "a"}))
+
+		next, ok := keys.next("a")
+		assert.True(t, ok)
+		assert.Equal(t, "webhook-2", next.WebhookID)
+		_, ok = keys.next("a")
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,83 @@
+package queue
+
+import (
+	"sendhooks/adapter"
+)
+
+// lanes holds the webhooks read from the broker while they wait for a slot, one lane per
+// priority. They are handed out with a smooth weighted round-robin: during a backlog, each
+// priority gets a share of the deliveries proportional to its weight, and an empty lane leaves its
+// share to the others.
+type lanes struct {
+	weights map[string]int
+	// current is the running credit of each lane.
+	current map[string]int
+	waiting map[string][]adapter.WebhookPayload
+	size    int
+	// capacity is the number of webhooks held before reading the queue stops.
+	capacity int
+}
+
+func newLanes(config adapter.Configuration, capacity int) *lanes {
+	l := &lanes{
+		weights:  map[string]int{},
+		current:  map[string]int{},
+		waiting:  map[string][]adapter.WebhookPayload{},
+		capacity: capacity,
+	}
+
+	for _, priority := range adapter.Priorities {
+		l.weights[priority] = config.Priority.Weight(priority)
+	}
+
+	return l
+}
+
+func (l *lanes) push(payload adapter.WebhookPayload) {
+	priority := payload.PriorityLevel()
+	l.waiting[priority] = append(l.waiting[priority], payload)
+	l.size++
+}
+
+func (l *lanes) len() int {
+	return l.size
+}
+
+func (l *lanes) full() bool {
+	return l.size >= l.capacity
+}
+
+// pop returns the next webhook to deliver, the oldest of the lane with the most credit.
+func (l *lanes) pop() (adapter.WebhookPayload, bool) {
+	next := ""
+	total := 0
+	for _, priority := range adapter.Priorities {
+		if len(l.waiting[priority]) == 0 {
+			continue
+		}
+
+		l.current[priority] += l.weights[priority]
+		total += l.weights[priority]
+		if next == "" || l.current[priority] > l.current[next] {
+			next = priority
+		}
+	}
+
+	if next == "" {
+		return adapter.WebhookPayload{}, false
+	}
+
+	l.current[next] -= total
+
+	payload := l.waiting[next][0]
+	l.waiting[next] = l.waiting[next][1:]
+	l.size--
+
+	// A lane coming back after a pause starts without the credit it had.
+	if len(l.waiting[next]) == 0 {
+		delete(l.waiting, next)
+		l.current[next] = 0
+	}
+
+	return payload, true
+}
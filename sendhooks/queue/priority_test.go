@@ -0,0 +1,65 @@
+package queue
+
+import (
+	"fmt"
+	"testing"
+
+	"sendhooks/adapter"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fillLanes(l *lanes, priority string, count int) {
+	for i := 0; i < count; i++ {
+		l.push(adapter.WebhookPayload{WebhookID: fmt.Sprintf("%s-%d", priority, i), Priority: priority})
+	}
+}
+
+func TestLanes(t *testing.T) {
+	t.Run("Lanes share the deliveries by weight", func(t *testing.T) {
+		waiting := newLanes(adapter.Configuration{}, 100)
+		fillLanes(waiting, adapter.PriorityLow, 20)
+		fillLanes(waiting, "", 20)
+		fillLanes(waiting, adapter.PriorityHigh, 20)
+
+		counts := map[string]int{}
+		for i := 0; i < 14; i++ {
+			payload, ok := waiting.pop()
+			assert.True(t, ok)
+			counts[payload.PriorityLevel()]++
+		}
+
+		// The default weights are 4, 2 and 1: the low priority isn't starved.
+		assert.Equal(t, map[string]int{adapter.PriorityHigh: 8, adapter.PriorityNormal: 4, adapter.PriorityLow: 2}, counts)
+	})
+
+	t.Run("Webhooks of a lane keep their order", func(t *testing.T) {
+		waiting := newLanes(adapter.Configuration{}, 100)
+		fillLanes(waiting, adapter.PriorityLow, 3)
+
+		for i := 0; i < 3; i++ {
+			payload, ok := waiting.pop()
+			assert.True(t, ok)
+			assert.Equal(t, fmt.Sprintf("low-%d", i), payload.WebhookID)
+		}
+
+		_, ok := waiting.pop()
+		assert.False(t, ok)
+		assert.Zero(t, waiting.len())
+	})
+
+	t.Run("An empty lane leaves its share to the others", func(t *testing.T) {
+		waiting := newLanes(adapter.Configuration{}, 6)
+		fillLanes(waiting, adapter.PriorityNormal, 4)
+		fillLanes(waiting, adapter.PriorityLow, 2)
+		assert.True(t, waiting.full())
+
+		var priorities []string
+		for waiting.len() > 0 {
+			payload, _ := waiting.pop()
+			priorities = append(priorities, payload.Priority)
+		}
+
+		assert.Equal(t, []string{"normal", "low", "normal", "normal", "low", "normal"}, priorities)
+	})
+}
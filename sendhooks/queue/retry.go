@@ -0,0 +1,223 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"sendhooks/adapter"
+	"sendhooks/logging"
+)
+
+// The settings of the default retry policy, also used as the defaults of the named policies.
+const (
+	maxRetries     int           = 5
+	initialBackoff time.Duration = time.Second
+	maxBackoff     time.Duration = time.Hour
+)
+
+// defaultRetryPolicy applies to the webhooks without a named policy.
+var defaultRetryPolicy = retryPolicy{
+	strategy:       "exponential",
+	maxAttempts:    maxRetries,
+	initialBackoff: initialBackoff,
+	maxBackoff:     maxBackoff,
+}
+
+// jitter returns a random duration between zero and the limit. It's a variable to be replaced in
+// the tests.
+var jitter = func(limit time.Duration) time.Duration {
+	return time.Duration(rand.Int63n(int64(limit) + 1))
+}
+
+type retryPolicy struct {
+	strategy       string
+	jitter         string
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	schedule       []time.Duration
+	maxAge         time.Duration
+}
+
+func newRetryPolicy(config adapter.RetryPolicyConfig) (retryPolicy, error) {
+	policy := retryPolicy{
+		strategy:       config.RetryPolicyStrategy,
+		jitter:         config.RetryPolicyJitter,
+		maxAttempts:    config.RetryPolicyMaxAttempts,
+		initialBackoff: time.Duration(config.RetryPolicyInitialBackoff) * time.Second,
+		maxBackoff:     time.Duration(config.RetryPolicyMaxBackoff) * time.Second,
+		maxAge:         time.Duration(config.RetryPolicyMaxAge) * time.Second,
+	}
+
+	if policy.strategy == "" {
+		policy.strategy = "exponential"
+	}
+	if policy.initialBackoff <= 0 {
+		policy.initialBackoff = initialBackoff
+	}
+	if policy.maxBackoff <= 0 {
+		policy.maxBackoff = maxBackoff
+	}
+
+	switch policy.strategy {
+	case "exponential", "linear", "fixed":
+	case "schedule":
+		if len(config.RetryPolicySchedule) == 0 {
+			return retryPolicy{}, fmt.Errorf("retry policy %q has an empty schedule", config.RetryPolicyName)
+		}
+		for _, value := range config.RetryPolicySchedule {
+			delay, err := time.ParseDuration(value)
+			if err != nil || delay < 0 {
+				return retryPolicy{}, fmt.Errorf("retry policy %q has an invalid delay %q", config.RetryPolicyName, value)
+			}
+			policy.schedule = append(policy.schedule, delay)
+		}
+	default:
+		return retryPolicy{}, fmt.Errorf("retry policy %q has an unknown strategy %q", config.RetryPolicyName, policy.strategy)
+	}
+
+	if policy.jitter != "" && policy.jitter != "full" && policy.jitter != "equal" {
+		return retryPolicy{}, fmt.Errorf("retry policy %q has an unknown jitter %q", config.RetryPolicyName, policy.jitter)
+	}
+
+	if policy.maxAttempts <= 0 {
+		switch {
+		case policy.maxAge > 0:
+			policy.maxAttempts = 0
+		case policy.strategy == "schedule":
+			policy.maxAttempts = len(policy.schedule) + 1
+		default:
+			policy.maxAttempts = maxRetries
+		}
+	}
+
+	return policy, nil
+}
+
+// ValidateRetryPolicies checks the retry policies of the configuration, and that the policies
+// selected by the configuration exist.
+func ValidateRetryPolicies(config adapter.Configuration) error {
+	names := map[string]bool{}
+	for _, policyConfig := range config.RetryPolicies {
+		if policyConfig.RetryPolicyName == "" {
+			return errors.New("a retry policy has no name")
+		}
+		if names[policyConfig.RetryPolicyName] {
+			return fmt.Errorf("retry policy %q is defined twice", policyConfig.RetryPolicyName)
+		}
+		names[policyConfig.RetryPolicyName] = true
+
+		if _, err := newRetryPolicy(policyConfig); err != nil {
+			return err
+		}
+	}
+
+	if config.DefaultRetryPolicy != "" && !names[config.DefaultRetryPolicy] {
+		return fmt.Errorf("the default retry policy %q is not defined", config.DefaultRetryPolicy)
+	}
+
+	for _, endpoint := range config.Endpoints {
+		if endpoint.EndpointRetryPolicy != "" && !names[endpoint.EndpointRetryPolicy] {
+			return fmt.Errorf("the retry policy %q of %s is not defined", endpoint.EndpointRetryPolicy, endpoint.EndpointUrl)
+		}
+	}
+
+	return nil
+}
+
+// retryPolicyFor returns the policy named by the webhook, or by its endpoint, or the default one.
+// An unknown name falls back to the next one.
+func retryPolicyFor(config adapter.Configuration, payload adapter.WebhookPayload) retryPolicy {
+	names := []string{payload.RetryPolicy}
+	if endpoint, ok := config.EndpointFor(payload.URL); ok {
+		names = append(names, endpoint.EndpointRetryPolicy)
+	}
+	names = append(names, config.DefaultRetryPolicy)
+
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+
+		for _, policyConfig := range config.RetryPolicies {
+			if policyConfig.RetryPolicyName != name {
+				continue
+			}
+
+			if policy, err := newRetryPolicy(policyConfig); err == nil {
+				return policy
+			}
+		}
+
+		logging.WebhookLogger(logging.WarningType, fmt.Errorf("unknown retry policy %q: WebhookID : %s", name, payload.WebhookID))
+	}
+
+	return defaultRetryPolicy
+}
+
+// delay returns how long to wait before the next attempt once the given number of attempts failed.
+func (p retryPolicy) delay(retries int) time.Duration {
+	var delay time.Duration
+
+	switch p.strategy {
+	case "linear":
+		delay = p.initialBackoff * time.Duration(retries)
+	case "fixed":
+		delay = p.initialBackoff
+	case "schedule":
+		index := retries - 1
+		if index >= len(p.schedule) {
+			index = len(p.schedule) - 1
+		}
+		if index < 0 {
+			index = 0
+		}
+		delay = p.schedule[index]
+	default:
+		delay = p.initialBackoff
+		for i := 0; i < retries && delay < p.maxBackoff; i++ {
+			delay *= 2
+		}
+	}
+
+	// The delays of a schedule are used as they are.
+	if p.strategy != "schedule" && (delay > p.maxBackoff || delay < 0) {
+		delay = p.maxBackoff
+	}
+
+	switch p.jitter {
+	case "full":
+		delay = jitter(delay)
+	case "equal":
+		delay = delay/2 + jitter(delay-delay/2)
+	}
+
+	return delay
+}
+
+// longestDelay is the delay a Retry-After response can ask at most: the last delay of a schedule,
+// or the maximum backoff of the other strategies.
+func (p retryPolicy) longestDelay() time.Duration {
+	if p.strategy == "schedule" && len(p.schedule) > 0 {
+		return p.schedule[len(p.schedule)-1]
+	}
+	return p.maxBackoff
+}
+
+// exhausted tells if the webhook must be dead-lettered instead of retried at retryAt, once the
+// given number of attempts failed. accepted is the time of its first read.
+func (p retryPolicy) exhausted(retries int, accepted string, retryAt time.Time) bool {
+	if p.maxAttempts > 0 && retries >= p.maxAttempts {
+		return true
+	}
+
+	if p.maxAge > 0 {
+		if first, err := time.Parse(time.RFC3339, accepted); err == nil && retryAt.After(first.Add(p.maxAge)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,105 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"sendhooks/adapter"
+	"sendhooks/logging"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	t.Run("Strategies", func(t *testing.T) {
+		linear, err := newRetryPolicy(adapter.RetryPolicyConfig{RetryPolicyName: "linear", RetryPolicyStrategy: "linear", RetryPolicyInitialBackoff: 10})
+		assert.NoError(t, err)
+		assert.Equal(t, 10*time.Second, linear.delay(1))
+		assert.Equal(t, 30*time.Second, linear.delay(3))
+
+		fixed, err := newRetryPolicy(adapter.RetryPolicyConfig{RetryPolicyName: "fixed", RetryPolicyStrategy: "fixed", RetryPolicyInitialBackoff: 10})
+		assert.NoError(t, err)
+		assert.Equal(t, 10*time.Second, fixed.delay(4))
+
+		// The delays of a schedule are not capped by the maximum backoff.
+		schedule, err := newRetryPolicy(adapter.RetryPolicyConfig{RetryPolicyName: "schedule", RetryPolicyStrategy: "schedule", RetryPolicySchedule: []string{"1m", "5m", "30m", "2h", "24h"}})
+		assert.NoError(t, err)
+		assert.Equal(t, time.Minute, schedule.delay(1))
+		assert.Equal(t, 2*time.Hour, schedule.delay(4))
+		assert.Equal(t, 24*time.Hour, schedule.delay(5))
+		assert.Equal(t, 24*time.Hour, schedule.delay(9))
+		assert.Equal(t, 6, schedule.maxAttempts)
+
+		capped, err := newRetryPolicy(adapter.RetryPolicyConfig{RetryPolicyName: "capped", RetryPolicyMaxBackoff: 10})
+		assert.NoError(t, err)
+		assert.Equal(t, 8*time.Second, capped.delay(3))
+		assert.Equal(t, 10*time.Second, capped.delay(4))
+
+		// The default policy doubles the backoff up to an hour.
+		assert.Equal(t, 2*time.Second, defaultRetryPolicy.delay(1))
+		assert.Equal(t, 16*time.Second, defaultRetryPolicy.delay(4))
+		assert.Equal(t, maxBackoff, defaultRetryPolicy.delay(20))
+	})
+
+	t.Run("Jitter", func(t *testing.T) {
+		defer func(original func(time.Duration) time.Duration) { jitter = original }(jitter)
+		jitter = func(limit time.Duration) time.Duration { return limit / 4 }
+
+		full, err := newRetryPolicy(adapter.RetryPolicyConfig{RetryPolicyName: "full", RetryPolicyJitter: "full"})
+		assert.NoError(t, err)
+		assert.Equal(t, 2*time.Second, full.delay(3))
+
+		equal, err := newRetryPolicy(adapter.RetryPolicyConfig{RetryPolicyName: "equal", RetryPolicyJitter: "equal"})
+		assert.NoError(t, err)
+		assert.Equal(t, 5*time.Second, equal.delay(3))
+	})
+
+	t.Run("Exhaustion", func(t *testing.T) {
+		accepted := time.Now().Add(-time.Hour)
+
+		policy, err := newRetryPolicy(adapter.RetryPolicyConfig{RetryPolicyName: "aged", RetryPolicyMaxAge: 7200})
+		assert.NoError(t, err)
+		assert.False(t, policy.exhausted(100, accepted.Format(time.RFC3339), time.Now()))
+		assert.True(t, policy.exhausted(100, accepted.Format(time.RFC3339), time.Now().Add(2*time.Hour)))
+
+		assert.True(t, defaultRetryPolicy.exhausted(maxRetries, accepted.Format(time.RFC3339), time.Now()))
+		assert.False(t, defaultRetryPolicy.exhausted(maxRetries-1, accepted.Format(time.RFC3339), time.Now()))
+	})
+
+	t.Run("Invalid policies", func(t *testing.T) {
+		_, err := newRetryPolicy(adapter.RetryPolicyConfig{RetryPolicyName: "p", RetryPolicyStrategy: "random"})
+		assert.Error(t, err)
+		_, err = newRetryPolicy(adapter.RetryPolicyConfig{RetryPolicyName: "p", RetryPolicyStrategy: "schedule", RetryPolicySchedule: []string{"1 day"}})
+		assert.Error(t, err)
+		_, err = newRetryPolicy(adapter.RetryPolicyConfig{RetryPolicyName: "p", RetryPolicyJitter: "half"})
+		assert.Error(t, err)
+	})
+}
+
+func TestRetryPolicyFor(t *testing.T) {
+	logging.WebhookLogger = func(errorType string, message interface{}) error {
+		return nil
+	}
+
+	configuration := adapter.Configuration{
+		RetryPolicies: []adapter.RetryPolicyConfig{
+			{RetryPolicyName: "patient", RetryPolicyStrategy: "fixed", RetryPolicyInitialBackoff: 60},
+			{RetryPolicyName: "urgent", RetryPolicyStrategy: "fixed", RetryPolicyInitialBackoff: 1},
+		},
+		Endpoints: []adapter.EndpointConfig{
+			{EndpointUrl: "https://example.com/slow", EndpointRetryPolicy: "patient"},
+		},
+	}
+	assert.NoError(t, ValidateRetryPolicies(configuration))
+
+	// The policy of the webhook wins over the one of its endpoint.
+	assert.Equal(t, time.Second, retryPolicyFor(configuration, adapter.WebhookPayload{URL: "https://example.com/slow", RetryPolicy: "urgent"}).delay(1))
+	assert.Equal(t, time.Minute, retryPolicyFor(configuration, adapter.WebhookPayload{URL: "https://example.com/slow"}).delay(1))
+	assert.Equal(t, defaultRetryPolicy, retryPolicyFor(configuration, adapter.WebhookPayload{URL: "https://other.com"}))
+
+	configuration.DefaultRetryPolicy = "urgent"
+	assert.Equal(t, time.Second, retryPolicyFor(configuration, adapter.WebhookPayload{URL: "https://other.com", RetryPolicy: "unknown"}).delay(1))
+
+	configuration.Endpoints[0].EndpointRetryPolicy = "missing"
+	assert.Error(t, ValidateRetryPolicies(configuration))
+}
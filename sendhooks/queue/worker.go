@@ -7,9 +7,12 @@ we also handle the retries and the exponential backoff logic for sending the hoo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sendhooks/adapter"
+	"sendhooks/dedupe"
 	"sendhooks/logging"
+	"sendhooks/ratelimit"
 	"sendhooks/sender"
 	"time"
 	"unsafe"
@@ -42,84 +45,490 @@ func SizeofValue(v interface{}) int {
 	}
 }
 
-const (
-	maxRetries int = 5
-)
+// Worker delivers the webhooks read from the broker. Its controls are shared by all the goroutines
+// reading the queue, so an instance creates a single worker. limiter throttles the deliveries,
+// slots caps the requests in flight, breakers stop the deliveries to failing endpoints, ordered
+// holds the webhooks with an ordering key, deduplicator suppresses the duplicates and disabled
+// keeps the endpoints gone. They are skipped when nil.
+type Worker struct {
+	configuration adapter.Configuration
+	limiter       *ratelimit.Limiter
+	slots         *inFlight
+	breakers      *circuitBreakers
+	ordered       *orderedKeys
+	deduplicator  *dedupe.Deduplicator
+	disabled      *disabledEndpoints
+}
+
+// NewWorker creates the worker of the configuration. When the store of the rate limiter or of the
+// deduplicator can't be reached, the deliveries are not throttled or deduplicated.
+func NewWorker(configuration adapter.Configuration) *Worker {
+	w := &Worker{
+		configuration: configuration,
+		slots:         newInFlight(configuration),
+		breakers:      newCircuitBreakers(configuration),
+		ordered:       newOrderedKeys(),
+		disabled:      newDisabledEndpoints(configuration),
+	}
+
+	var err error
+	w.limiter, err = ratelimit.NewLimiter(configuration)
+	if err != nil {
+		logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error creating the rate limiter, the deliveries are not throttled: %w", err))
+	}
+
+	w.deduplicator, err = dedupe.NewDeduplicator(configuration)
+	if err != nil {
+		logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error creating the deduplicator, the duplicates are delivered: %w", err))
+	}
+
+	return w
+}
+
+// ProcessWebhooks delivers the webhooks of the queue until it's closed. It's run by several
+// goroutines at once, all sharing the worker.
+func (w *Worker) ProcessWebhooks(ctx context.Context, webhookQueue chan adapter.WebhookPayload, queueAdapter adapter.Adapter) {
+	// The webhooks read from the queue wait in their lanes until a slot is free, the channel
+	// holding the rest.
+	waiting := newLanes(w.configuration, cap(webhookQueue)+1)
+
+	for {
+		if waiting.len() == 0 {
+			payload, ok := <-webhookQueue
+			if !ok {
+				return
+			}
+			if !w.deliverOrdered(ctx, payload, queueAdapter) {
+				waiting.push(payload)
+			}
+			continue
+		}
+
+		// Waiting for a global slot stops reading the queue, so the webhooks stay in the broker.
+		if !w.slots.acquire(ctx) {
+			return
+		}
+
+		// The webhooks read meanwhile join their lanes before the next one is picked, so that an
+		// urgent webhook doesn't wait behind the ones already read.
+	read:
+		for !waiting.full() {
+			select {
+			case payload, ok := <-webhookQueue:
+				if !ok {
+					break read
+				}
+				if !w.deliverOrdered(ctx, payload, queueAdapter) {
+					waiting.push(payload)
+				}
+			default:
+				break read
+			}
+		}
+
+		payload, _ := waiting.pop()
+		go func(payload adapter.WebhookPayload) {
+			defer w.slots.release()
+			w.sendWebhookWithRetries(ctx, payload, queueAdapter)
+		}(payload)
+	}
+}
+
+// deliverOrdered hands a webhook with an ordering key to the goroutine of its key, which takes its
+// own slots. It returns false for the other webhooks.
+func (w *Worker) deliverOrdered(ctx context.Context, payload adapter.WebhookPayload, queueAdapter adapter.Adapter) bool {
+	if payload.OrderingKey == "" {
+		return false
+	}
+
+	if w.ordered.push(payload) {
+		go w.deliverKey(ctx, payload, queueAdapter)
+	}
+	return true
+}
+
+// attemptResult is the outcome of a call to attempt.
+type attemptResult int
 
 const (
-	initialBackoff time.Duration = time.Second
-	maxBackoff     time.Duration = time.Hour
+	// done means the webhook was delivered or dead-lettered.
+	done attemptResult = iota
+	// postponed means the webhook must wait without counting an attempt.
+	postponed
+	// failed means the attempt failed and the webhook must be retried.
+	failed
 )
 
-func ProcessWebhooks(ctx context.Context, webhookQueue chan adapter.WebhookPayload, configuration adapter.Configuration, queueAdapter adapter.Adapter) {
+// sendWebhookWithRetries makes one delivery attempt. When the webhook must wait, the next attempt
+// is scheduled in the broker instead of waiting here, so pending retries survive a restart.
+func (w *Worker) sendWebhookWithRetries(ctx context.Context, payload adapter.WebhookPayload, queueAdapter adapter.Adapter) {
+	created := time.Now().String()
+
+	if w.duplicate(ctx, &payload, created, queueAdapter) {
+		return
+	}
+
+	result, retryAt, err := w.attempt(ctx, &payload, created, queueAdapter)
+	switch result {
+	case postponed:
+		postpone(ctx, payload, retryAt, queueAdapter)
+	case failed:
+		if scheduleErr := queueAdapter.ScheduleRetry(ctx, payload, retryAt); scheduleErr != nil {
+			// The message isn't acknowledged, so it will be reclaimed and retried later.
+			logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error scheduling retry: WebhookID : %s: %s", payload.WebhookID, scheduleErr))
+			return
+		}
 
-	for payload := range webhookQueue {
-		go sendWebhookWithRetries(ctx, payload, configuration, queueAdapter)
+		retrying(ctx, payload, retryAt, err, created, queueAdapter)
 	}
 }
 
-func sendWebhookWithRetries(ctx context.Context, payload adapter.WebhookPayload, configuration adapter.Configuration, queueAdapter adapter.Adapter) {
+// deliverKey delivers the webhooks of an ordering key one after the other, starting with the
+// payload, until none is left.
+func (w *Worker) deliverKey(ctx context.Context, payload adapter.WebhookPayload, queueAdapter adapter.Adapter) {
+	for {
+		if !w.sendInOrder(ctx, payload, queueAdapter) {
+			return
+		}
 
-	if err, created, retries := retryWithExponentialBackoff(ctx, payload, configuration, queueAdapter); err != nil {
-		logging.WebhookLogger(logging.WarningType, fmt.Errorf("failed to send sendhooks after maximum retries. WebhookID : %s", payload.WebhookID))
-		err := queueAdapter.PublishStatus(ctx, payload.WebhookID, payload.URL, created, "", "failed", err.Error(), SizeofMap(payload.Data), retries)
-		if err != nil {
-			logging.WebhookLogger(logging.WarningType, fmt.Errorf("error publishing status update: WebhookID : %s ", payload.WebhookID))
+		var ok bool
+		payload, ok = w.ordered.next(payload.OrderingKey)
+		if !ok {
+			return
 		}
 	}
 }
 
-func calculateBackoff(currentBackoff time.Duration) time.Duration {
+// leaseRenewal is how often the lease of a webhook waiting in the worker is extended, well below
+// the shortest lease of the brokers.
+var leaseRenewal = time.Minute
 
-	nextBackoff := currentBackoff * 2
+// sendInOrder delivers a webhook with an ordering key. Sending it back to the broker would let its
+// followers overtake it, so it waits here between the attempts and blocks only its own key. It
+// returns false when the context is cancelled first, the broker then delivers it again.
+func (w *Worker) sendInOrder(ctx context.Context, payload adapter.WebhookPayload, queueAdapter adapter.Adapter) bool {
+	created := time.Now().String()
 
-	if nextBackoff > maxBackoff {
-		return maxBackoff
+	if w.duplicate(ctx, &payload, created, queueAdapter) {
+		return true
 	}
 
-	return nextBackoff
+	for {
+		// The global slot is only held during the attempt, not while waiting.
+		if w.slots != nil && !w.slots.acquire(ctx) {
+			return false
+		}
+		result, retryAt, err := w.attempt(ctx, &payload, created, queueAdapter)
+		if w.slots != nil {
+			w.slots.release()
+		}
+
+		switch result {
+		case done:
+			return true
+		case failed:
+			retrying(ctx, payload, retryAt, err, created, queueAdapter)
+		}
+
+		if !waitLeased(ctx, payload, retryAt, queueAdapter) {
+			return false
+		}
+	}
 }
 
-func retryWithExponentialBackoff(context context.Context, payload adapter.WebhookPayload, configuration adapter.Configuration, queueAdapter adapter.Adapter) (error, string, int) {
-	retries := 0
-	backoffTime := initialBackoff
-	var requestError error
+// waitLeased waits until retryAt. The lease of the message is extended meanwhile, so the broker
+// doesn't deliver it to another instance, where it would overtake its followers. It returns false
+// when the context is cancelled first.
+func waitLeased(ctx context.Context, payload adapter.WebhookPayload, retryAt time.Time, queueAdapter adapter.Adapter) bool {
+	extender, leased := queueAdapter.(adapter.LeaseExtender)
 
-	created := time.Now().String()
+	for {
+		wait := time.Until(retryAt)
+		if wait <= 0 {
+			return true
+		}
+		if leased && wait > leaseRenewal {
+			wait = leaseRenewal
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return false
+		}
+
+		if leased && time.Now().Before(retryAt) {
+			if err := extender.ExtendLease(ctx, payload); err != nil {
+				logging.WebhookLogger(logging.WarningType, fmt.Errorf("error extending lease: WebhookID : %s: %s", payload.WebhookID, err))
+			}
+		}
+	}
+}
+
+// duplicate checks a webhook read for the first time against the deduplication window. A
+// duplicate is acknowledged with a "duplicate" status instead of being delivered. The check fails
+// open: when the store can't be reached, the webhook is delivered.
+func (w *Worker) duplicate(ctx context.Context, payload *adapter.WebhookPayload, created string, queueAdapter adapter.Adapter) bool {
+	if payload.Accepted != "" {
+		return false
+	}
+	payload.Accepted = time.Now().UTC().Format(time.RFC3339)
+
+	if w.deduplicator == nil {
+		return false
+	}
+
+	isDuplicate, err := w.deduplicator.Duplicate(ctx, *payload)
+	if err != nil {
+		logging.WebhookLogger(logging.WarningType, fmt.Errorf("error checking duplicates: WebhookID : %s: %s", payload.WebhookID, err))
+		return false
+	}
+	if !isDuplicate {
+		return false
+	}
+
+	logging.WebhookLogger(logging.EventType, fmt.Sprintf("duplicate suppressed. WebhookID : %s", payload.WebhookID))
+
+	err = queueAdapter.PublishStatus(ctx, payload.WebhookID, payload.URL, created, "", "duplicate", "", SizeofMap(payload.Data), 0)
+	if err != nil {
+		logging.WebhookLogger(logging.WarningType, fmt.Errorf("error publishing status update: WebhookID : %s ", payload.WebhookID))
+	}
+
+	acknowledge(ctx, *payload, queueAdapter)
+	return true
+}
+
+// attempt makes a delivery attempt, unless the webhook must wait. A failed attempt is recorded in
+// the payload. When the webhook isn't done, attempt returns when to try again.
+func (w *Worker) attempt(ctx context.Context, payload *adapter.WebhookPayload, created string, queueAdapter adapter.Adapter) (attemptResult, time.Time, error) {
+	if payload.Expired(time.Now()) {
+		expire(ctx, *payload, created, queueAdapter)
+		return done, time.Time{}, nil
+	}
+
+	if cancelled(ctx, *payload, queueAdapter) {
+		return done, time.Time{}, nil
+	}
+
+	// A webhook enqueued for later waits until it's due.
+	payload.ResolveDelay(time.Now())
+	if deliverAt, later := payload.DeliverLater(time.Now()); later {
+		return postponed, deliverAt, nil
+	}
+
+	if w.disabled != nil && w.disabled.disabled(payload.URL) {
+		deadLetter(ctx, *payload, errors.New("endpoint disabled after a 410 Gone response"), created, queueAdapter)
+		return done, time.Time{}, nil
+	}
+
+	if w.slots != nil {
+		release, ok := w.slots.tryAcquireDestination(payload.URL)
+		if !ok {
+			return postponed, time.Now().Add(busyEndpointDelay), nil
+		}
+		defer release()
+	}
+
+	// Over the rate limit, the webhook is delayed without counting an attempt, until the token it
+	// reserved is due. It then uses that token.
+	if payload.RateLimitReserved {
+		payload.RateLimitReserved = false
+	} else if delay := w.rateLimitDelay(ctx, *payload); delay > 0 {
+		payload.RateLimitReserved = true
+		return postponed, time.Now().Add(delay), nil
+	}
+
+	// While the circuit of the endpoint is open, the webhook is parked without counting an attempt.
+	if w.breakers != nil {
+		allowed, retryAt, halfOpened := w.breakers.allow(payload.URL)
+		if !allowed {
+			return postponed, retryAt, nil
+		}
+		if halfOpened {
+			circuitChanged(ctx, *payload, circuitHalfOpen, "", created, queueAdapter)
+		}
+	}
+
+	err := sender.SendWebhook(payload.Data, payload.URL, payload.WebhookID, payload.IdempotencyKeyOrID(), payload.SecretHash, w.configuration)
 
-	for retries < maxRetries {
-		err := sender.SendWebhook(payload.Data, payload.URL, payload.WebhookID, payload.SecretHash, configuration)
+	var deliveryErr *sender.DeliveryError
+	errors.As(err, &deliveryErr)
 
-		if err == nil {
+	if w.breakers != nil {
+		// A webhook rejected permanently reached a working endpoint.
+		reached := err == nil || (deliveryErr != nil && deliveryErr.Permanent)
+		if state, changed := w.breakers.record(payload.URL, reached); changed {
+			deliveryError := ""
 			if err != nil {
-				logging.WebhookLogger(logging.WarningType, fmt.Errorf("error publishing status update WebhookID : %s ", payload.
-					WebhookID))
+				deliveryError = err.Error()
 			}
-			// Break the loop if the request has been delivered successfully.
-			requestError = nil
-			break
+			circuitChanged(ctx, *payload, state, deliveryError, created, queueAdapter)
+		}
+	}
+
+	if err == nil {
+		delivered := time.Now().String()
+
+		err := queueAdapter.PublishStatus(ctx, payload.WebhookID, payload.URL, created, delivered, "success", "", SizeofMap(payload.Data), len(payload.Attempts)+1)
+		if err != nil {
+			logging.WebhookLogger(logging.WarningType, fmt.Errorf("error publishing status update: WebhookID : %s ", payload.WebhookID))
+		}
+
+		acknowledge(ctx, *payload, queueAdapter)
+		return done, time.Time{}, nil
+	}
+
+	logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error sending sendhooks: %s", err))
+
+	payload.Attempts = append(payload.Attempts, adapter.DeliveryAttempt{
+		Attempted: time.Now().UTC().Format(time.RFC3339),
+		Error:     err.Error(),
+	})
+
+	if deliveryErr != nil && deliveryErr.Gone && w.disabled != nil && w.disabled.disable(payload.URL) {
+		logging.WebhookLogger(logging.EventType, fmt.Sprintf("endpoint of %s disabled after a 410 Gone response. WebhookID : %s", payload.URL, payload.WebhookID))
+
+		err := queueAdapter.PublishStatus(ctx, payload.WebhookID, payload.URL, created, "", "endpoint_disabled", deliveryErr.Error(), SizeofMap(payload.Data), len(payload.Attempts))
+		if err != nil {
+			logging.WebhookLogger(logging.WarningType, fmt.Errorf("error publishing status update: WebhookID : %s ", payload.WebhookID))
 		}
+	}
+
+	if deliveryErr != nil && deliveryErr.Permanent {
+		logging.WebhookLogger(logging.WarningType, fmt.Errorf("webhook rejected permanently with status %d. WebhookID : %s", deliveryErr.StatusCode, payload.WebhookID))
+		deadLetter(ctx, *payload, err, created, queueAdapter)
+		return done, time.Time{}, nil
+	}
 
-		logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error sending sendhooks: %s", err))
+	retries := len(payload.Attempts)
+	policy := retryPolicyFor(w.configuration, *payload)
 
-		backoffTime = calculateBackoff(backoffTime)
-		retries++
-		requestError = err
-		time.Sleep(backoffTime)
+	// The delay asked by the receiver replaces the one of the policy, up to its longest delay.
+	delay := policy.delay(retries)
+	if deliveryErr != nil && deliveryErr.RetryAfter > 0 {
+		delay = deliveryErr.RetryAfter
+		if delay > policy.longestDelay() {
+			delay = policy.longestDelay()
+		}
 	}
+	retryAt := time.Now().Add(delay)
 
-	logging.WebhookLogger(logging.WarningType, fmt.Errorf("maximum retries reached: %d", retries))
+	// A webhook which would expire before its retry isn't retried.
+	if payload.Expired(retryAt) {
+		expire(ctx, *payload, created, queueAdapter)
+		return done, time.Time{}, nil
+	}
 
-	if requestError != nil {
-		return requestError, created, retries
+	if policy.exhausted(retries, payload.Accepted, retryAt) {
+		logging.WebhookLogger(logging.WarningType, fmt.Errorf("failed to send sendhooks after maximum retries. WebhookID : %s", payload.WebhookID))
+		deadLetter(ctx, *payload, err, created, queueAdapter)
+		return done, time.Time{}, nil
 	}
 
-	delivered := time.Now().String()
+	return failed, retryAt, err
+}
+
+// expire acknowledges a webhook past its expiry time and publishes the "expired" status.
+func expire(ctx context.Context, payload adapter.WebhookPayload, created string, queueAdapter adapter.Adapter) {
+	logging.WebhookLogger(logging.EventType, fmt.Sprintf("webhook expired at %s. WebhookID : %s", payload.ExpiresAt, payload.WebhookID))
+
+	deliveryError := ""
+	if len(payload.Attempts) > 0 {
+		deliveryError = payload.Attempts[len(payload.Attempts)-1].Error
+	}
 
-	err := queueAdapter.PublishStatus(context, payload.WebhookID, payload.URL, created, delivered, "success", "", SizeofMap(payload.Data), retries)
+	err := queueAdapter.PublishStatus(ctx, payload.WebhookID, payload.URL, created, "", "expired", deliveryError, SizeofMap(payload.Data), len(payload.Attempts))
 	if err != nil {
 		logging.WebhookLogger(logging.WarningType, fmt.Errorf("error publishing status update: WebhookID : %s ", payload.WebhookID))
 	}
 
-	return nil, "", retries
+	acknowledge(ctx, payload, queueAdapter)
+}
+
+// cancelled acknowledges the webhook when it was cancelled. The "cancelled" status was published
+// by the cancellation. When the adapter can't tell, the webhook is sent.
+func cancelled(ctx context.Context, payload adapter.WebhookPayload, queueAdapter adapter.Adapter) bool {
+	canceller, ok := queueAdapter.(adapter.Canceller)
+	if !ok {
+		return false
+	}
+
+	isCancelled, err := canceller.WebhookCancelled(ctx, payload.WebhookID)
+	if err != nil {
+		logging.WebhookLogger(logging.WarningType, fmt.Errorf("error checking cancellation: WebhookID : %s: %s", payload.WebhookID, err))
+		return false
+	}
+	if !isCancelled {
+		return false
+	}
+
+	logging.WebhookLogger(logging.EventType, fmt.Sprintf("cancelled webhook dropped. WebhookID : %s", payload.WebhookID))
+
+	acknowledge(ctx, payload, queueAdapter)
+	return true
+}
+
+// deadLetter moves a webhook that reached a terminal failure to the dead-letter queue, where it's
+// kept until it's replayed or purged, and publishes its "failed" status.
+func deadLetter(ctx context.Context, payload adapter.WebhookPayload, deliveryErr error, created string, queueAdapter adapter.Adapter) {
+	if err := queueAdapter.DeadLetter(ctx, payload, deliveryErr.Error()); err != nil {
+		logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error moving webhook to the dead-letter queue: WebhookID : %s: %s", payload.WebhookID, err))
+	}
+
+	err := queueAdapter.PublishStatus(ctx, payload.WebhookID, payload.URL, created, "", "failed", deliveryErr.Error(), SizeofMap(payload.Data), len(payload.Attempts))
+	if err != nil {
+		logging.WebhookLogger(logging.WarningType, fmt.Errorf("error publishing status update: WebhookID : %s ", payload.WebhookID))
+	}
+}
+
+// retrying logs and publishes the retry of a failed attempt.
+func retrying(ctx context.Context, payload adapter.WebhookPayload, retryAt time.Time, deliveryErr error, created string, queueAdapter adapter.Adapter) {
+	retries := len(payload.Attempts)
+	logging.WebhookLogger(logging.EventType, fmt.Sprintf("retry %d scheduled at %s. WebhookID : %s", retries, retryAt.Format(time.RFC3339), payload.WebhookID))
+
+	err := queueAdapter.PublishStatus(ctx, payload.WebhookID, payload.URL, created, "", "retrying", deliveryErr.Error(), SizeofMap(payload.Data), retries)
+	if err != nil {
+		logging.WebhookLogger(logging.WarningType, fmt.Errorf("error publishing status update: WebhookID : %s ", payload.WebhookID))
+	}
+}
+
+// postpone sends the webhook back to the broker until the given time, without counting an attempt.
+func postpone(ctx context.Context, payload adapter.WebhookPayload, until time.Time, queueAdapter adapter.Adapter) {
+	if err := queueAdapter.ScheduleRetry(ctx, payload, until); err != nil {
+		// The message isn't acknowledged, so it will be reclaimed and sent later.
+		logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error postponing delivery: WebhookID : %s: %s", payload.WebhookID, err))
+	}
+}
+
+// rateLimitDelay reserves a token for the webhook in the rate limiter of its destination, and
+// returns how long to delay the webhook until the token is due. The webhook is sent when the
+// limiter fails.
+func (w *Worker) rateLimitDelay(ctx context.Context, payload adapter.WebhookPayload) time.Duration {
+	if w.limiter == nil {
+		return 0
+	}
+
+	delay, err := w.limiter.Take(ctx, payload.URL)
+	if err != nil {
+		logging.WebhookLogger(logging.WarningType, fmt.Errorf("error checking the rate limit: WebhookID : %s: %s", payload.WebhookID, err))
+		return 0
+	}
+
+	return delay
+}
+
+// circuitChanged logs and publishes a transition of the circuit of the webhook endpoint.
+func circuitChanged(ctx context.Context, payload adapter.WebhookPayload, state circuitState, deliveryError string, created string, queueAdapter adapter.Adapter) {
+	logging.WebhookLogger(logging.EventType, fmt.Sprintf("circuit of %s is now %s. WebhookID : %s", payload.URL, state.status(), payload.WebhookID))
+
+	err := queueAdapter.PublishStatus(ctx, payload.WebhookID, payload.URL, created, "", state.status(), deliveryError, SizeofMap(payload.Data), len(payload.Attempts))
+	if err != nil {
+		logging.WebhookLogger(logging.WarningType, fmt.Errorf("error publishing status update: WebhookID : %s ", payload.WebhookID))
+	}
+}
+
+func acknowledge(ctx context.Context, payload adapter.WebhookPayload, queueAdapter adapter.Adapter) {
+	if err := queueAdapter.Acknowledge(ctx, payload); err != nil {
+		logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error acknowledging message %s: WebhookID : %s: %s", payload.MessageID, payload.WebhookID, err))
+	}
 }
@@ -0,0 +1,556 @@
+package queue
+
+/*
+These tests check the outcome of a delivery attempt: an acknowledgement on success, a retry scheduled in the
+broker on failure, and the dead-letter queue after the last attempt.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"sendhooks/adapter"
+	localadapter "sendhooks/adapter/local_adapter"
+	"sendhooks/dedupe"
+	"sendhooks/logging"
+	"sendhooks/ratelimit"
+	"sendhooks/sender"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockAdapter struct {
+	mu           sync.Mutex
+	statuses     []string
+	acknowledged []adapter.WebhookPayload
+	retries      []adapter.WebhookPayload
+	retryAt      []time.Time
+	deadLetters  []adapter.WebhookPayload
+}
+
+func (m *mockAdapter) Connect() error { return nil }
+
+func (m *mockAdapter) SubscribeToQueue(ctx context.Context, queue chan<- adapter.WebhookPayload) error {
+	return nil
+}
+
+func (m *mockAdapter) PublishStatus(ctx context.Context, webhookID, url, created, delivered, status, deliveryError string, payloadSize int, numberOfTries int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.statuses = append(m.statuses, status)
+	return nil
+}
+
+func (m *mockAdapter) Acknowledge(ctx context.Context, payload adapter.WebhookPayload) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.acknowledged = append(m.acknowledged, payload)
+	return nil
+}
+
+func (m *mockAdapter) ScheduleRetry(ctx context.Context, payload adapter.WebhookPayload, retryAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retries = append(m.retries, payload)
+	m.retryAt = append(m.retryAt, retryAt)
+	return nil
+}
+
+func (m *mockAdapter) DeadLetter(ctx context.Context, payload adapter.WebhookPayload, lastError string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deadLetters = append(m.deadLetters, payload)
+	return nil
+}
+
+// cancellingAdapter is a mockAdapter which can cancel webhooks.
+type cancellingAdapter struct {
+	mockAdapter
+	cancelled map[string]bool
+}
+
+func (c *cancellingAdapter) CancelWebhook(ctx context.Context, webhookID string) (string, error) {
+	c.cancelled[webhookID] = true
+	return "", nil
+}
+
+func (c *cancellingAdapter) WebhookCancelled(ctx context.Context, webhookID string) (bool, error) {
+	return c.cancelled[webhookID], nil
+}
+
+// leasingAdapter is a mockAdapter whose messages are leased.
+type leasingAdapter struct {
+	mockAdapter
+	extended int
+}
+
+func (l *leasingAdapter) ExtendLease(ctx context.Context, payload adapter.WebhookPayload) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.extended++
+	return nil
+}
+
+func newTestServer(statusCode int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statusCode)
+	}))
+}
+
+func TestSendWebhookWithRetries(t *testing.T) {
+	logging.WebhookLogger = func(errorType string, message interface{}) error {
+		return nil
+	}
+
+	t.Run("Successful delivery is acknowledged", func(t *testing.T) {
+		server := newTestServer(http.StatusOK)
+		defer server.Close()
+
+		worker := &Worker{}
+		queueAdapter := &mockAdapter{}
+		worker.sendWebhookWithRetries(context.Background(), adapter.WebhookPayload{URL: server.URL, WebhookID: "webhook-1"}, queueAdapter)
+
+		assert.Equal(t, []string{"success"}, queueAdapter.statuses)
+		assert.Len(t, queueAdapter.acknowledged, 1)
+		assert.Empty(t, queueAdapter.retries)
+	})
+
+	t.Run("Failed delivery schedules a retry", func(t *testing.T) {
+		server := newTestServer(http.StatusInternalServerError)
+		defer server.Close()
+
+		worker := &Worker{}
+		queueAdapter := &mockAdapter{}
+		before := time.Now()
+		worker.sendWebhookWithRetries(context.Background(), adapter.WebhookPayload{URL: server.URL, WebhookID: "webhook-1"}, queueAdapter)
+
+		assert.Equal(t, []string{"retrying"}, queueAdapter.statuses)
+		assert.Empty(t, queueAdapter.acknowledged)
+		assert.Len(t, queueAdapter.retries, 1)
+		assert.Len(t, queueAdapter.retries[0].Attempts, 1)
+		assert.True(t, queueAdapter.retryAt[0].After(before.Add(initialBackoff)))
+	})
+
+	t.Run("Last failed attempt is dead-lettered", func(t *testing.T) {
+		server := newTestServer(http.StatusInternalServerError)
+		defer server.Close()
+
+		payload := adapter.WebhookPayload{URL: server.URL, WebhookID: "webhook-1"}
+		for i := 0; i < maxRetries-1; i++ {
+			payload.Attempts = append(payload.Attempts, adapter.DeliveryAttempt{Error: "failed"})
+		}
+
+		worker := &Worker{}
+		queueAdapter := &mockAdapter{}
+		worker.sendWebhookWithRetries(context.Background(), payload, queueAdapter)
+
+		assert.Equal(t, []string{"failed"}, queueAdapter.statuses)
+		assert.Empty(t, queueAdapter.acknowledged)
+		assert.Empty(t, queueAdapter.retries)
+		assert.Len(t, queueAdapter.deadLetters, 1)
+		assert.Len(t, queueAdapter.deadLetters[0].Attempts, maxRetries)
+	})
+
+	t.Run("Retry policy of the endpoint is applied", func(t *testing.T) {
+		server := newTestServer(http.StatusInternalServerError)
+		defer server.Close()
+
+		configuration := adapter.Configuration{
+			RetryPolicies: []adapter.RetryPolicyConfig{
+				{RetryPolicyName: "once", RetryPolicyStrategy: "fixed", RetryPolicyInitialBackoff: 60, RetryPolicyMaxAttempts: 2},
+			},
+			Endpoints: []adapter.EndpointConfig{{EndpointUrl: server.URL, EndpointRetryPolicy: "once"}},
+		}
+
+		worker := &Worker{configuration: configuration}
+		queueAdapter := &mockAdapter{}
+		before := time.Now()
+		worker.sendWebhookWithRetries(context.Background(), adapter.WebhookPayload{URL: server.URL, WebhookID: "webhook-1"}, queueAdapter)
+
+		assert.Len(t, queueAdapter.retries, 1)
+		assert.True(t, queueAdapter.retryAt[0].After(before.Add(59*time.Second)))
+
+		worker.sendWebhookWithRetries(context.Background(), queueAdapter.retries[0], queueAdapter)
+
+		assert.Equal(t, []string{"retrying", "failed"}, queueAdapter.statuses)
+		assert.Len(t, queueAdapter.deadLetters, 1)
+	})
+
+	t.Run("Redriven webhook gets a new max age", func(t *testing.T) {
+		server := newTestServer(http.StatusInternalServerError)
+		defer server.Close()
+
+		configuration := adapter.Configuration{
+			RetryPolicies: []adapter.RetryPolicyConfig{
+				{RetryPolicyName: "hour", RetryPolicyMaxAttempts: 100, RetryPolicyMaxAge: 3600},
+			},
+			Endpoints: []adapter.EndpointConfig{{EndpointUrl: server.URL, EndpointRetryPolicy: "hour"}},
+		}
+
+		localAdapter := localadapter.NewLocalAdapter(adapter.Configuration{
+			Local:       adapter.LocalConfig{LocalPath: filepath.Join(t.TempDir(), "sendhooks.db")},
+			ChannelSize: 1,
+		})
+		assert.NoError(t, localAdapter.Connect())
+		defer localAdapter.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		accepted := time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+		_, err := localAdapter.Enqueue(ctx, adapter.WebhookPayload{URL: server.URL, WebhookID: "webhook-1", Accepted: accepted})
+		assert.NoError(t, err)
+
+		queue := make(chan adapter.WebhookPayload, 1)
+		go localAdapter.SubscribeToQueue(ctx, queue)
+
+		// Past its max age, the webhook is dead-lettered.
+		worker := &Worker{configuration: configuration}
+		worker.sendWebhookWithRetries(ctx, <-queue, localAdapter)
+
+		deadLetters, err := localAdapter.ListDeadLetters(ctx, adapter.DeadLetterFilter{})
+		assert.NoError(t, err)
+		assert.Len(t, deadLetters, 1)
+
+		// Once redriven, its max age counts from the redrive, so it's retried.
+		redriven, err := localAdapter.RedriveDeadLetters(ctx, adapter.DeadLetterFilter{})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, redriven)
+		worker.sendWebhookWithRetries(ctx, <-queue, localAdapter)
+
+		deadLetters, err = localAdapter.ListDeadLetters(ctx, adapter.DeadLetterFilter{})
+		assert.NoError(t, err)
+		assert.Empty(t, deadLetters)
+
+		statuses, err := localAdapter.ListStatuses(ctx, "webhook-1")
+		assert.NoError(t, err)
+		assert.Equal(t, "retrying", statuses[len(statuses)-1].Status)
+	})
+
+	t.Run("Any 2xx response is a success", func(t *testing.T) {
+		server := newTestServer(http.StatusAccepted)
+		defer server.Close()
+
+		worker := &Worker{}
+		queueAdapter := &mockAdapter{}
+		worker.sendWebhookWithRetries(context.Background(), adapter.WebhookPayload{URL: server.URL, WebhookID: "webhook-1"}, queueAdapter)
+
+		assert.Equal(t, []string{"success"}, queueAdapter.statuses)
+		assert.Len(t, queueAdapter.acknowledged, 1)
+	})
+
+	t.Run("Client error is dead-lettered without retry", func(t *testing.T) {
+		server := newTestServer(http.StatusBadRequest)
+		defer server.Close()
+
+		worker := &Worker{}
+		queueAdapter := &mockAdapter{}
+		worker.sendWebhookWithRetries(context.Background(), adapter.WebhookPayload{URL: server.URL, WebhookID: "webhook-1"}, queueAdapter)
+
+		assert.Equal(t, []string{"failed"}, queueAdapter.statuses)
+		assert.Empty(t, queueAdapter.retries)
+		assert.Len(t, queueAdapter.deadLetters, 1)
+		assert.Len(t, queueAdapter.deadLetters[0].Attempts, 1)
+	})
+
+	t.Run("Retry-After replaces the backoff", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+
+		worker := &Worker{}
+		queueAdapter := &mockAdapter{}
+		before := time.Now()
+		worker.sendWebhookWithRetries(context.Background(), adapter.WebhookPayload{URL: server.URL, WebhookID: "webhook-1"}, queueAdapter)
+
+		assert.Equal(t, []string{"retrying"}, queueAdapter.statuses)
+		assert.Len(t, queueAdapter.retries, 1)
+		assert.WithinDuration(t, before.Add(2*time.Minute), queueAdapter.retryAt[0], time.Second)
+	})
+
+	t.Run("Retry-After is capped at the longest delay of the policy", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "86400")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		configuration := adapter.Configuration{
+			RetryPolicies: []adapter.RetryPolicyConfig{
+				{RetryPolicyName: "patient", RetryPolicyStrategy: "schedule", RetryPolicySchedule: []string{"1m", "2h"}},
+			},
+			Endpoints: []adapter.EndpointConfig{{EndpointUrl: server.URL, EndpointRetryPolicy: "patient"}},
+		}
+
+		// The schedule waits longer than the maximum backoff.
+		worker := &Worker{configuration: configuration}
+		queueAdapter := &mockAdapter{}
+		before := time.Now()
+		worker.sendWebhookWithRetries(context.Background(), adapter.WebhookPayload{URL: server.URL, WebhookID: "webhook-1"}, queueAdapter)
+
+		assert.Len(t, queueAdapter.retries, 1)
+		assert.WithinDuration(t, before.Add(2*time.Hour), queueAdapter.retryAt[0], time.Second)
+
+		// The other strategies are capped at the maximum backoff.
+		worker = &Worker{}
+		before = time.Now()
+		worker.sendWebhookWithRetries(context.Background(), adapter.WebhookPayload{URL: server.URL, WebhookID: "webhook-2"}, queueAdapter)
+
+		assert.Len(t, queueAdapter.retries, 2)
+		assert.WithinDuration(t, before.Add(maxBackoff), queueAdapter.retryAt[1], time.Second)
+	})
+
+	t.Run("Gone disables the endpoint", func(t *testing.T) {
+		server := newTestServer(http.StatusGone)
+		defer server.Close()
+
+		worker := &Worker{disabled: newDisabledEndpoints(adapter.Configuration{})}
+		queueAdapter := &mockAdapter{}
+		worker.sendWebhookWithRetries(context.Background(), adapter.WebhookPayload{URL: server.URL, WebhookID: "webhook-1"}, queueAdapter)
+		worker.sendWebhookWithRetries(context.Background(), adapter.WebhookPayload{URL: server.URL, WebhookID: "webhook-2"}, queueAdapter)
+
+		assert.Equal(t, []string{"endpoint_disabled", "failed", "failed"}, queueAdapter.statuses)
+		assert.Len(t, queueAdapter.deadLetters, 2)
+		// The second webhook was not sent.
+		assert.Empty(t, queueAdapter.deadLetters[1].Attempts)
+	})
+
+	t.Run("Delayed delivery waits in the broker", func(t *testing.T) {
+		server := newTestServer(http.StatusOK)
+		defer server.Close()
+
+		deliverAt := time.Now().Add(time.Hour).Truncate(time.Second)
+		payload := adapter.WebhookPayload{URL: server.URL, WebhookID: "webhook-1", DeliverAt: deliverAt.Format(time.RFC3339)}
+
+		worker := &Worker{}
+		queueAdapter := &mockAdapter{}
+		worker.sendWebhookWithRetries(context.Background(), payload, queueAdapter)
+
+		assert.Empty(t, queueAdapter.statuses)
+		assert.Len(t, queueAdapter.retries, 1)
+		assert.Empty(t, queueAdapter.retries[0].Attempts)
+		assert.True(t, deliverAt.Equal(queueAdapter.retryAt[0]))
+
+		// Once due, the webhook is sent.
+		payload.DeliverAt = time.Now().Add(-time.Second).Format(time.RFC3339)
+		worker.sendWebhookWithRetries(context.Background(), payload, queueAdapter)
+		assert.Equal(t, []string{"success"}, queueAdapter.statuses)
+	})
+
+	t.Run("Expired webhook is acknowledged without delivery", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+		}))
+		defer server.Close()
+
+		payload := adapter.WebhookPayload{URL: server.URL, WebhookID: "webhook-1", ExpiresAt: time.Now().Add(-time.Second).Format(time.RFC3339)}
+
+		worker := &Worker{}
+		queueAdapter := &mockAdapter{}
+		worker.sendWebhookWithRetries(context.Background(), payload, queueAdapter)
+
+		assert.Zero(t, requests)
+		assert.Equal(t, []string{"expired"}, queueAdapter.statuses)
+		assert.Len(t, queueAdapter.acknowledged, 1)
+	})
+
+	t.Run("Webhook expiring before its retry is not retried", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		payload := adapter.WebhookPayload{URL: server.URL, WebhookID: "webhook-1", ExpiresAt: time.Now().Add(time.Minute).Format(time.RFC3339)}
+
+		worker := &Worker{}
+		queueAdapter := &mockAdapter{}
+		worker.sendWebhookWithRetries(context.Background(), payload, queueAdapter)
+
+		assert.Equal(t, 1, requests)
+		assert.Equal(t, []string{"expired"}, queueAdapter.statuses)
+		assert.Len(t, queueAdapter.acknowledged, 1)
+		assert.Empty(t, queueAdapter.retries)
+		assert.Empty(t, queueAdapter.deadLetters)
+	})
+
+	t.Run("Cancelled webhook is acknowledged without delivery", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+		}))
+		defer server.Close()
+
+		worker := &Worker{}
+		queueAdapter := &cancellingAdapter{cancelled: map[string]bool{}}
+		assert.NoError(t, adapter.Cancel(context.Background(), queueAdapter, "webhook-1"))
+
+		worker.sendWebhookWithRetries(context.Background(), adapter.WebhookPayload{URL: server.URL, WebhookID: "webhook-1"}, queueAdapter)
+		worker.sendWebhookWithRetries(context.Background(), adapter.WebhookPayload{URL: server.URL, WebhookID: "webhook-2"}, queueAdapter)
+
+		assert.Equal(t, 1, requests)
+		assert.Equal(t, []string{"cancelled", "success"}, queueAdapter.statuses)
+		assert.Len(t, queueAdapter.acknowledged, 2)
+	})
+
+	t.Run("Over the rate limit, delivery is delayed", func(t *testing.T) {
+		server := newTestServer(http.StatusOK)
+		defer server.Close()
+
+		configuration := adapter.Configuration{RateLimit: adapter.RateLimitConfig{RateLimitPerSecond: 1}}
+
+		worker := &Worker{configuration: configuration, limiter: ratelimit.NewLimiterWithStore(configuration, ratelimit.NewMemoryStore())}
+		queueAdapter := &mockAdapter{}
+		worker.sendWebhookWithRetries(context.Background(), adapter.WebhookPayload{URL: server.URL, WebhookID: "webhook-1"}, queueAdapter)
+		worker.sendWebhookWithRetries(context.Background(), adapter.WebhookPayload{URL: server.URL, WebhookID: "webhook-2"}, queueAdapter)
+
+		assert.Equal(t, []string{"success"}, queueAdapter.statuses)
+		assert.Len(t, queueAdapter.retries, 1)
+		assert.Equal(t, "webhook-2", queueAdapter.retries[0].WebhookID)
+		assert.Empty(t, queueAdapter.retries[0].Attempts)
+		assert.True(t, queueAdapter.retries[0].RateLimitReserved)
+
+		// The postponed webhook uses the token it reserved, and isn't postponed again.
+		worker.sendWebhookWithRetries(context.Background(), queueAdapter.retries[0], queueAdapter)
+		assert.Equal(t, []string{"success", "success"}, queueAdapter.statuses)
+		assert.Len(t, queueAdapter.retries, 1)
+	})
+
+	t.Run("Busy destination delays delivery", func(t *testing.T) {
+		server := newTestServer(http.StatusOK)
+		defer server.Close()
+
+		configuration := adapter.Configuration{MaxInFlightPerHost: 1}
+
+		worker := &Worker{configuration: configuration, slots: newInFlight(configuration)}
+		release, _ := worker.slots.tryAcquireDestination(server.URL)
+		defer release()
+
+		queueAdapter := &mockAdapter{}
+		worker.sendWebhookWithRetries(context.Background(), adapter.WebhookPayload{URL: server.URL, WebhookID: "webhook-1"}, queueAdapter)
+
+		assert.Empty(t, queueAdapter.statuses)
+		assert.Len(t, queueAdapter.retries, 1)
+		assert.Empty(t, queueAdapter.retries[0].Attempts)
+	})
+
+	t.Run("Duplicate is acknowledged without delivery", func(t *testing.T) {
+		var keys []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			keys = append(keys, r.Header.Get(sender.IdempotencyKeyHeader))
+		}))
+		defer server.Close()
+
+		worker := &Worker{deduplicator: dedupe.NewDeduplicatorWithStore(dedupe.NewMemoryStore(), time.Minute)}
+		queueAdapter := &mockAdapter{}
+		payload := adapter.WebhookPayload{URL: server.URL, WebhookID: "webhook-1", IdempotencyKey: "order-42", MessageID: "1-0"}
+		worker.sendWebhookWithRetries(context.Background(), payload, queueAdapter)
+
+		// The producer enqueued the webhook again.
+		payload.MessageID = "2-0"
+		worker.sendWebhookWithRetries(context.Background(), payload, queueAdapter)
+
+		assert.Equal(t, []string{"order-42"}, keys)
+		assert.Equal(t, []string{"success", "duplicate"}, queueAdapter.statuses)
+		assert.Len(t, queueAdapter.acknowledged, 2)
+	})
+
+	t.Run("Open circuit parks delivery", func(t *testing.T) {
+		server := newTestServer(http.StatusInternalServerError)
+		defer server.Close()
+
+		configuration := adapter.Configuration{
+			CircuitBreaker: adapter.CircuitBreakerConfig{CircuitBreakerFailureRatio: 1, CircuitBreakerMinRequests: 1},
+		}
+
+		worker := &Worker{configuration: configuration, breakers: newCircuitBreakers(configuration)}
+		queueAdapter := &mockAdapter{}
+		worker.sendWebhookWithRetries(context.Background(), adapter.WebhookPayload{URL: server.URL, WebhookID: "webhook-1"}, queueAdapter)
+		worker.sendWebhookWithRetries(context.Background(), adapter.WebhookPayload{URL: server.URL, WebhookID: "webhook-2"}, queueAdapter)
+
+		// The failure opens the circuit, then the next webhook is parked without an attempt.
+		assert.Equal(t, []string{"circuit_open", "retrying"}, queueAdapter.statuses)
+		assert.Len(t, queueAdapter.retries, 2)
+		assert.Equal(t, "webhook-2", queueAdapter.retries[1].WebhookID)
+		assert.Empty(t, queueAdapter.retries[1].Attempts)
+	})
+}
+
+func TestSendInOrder(t *testing.T) {
+	logging.WebhookLogger = func(errorType string, message interface{}) error {
+		return nil
+	}
+
+	t.Run("A failing webhook blocks the followers of its key", func(t *testing.T) {
+		var mu sync.Mutex
+		var received []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var data map[string]interface{}
+			_ = json.NewDecoder(r.Body).Decode(&data)
+
+			mu.Lock()
+			defer mu.Unlock()
+			received = append(received, data["event"].(string))
+			if len(received) == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}))
+		defer server.Close()
+
+		first := adapter.WebhookPayload{
+			URL:         server.URL,
+			WebhookID:   "webhook-1",
+			Data:        map[string]interface{}{"event": "created"},
+			OrderingKey: "order-1",
+		}
+		second := adapter.WebhookPayload{
+			URL:         server.URL,
+			WebhookID:   "webhook-2",
+			Data:        map[string]interface{}{"event": "paid"},
+			OrderingKey: "order-1",
+		}
+		worker := &Worker{ordered: newOrderedKeys()}
+		assert.True(t, worker.ordered.push(first))
+		assert.False(t, worker.ordered.push(second))
+
+		queueAdapter := &mockAdapter{}
+		worker.deliverKey(context.Background(), first, queueAdapter)
+
+		// The first webhook was retried in the worker, not in the broker, and its follower was sent
+		// after it.
+		assert.Empty(t, queueAdapter.retries)
+		assert.Equal(t, []string{"created", "created", "paid"}, received)
+		assert.Equal(t, []string{"retrying", "success", "success"}, queueAdapter.statuses)
+		assert.Len(t, queueAdapter.acknowledged, 2)
+
+		// The key is idle again.
+		assert.True(t, worker.ordered.push(second))
+	})
+
+	t.Run("The lease is extended while waiting for the next attempt", func(t *testing.T) {
+		defer func(original time.Duration) { leaseRenewal = original }(leaseRenewal)
+		leaseRenewal = 100 * time.Millisecond
+
+		queueAdapter := &leasingAdapter{}
+		payload := adapter.WebhookPayload{WebhookID: "webhook-1", OrderingKey: "order-1"}
+		assert.True(t, waitLeased(context.Background(), payload, time.Now().Add(350*time.Millisecond), queueAdapter))
+		assert.Equal(t, 3, queueAdapter.extended)
+
+		// A cancelled wait stops extending the lease.
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.False(t, waitLeased(ctx, payload, time.Now().Add(time.Hour), queueAdapter))
+		assert.Equal(t, 3, queueAdapter.extended)
+	})
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+/*
+This package throttles the deliveries with token buckets, one per endpoint with a rate limit, and one per destination
+host otherwise. The buckets are kept in memory, or in Redis to share them between the instances.
+*/
+
+import (
+	"context"
+	"math"
+	"net/url"
+	"time"
+
+	"sendhooks/adapter"
+	"sendhooks/utils"
+)
+
+// Store keeps the token buckets.
+type Store interface {
+	// Take takes a token from the bucket of the key. It returns zero when a token was available,
+	// or how long to wait until the token taken is due. The bucket then goes negative, so the
+	// following requests wait for their own token.
+	Take(ctx context.Context, key string, limit adapter.RateLimitConfig, now time.Time) (time.Duration, error)
+}
+
+// Limiter finds the bucket of a webhook URL.
+type Limiter struct {
+	config adapter.Configuration
+	store  Store
+}
+
+// NewLimiter creates the limiter of the configuration, with the configured store.
+func NewLimiter(config adapter.Configuration) (*Limiter, error) {
+	if config.RateLimitStore != "redis" {
+		return &Limiter{config: config, store: NewMemoryStore()}, nil
+	}
+
+	client, err := utils.NewRedisClient(config.Redis, config.NumWorkers)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Limiter{config: config, store: NewRedisStore(client, "sendhooks:ratelimit:")}, nil
+}
+
+// NewLimiterWithStore creates a limiter keeping its buckets in the store.
+func NewLimiterWithStore(config adapter.Configuration, store Store) *Limiter {
+	return &Limiter{config: config, store: store}
+}
+
+// Take takes a token for a request to the URL. It returns zero when the request can be sent, or
+// how long to delay it. The token is reserved either way, so the delayed request must not take
+// another one.
+func (l *Limiter) Take(ctx context.Context, webhookURL string) (time.Duration, error) {
+	key, limit := l.bucketFor(webhookURL)
+	if limit.RateLimitPerSecond <= 0 {
+		return 0, nil
+	}
+
+	if limit.RateLimitBurst <= 0 {
+		limit.RateLimitBurst = int(math.Ceil(limit.RateLimitPerSecond))
+	}
+
+	return l.store.Take(ctx, key, limit, time.Now())
+}
+
+// bucketFor returns the bucket of the endpoint when it has a rate limit, or the one of the host.
+func (l *Limiter) bucketFor(webhookURL string) (string, adapter.RateLimitConfig) {
+	if endpoint, ok := l.config.EndpointFor(webhookURL); ok && endpoint.EndpointRateLimit.RateLimitPerSecond > 0 {
+		return "endpoint:" + endpoint.EndpointUrl, endpoint.EndpointRateLimit
+	}
+
+	host := webhookURL
+	if parsed, err := url.Parse(webhookURL); err == nil {
+		host = parsed.Host
+	}
+
+	return "host:" + host, l.config.RateLimit
+}
+
+// refill returns the tokens of a bucket after the elapsed time, and how long to wait for the
+// next token when the bucket is empty. The tokens are negative while reserved tokens are not due.
+func refill(tokens float64, elapsed time.Duration, limit adapter.RateLimitConfig) (float64, time.Duration) {
+	tokens = math.Min(float64(limit.RateLimitBurst), tokens+elapsed.Seconds()*limit.RateLimitPerSecond)
+	if tokens >= 1 {
+		return tokens, 0
+	}
+
+	return tokens, time.Duration(math.Ceil((1 - tokens) / limit.RateLimitPerSecond * float64(time.Second)))
+}
@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"sendhooks/adapter"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+// testStore checks that a store lets the burst through, then reserves one token per request.
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+	limit := adapter.RateLimitConfig{RateLimitPerSecond: 2, RateLimitBurst: 3}
+	now := time.Unix(1700000000, 0)
+
+	for i := 0; i < 3; i++ {
+		wait, err := store.Take(ctx, "host:example.com", limit, now)
+		assert.NoError(t, err)
+		assert.Zero(t, wait)
+	}
+
+	// Each request over the limit waits for its own token, a token being added every half second.
+	wait, err := store.Take(ctx, "host:example.com", limit, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	wait, err = store.Take(ctx, "host:example.com", limit, now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, wait)
+
+	// The other buckets are not affected.
+	wait, err = store.Take(ctx, "host:other.com", limit, now)
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+
+	// The reserved tokens are due after a second, the next one half a second later.
+	wait, err = store.Take(ctx, "host:example.com", limit, now.Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	wait, err = store.Take(ctx, "host:example.com", limit, now.Add(2500*time.Millisecond))
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestRedisStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	testStore(t, NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), "sendhooks:ratelimit:"))
+}
+
+func TestLimiter(t *testing.T) {
+	limiter, err := NewLimiter(adapter.Configuration{
+		RateLimit: adapter.RateLimitConfig{RateLimitPerSecond: 1},
+		Endpoints: []adapter.EndpointConfig{
+			{EndpointUrl: "https://example.com/fast", EndpointRateLimit: adapter.RateLimitConfig{RateLimitPerSecond: 100}},
+		},
+	})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	// The host limit is shared by the URLs of the host.
+	wait, err := limiter.Take(ctx, "https://example.com/a")
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+
+	wait, err = limiter.Take(ctx, "https://example.com/b")
+	assert.NoError(t, err)
+	assert.Positive(t, wait)
+
+	// The endpoint limit replaces the host one.
+	wait, err = limiter.Take(ctx, "https://example.com/fast/hooks")
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+
+	// Without a limit, nothing is throttled.
+	limiter, err = NewLimiter(adapter.Configuration{})
+	assert.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		wait, err = limiter.Take(ctx, "https://example.com/a")
+		assert.NoError(t, err)
+		assert.Zero(t, wait)
+	}
+}
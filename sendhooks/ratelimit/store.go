@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"sendhooks/adapter"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryStore keeps the buckets of a single instance.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}}
+}
+
+func (m *MemoryStore) Take(ctx context.Context, key string, limit adapter.RateLimitConfig, now time.Time) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.RateLimitBurst), updated: now}
+		m.buckets[key] = b
+	}
+
+	tokens, wait := refill(b.tokens, now.Sub(b.updated), limit)
+	b.updated = now
+	b.tokens = tokens - 1
+
+	return wait, nil
+}
+
+// takeScript refills and takes from a bucket atomically, with the same arithmetic as refill. A
+// bucket expires once it would be full again, after its reserved tokens are due.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local tokens = burst
+local updated = now
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+if bucket[1] then
+	tokens = tonumber(bucket[1])
+	updated = tonumber(bucket[2])
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - updated) / 1000 * rate)
+local wait = 0
+if tokens < 1 then
+	wait = math.ceil((1 - tokens) / rate * 1000)
+end
+tokens = tokens - 1
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+return wait
+`)
+
+// RedisStore keeps the buckets in Redis, shared by all the instances.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore creates a store keeping the buckets in keys starting with the prefix.
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (r *RedisStore) Take(ctx context.Context, key string, limit adapter.RateLimitConfig, now time.Time) (time.Duration, error) {
+	wait, err := takeScript.Run(ctx, r.client, []string{r.prefix + key},
+		strconv.FormatFloat(limit.RateLimitPerSecond, 'f', -1, 64),
+		limit.RateLimitBurst,
+		now.UnixMilli(),
+	).Int64()
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(wait) * time.Millisecond, nil
+}
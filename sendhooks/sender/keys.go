@@ -0,0 +1,233 @@
+package sender
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+	"sendhooks/adapter"
+	"sendhooks/signature"
+	"sort"
+	"sync"
+	"time"
+)
+
+// asymmetricSigningMode signs the webhooks with the configured private keys.
+const asymmetricSigningMode = "asymmetric"
+
+const defaultSigningOverlap = 24 * time.Hour
+
+var (
+	signingKeys   = map[string]crypto.Signer{}
+	signingKeysMu sync.Mutex
+)
+
+// loadSigningKey reads a private key of the asymmetric signing mode. Keys are read once and
+// cached by path.
+var loadSigningKey = func(path string) (crypto.Signer, error) {
+	if path == "" {
+		return nil, errors.New("a private key is required in the asymmetric signing mode")
+	}
+
+	signingKeysMu.Lock()
+	defer signingKeysMu.Unlock()
+
+	if key, ok := signingKeys[path]; ok {
+		return key, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := signature.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key %s: %w", path, err)
+	}
+
+	signingKeys[path] = key
+	return key, nil
+}
+
+// keyVersion is a signing key with the period it signs the webhooks.
+type keyVersion struct {
+	adapter.SigningKeyConfig
+	activeFrom time.Time
+	// retiredAt is zero for the latest version.
+	retiredAt time.Time
+}
+
+// active tells if the version signs the webhooks at the given time.
+func (k keyVersion) active(at time.Time) bool {
+	return !at.Before(k.activeFrom) && (k.retiredAt.IsZero() || at.Before(k.retiredAt))
+}
+
+// keyVersions orders the versions of a key by activation time and computes when each one retires.
+func keyVersions(keys []adapter.SigningKeyConfig, configuration adapter.Configuration) ([]keyVersion, error) {
+	overlap := defaultSigningOverlap
+	if configuration.SigningOverlap > 0 {
+		overlap = time.Duration(configuration.SigningOverlap) * time.Second
+	}
+
+	versions := make([]keyVersion, 0, len(keys))
+	for _, key := range keys {
+		version := keyVersion{SigningKeyConfig: key}
+
+		if key.KeyActiveFrom != "" {
+			activeFrom, err := time.Parse(time.RFC3339, key.KeyActiveFrom)
+			if err != nil {
+				return nil, fmt.Errorf("invalid keyActiveFrom %q: %w", key.KeyActiveFrom, err)
+			}
+			version.activeFrom = activeFrom
+		}
+
+		versions = append(versions, version)
+	}
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].activeFrom.Before(versions[j].activeFrom)
+	})
+
+	for i := 0; i < len(versions)-1; i++ {
+		versions[i].retiredAt = versions[i+1].activeFrom.Add(overlap)
+	}
+
+	return versions, nil
+}
+
+// endpointKeys returns the versions of an endpoint secret. The endpointSecret is the oldest version.
+func endpointKeys(endpoint adapter.EndpointConfig, configuration adapter.Configuration) ([]keyVersion, error) {
+	keys := endpoint.EndpointKeys
+	if endpoint.EndpointSecret != "" {
+		keys = append([]adapter.SigningKeyConfig{{KeySecret: endpoint.EndpointSecret}}, keys...)
+	}
+
+	return keyVersions(keys, configuration)
+}
+
+// asymmetricKeys returns the versions of the asymmetric signing key. The signingPrivateKey is the
+// oldest version.
+func asymmetricKeys(configuration adapter.Configuration) ([]keyVersion, error) {
+	keys := configuration.SigningKeys
+	if configuration.SigningPrivateKey != "" {
+		keys = append([]adapter.SigningKeyConfig{{KeyPrivateKey: configuration.SigningPrivateKey, KeyId: configuration.SigningKeyId}}, keys...)
+	}
+
+	return keyVersions(keys, configuration)
+}
+
+// ValidateSigningKeys checks the signing keys, so that a mistake is reported at startup rather
+// than failing every delivery.
+func ValidateSigningKeys(configuration adapter.Configuration) error {
+	for _, endpoint := range configuration.Endpoints {
+		versions, err := endpointKeys(endpoint, configuration)
+		if err != nil {
+			return fmt.Errorf("endpoint %s: %w", endpoint.EndpointUrl, err)
+		}
+
+		for _, version := range versions {
+			if _, err := signature.DecodeSecret(version.KeySecret); err != nil {
+				return fmt.Errorf("endpoint %s: %w", endpoint.EndpointUrl, err)
+			}
+		}
+	}
+
+	_, err := PublicKeys(configuration)
+	return err
+}
+
+// PublicKeys returns the public keys receivers use to verify the webhooks: the versions signing
+// now and the upcoming ones, so receivers can fetch them before they're used. The set is empty
+// unless the asymmetric signing mode is enabled.
+func PublicKeys(configuration adapter.Configuration) (signature.JWKS, error) {
+	jwks := signature.JWKS{Keys: []signature.JWK{}}
+	if configuration.SigningMode != asymmetricSigningMode {
+		return jwks, nil
+	}
+
+	versions, err := asymmetricKeys(configuration)
+	if err != nil {
+		return jwks, err
+	}
+	if len(versions) == 0 {
+		return jwks, errors.New("signingPrivateKey or signingKeys is required in the asymmetric signing mode")
+	}
+
+	at := now()
+	for _, version := range versions {
+		if !version.retiredAt.IsZero() && !at.Before(version.retiredAt) {
+			continue
+		}
+
+		key, err := loadSigningKey(version.KeyPrivateKey)
+		if err != nil {
+			return jwks, err
+		}
+
+		jwk, err := signature.PublicJWK(version.KeyId, key.Public())
+		if err != nil {
+			return jwks, err
+		}
+
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks, nil
+}
+
+// signatures returns the signatures of a webhook, one per key version active at the timestamp.
+func signatures(url string, webhookId string, timestamp int64, jsonBytes []byte, configuration adapter.Configuration) ([]string, error) {
+	at := time.Unix(timestamp, 0)
+	var signed []string
+
+	if configuration.SigningMode == asymmetricSigningMode {
+		versions, err := asymmetricKeys(configuration)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, version := range versions {
+			if !version.active(at) {
+				continue
+			}
+
+			key, err := loadSigningKey(version.KeyPrivateKey)
+			if err != nil {
+				return nil, err
+			}
+
+			sig, err := signature.SignAsymmetric(key, webhookId, timestamp, jsonBytes)
+			if err != nil {
+				return nil, err
+			}
+			signed = append(signed, sig)
+		}
+
+		return signed, nil
+	}
+
+	endpoint, ok := configuration.EndpointFor(url)
+	if !ok {
+		return nil, nil
+	}
+
+	versions, err := endpointKeys(endpoint, configuration)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, version := range versions {
+		if !version.active(at) || version.KeySecret == "" {
+			continue
+		}
+
+		key, err := signature.DecodeSecret(version.KeySecret)
+		if err != nil {
+			return nil, err
+		}
+		signed = append(signed, signature.Sign(key, webhookId, timestamp, jsonBytes))
+	}
+
+	return signed, nil
+}
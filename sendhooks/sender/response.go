@@ -0,0 +1,88 @@
+package sender
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sendhooks/adapter"
+)
+
+// defaultRetryableStatusCodes are the 4xx status codes retried by default: the receiver timed out,
+// was in a conflicting state or throttled the request.
+var defaultRetryableStatusCodes = []int{http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests}
+
+// DeliveryError is the failure of a webhook rejected by its receiver.
+type DeliveryError struct {
+	StatusCode int
+	Body       string
+	// Permanent tells that the webhook must not be retried.
+	Permanent bool
+	// Gone tells that the endpoint doesn't exist anymore, with a 410 response.
+	Gone bool
+	// RetryAfter is the delay requested by the receiver with a Retry-After header, on a 429 or a
+	// 503 response. It's zero without one.
+	RetryAfter time.Duration
+}
+
+func (e *DeliveryError) Error() string {
+	return fmt.Sprintf("webhook sending failed with status: %d, response body: %s", e.StatusCode, e.Body)
+}
+
+// classifyResponse turns a failed response into a delivery error.
+func classifyResponse(statusCode int, header http.Header, body []byte, configuration adapter.Configuration) *DeliveryError {
+	deliveryErr := &DeliveryError{StatusCode: statusCode, Body: string(body)}
+
+	retryable := configuration.Response.ResponseRetryableStatusCodes
+	if len(retryable) == 0 {
+		retryable = defaultRetryableStatusCodes
+	}
+
+	switch {
+	case containsStatusCode(retryable, statusCode):
+	case containsStatusCode(configuration.Response.ResponsePermanentStatusCodes, statusCode):
+		deliveryErr.Permanent = true
+	case statusCode >= 400 && statusCode < 500:
+		deliveryErr.Permanent = true
+	}
+
+	// A 410 listed as permanent disables the endpoint too.
+	deliveryErr.Gone = deliveryErr.Permanent && statusCode == http.StatusGone
+
+	if statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable {
+		deliveryErr.RetryAfter = parseRetryAfter(header.Get("Retry-After"), now())
+	}
+
+	return deliveryErr
+}
+
+// parseRetryAfter parses a Retry-After header, either a number of seconds or an HTTP date. It
+// returns zero when the header is missing or invalid.
+func parseRetryAfter(value string, from time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil && date.After(from) {
+		return date.Sub(from)
+	}
+
+	return 0
+}
+
+func containsStatusCode(statusCodes []int, statusCode int) bool {
+	for _, candidate := range statusCodes {
+		if candidate == statusCode {
+			return true
+		}
+	}
+	return false
+}
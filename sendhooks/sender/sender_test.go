@@ -8,10 +8,21 @@ check out the webhook_test.go file.
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
 	"io"
 	"net/http"
+	"os"
+	"path/filepath"
 	"sendhooks/adapter"
+	"sendhooks/signature"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -44,13 +55,51 @@ func TestPrepareRequest(t *testing.T) {
 	jsonBytes := []byte(`{"key":"value"}`)
 	secretHash := "secret123"
 
-	req, err := prepareRequest(url, jsonBytes, secretHash, adapter.Configuration{})
+	req, err := prepareRequest(url, jsonBytes, secretHash, adapter.Configuration{SigningMode: "legacy"})
 
 	assert.NoError(t, err)
 
 	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
 
 	assert.Equal(t, secretHash, req.Header.Get("X-Secret-Hash"))
+
+	// The secret hash is only sent in the legacy signing mode.
+	req, err = prepareRequest(url, jsonBytes, secretHash, adapter.Configuration{})
+
+	assert.NoError(t, err)
+
+	assert.Empty(t, req.Header.Get("X-Secret-Hash"))
+}
+
+func TestSignRequest(t *testing.T) {
+	now = func() time.Time { return time.Unix(1614265330, 0) }
+	defer func() { now = time.Now }()
+
+	configuration := adapter.Configuration{
+		Endpoints: []adapter.EndpointConfig{
+			{EndpointUrl: "http://example.com/", EndpointSecret: "other-secret"},
+			{EndpointUrl: "http://example.com/webhook", EndpointSecret: "whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw"},
+		},
+	}
+	jsonBytes := []byte(`{"test": 2432232314}`)
+
+	req, _ := http.NewRequest("POST", "http://example.com/webhook", bytes.NewBuffer(jsonBytes))
+	err := signRequest(req, "msg_p5jXN8AQM9LWM0D4loKWxJek", jsonBytes, configuration)
+
+	assert.NoError(t, err)
+
+	assert.Equal(t, "msg_p5jXN8AQM9LWM0D4loKWxJek", req.Header.Get("webhook-id"))
+	assert.Equal(t, "1614265330", req.Header.Get("webhook-timestamp"))
+	assert.Equal(t, "v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE=", req.Header.Get("webhook-signature"))
+
+	// Webhooks to endpoints without a secret are not signed.
+	req, _ = http.NewRequest("POST", "http://other.com/webhook", bytes.NewBuffer(jsonBytes))
+	err = signRequest(req, "msg_p5jXN8AQM9LWM0D4loKWxJek", jsonBytes, configuration)
+
+	assert.NoError(t, err)
+
+	assert.Equal(t, "msg_p5jXN8AQM9LWM0D4loKWxJek", req.Header.Get("webhook-id"))
+	assert.Empty(t, req.Header.Get("webhook-signature"))
 }
 
 func TestSendRequest(t *testing.T) {
@@ -73,3 +122,120 @@ func TestSendRequest(t *testing.T) {
 	assert.Equal(t, 200, resp.StatusCode)
 	assert.Equal(t, "OK", string(body))
 }
+
+func TestSignRequestAsymmetric(t *testing.T) {
+	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(privateKey)
+	keyPath := filepath.Join(t.TempDir(), "signing.pem")
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+
+	configuration := adapter.Configuration{SigningMode: "asymmetric", SigningPrivateKey: keyPath}
+	jsonBytes := []byte(`{"key":"value"}`)
+
+	req, _ := http.NewRequest("POST", "http://example.com/webhook", bytes.NewBuffer(jsonBytes))
+	err := signRequest(req, "webhookId", jsonBytes, configuration)
+
+	assert.NoError(t, err)
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(req.Header.Get("webhook-signature"), "v1a,"))
+	assert.NoError(t, err)
+
+	timestamp, _ := strconv.ParseInt(req.Header.Get("webhook-timestamp"), 10, 64)
+	content := signature.Content("webhookId", timestamp, jsonBytes)
+	assert.True(t, ed25519.Verify(privateKey.Public().(ed25519.PublicKey), content, sig))
+
+	// The public key is published with its thumbprint as key ID.
+	jwks, err := PublicKeys(configuration)
+	assert.NoError(t, err)
+	assert.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "Ed25519", jwks.Keys[0].Crv)
+	assert.NotEmpty(t, jwks.Keys[0].Kid)
+}
+
+func TestSignRequestKeyRotation(t *testing.T) {
+	configuration := adapter.Configuration{
+		Endpoints: []adapter.EndpointConfig{{
+			EndpointUrl:    "http://example.com/webhook",
+			EndpointSecret: "old-secret",
+			EndpointKeys:   []adapter.SigningKeyConfig{{KeySecret: "new-secret", KeyActiveFrom: "2024-01-01T00:00:00Z"}},
+		}},
+		SigningOverlap: 3600,
+	}
+	jsonBytes := []byte(`{"key":"value"}`)
+
+	sign := func(at string) []string {
+		now = func() time.Time {
+			timestamp, _ := time.Parse(time.RFC3339, at)
+			return timestamp
+		}
+		defer func() { now = time.Now }()
+
+		req, _ := http.NewRequest("POST", "http://example.com/webhook", bytes.NewBuffer(jsonBytes))
+		assert.NoError(t, signRequest(req, "webhookId", jsonBytes, configuration))
+
+		return strings.Fields(req.Header.Get("webhook-signature"))
+	}
+
+	// Before the new key is active, only the old one signs.
+	signatures := sign("2023-12-31T23:00:00Z")
+	assert.Len(t, signatures, 1)
+
+	// During the overlap, both keys sign.
+	signatures = sign("2024-01-01T00:30:00Z")
+	assert.Len(t, signatures, 2)
+	assert.NotEqual(t, signatures[0], signatures[1])
+
+	// After the overlap, only the new key signs.
+	signatures = sign("2024-01-01T01:00:00Z")
+	timestamp, _ := time.Parse(time.RFC3339, "2024-01-01T01:00:00Z")
+	assert.Equal(t, []string{signature.Sign([]byte("new-secret"), "webhookId", timestamp.Unix(), jsonBytes)}, signatures)
+
+	// An invalid activation time is reported.
+	configuration.Endpoints[0].EndpointKeys[0].KeyActiveFrom = "tomorrow"
+	assert.Error(t, ValidateSigningKeys(configuration))
+}
+
+func TestClassifyResponse(t *testing.T) {
+	header := http.Header{}
+	header.Set("Retry-After", "30")
+
+	deliveryErr := classifyResponse(http.StatusBadRequest, http.Header{}, nil, adapter.Configuration{})
+	assert.True(t, deliveryErr.Permanent)
+	assert.False(t, deliveryErr.Gone)
+
+	deliveryErr = classifyResponse(http.StatusGone, http.Header{}, nil, adapter.Configuration{})
+	assert.True(t, deliveryErr.Permanent)
+	assert.True(t, deliveryErr.Gone)
+
+	deliveryErr = classifyResponse(http.StatusTooManyRequests, header, nil, adapter.Configuration{})
+	assert.False(t, deliveryErr.Permanent)
+	assert.Equal(t, 30*time.Second, deliveryErr.RetryAfter)
+
+	deliveryErr = classifyResponse(http.StatusInternalServerError, header, nil, adapter.Configuration{})
+	assert.False(t, deliveryErr.Permanent)
+	assert.Zero(t, deliveryErr.RetryAfter)
+
+	configuration := adapter.Configuration{Response: adapter.ResponseConfig{
+		ResponseRetryableStatusCodes: []int{http.StatusNotFound},
+		ResponsePermanentStatusCodes: []int{http.StatusNotImplemented},
+	}}
+	assert.False(t, classifyResponse(http.StatusNotFound, http.Header{}, nil, configuration).Permanent)
+	assert.True(t, classifyResponse(http.StatusTooManyRequests, http.Header{}, nil, configuration).Permanent)
+	assert.True(t, classifyResponse(http.StatusNotImplemented, http.Header{}, nil, configuration).Permanent)
+
+	// A 410 is gone when it's permanent, even when it's listed.
+	configuration.Response.ResponsePermanentStatusCodes = []int{http.StatusGone}
+	assert.True(t, classifyResponse(http.StatusGone, http.Header{}, nil, configuration).Gone)
+	configuration.Response.ResponseRetryableStatusCodes = []int{http.StatusGone}
+	assert.False(t, classifyResponse(http.StatusGone, http.Header{}, nil, configuration).Gone)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	from := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 2*time.Minute, parseRetryAfter("120", from))
+	assert.Equal(t, time.Hour, parseRetryAfter("Sat, 01 Jun 2024 13:00:00 GMT", from))
+	assert.Zero(t, parseRetryAfter("Sat, 01 Jun 2024 11:00:00 GMT", from))
+	assert.Zero(t, parseRetryAfter("soon", from))
+	assert.Zero(t, parseRetryAfter("", from))
+}
@@ -8,8 +8,17 @@ import (
 	"net/http"
 	"sendhooks/adapter"
 	"sendhooks/logging"
+	"sendhooks/signature"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// legacySigningMode sends the secretHash of the payload as it is instead of signing the webhooks.
+const legacySigningMode = "legacy"
+
+var now = time.Now
+
 type HTTPDoer interface {
 	Do(req *http.Request) (*http.Response, error)
 }
@@ -34,6 +43,10 @@ var prepareRequest = func(url string, jsonBytes []byte, secretHash string, confi
 
 	req.Header.Set("Content-Type", "application/json")
 
+	if configuration.SigningMode != legacySigningMode {
+		return req, nil
+	}
+
 	secretHashHeaderName := configuration.SecretHashHeaderName
 	if secretHashHeaderName == "" {
 		secretHashHeaderName = "X-Secret-Hash"
@@ -46,6 +59,28 @@ var prepareRequest = func(url string, jsonBytes []byte, secretHash string, confi
 	return req, nil
 }
 
+// signRequest adds the Standard Webhooks headers to the request. While signing keys rotate, the
+// webhook carries one signature per active key. In the standard signing mode, the signature is only
+// added when a secret is configured for the endpoint.
+var signRequest = func(req *http.Request, webhookId string, jsonBytes []byte, configuration adapter.Configuration) error {
+	timestamp := now().Unix()
+
+	req.Header.Set(signature.IDHeader, webhookId)
+	req.Header.Set(signature.TimestampHeader, strconv.FormatInt(timestamp, 10))
+
+	signed, err := signatures(req.URL.String(), webhookId, timestamp, jsonBytes, configuration)
+	if err != nil {
+		logging.WebhookLogger(logging.ErrorType, fmt.Errorf("error signing the webhook: %s", err))
+		return err
+	}
+
+	if len(signed) > 0 {
+		req.Header.Set(signature.SignatureHeader, strings.Join(signed, " "))
+	}
+
+	return nil
+}
+
 var sendRequest = func(req *http.Request) (*http.Response, error) {
 	resp, err := HTTPClient.Do(req)
 
@@ -69,7 +104,7 @@ var processResponse = func(resp *http.Response) (string, []byte, int, error) {
 	}
 
 	status := "failed"
-	if resp.StatusCode == http.StatusOK {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
 		status = "delivered"
 	}
 
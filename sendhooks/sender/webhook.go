@@ -1,14 +1,16 @@
 package sender
 
 import (
-	"errors"
-	"fmt"
 	"sendhooks/adapter"
 	"sendhooks/logging"
 )
 
+// IdempotencyKeyHeader carries a key stable across the retries and the duplicates of a webhook, so
+// the receivers can dedupe the deliveries.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
 // SendWebhook sends a JSON POST request to the specified URL
-func SendWebhook(data interface{}, url string, webhookId string, secretHash string, configuration adapter.Configuration) error {
+func SendWebhook(data interface{}, url string, webhookId string, idempotencyKey string, secretHash string, configuration adapter.Configuration) error {
 	jsonBytes, err := marshalJSON(data)
 	if err != nil {
 		return err
@@ -19,6 +21,14 @@ func SendWebhook(data interface{}, url string, webhookId string, secretHash stri
 		return err
 	}
 
+	req.Header.Set(IdempotencyKeyHeader, idempotencyKey)
+
+	if configuration.SigningMode != legacySigningMode {
+		if err := signRequest(req, webhookId, jsonBytes, configuration); err != nil {
+			return err
+		}
+	}
+
 	resp, err := sendRequest(req)
 	if err != nil {
 
@@ -32,11 +42,10 @@ func SendWebhook(data interface{}, url string, webhookId string, secretHash stri
 		return err
 	}
 
-	message := fmt.Sprintf("webhook sending failed with status: %d, response body: %s", statusCode, string(respBody))
-
 	if status == "failed" {
-		logging.WebhookLogger(logging.WarningType, fmt.Errorf(message))
-		return errors.New(message)
+		deliveryErr := classifyResponse(statusCode, resp.Header, respBody, configuration)
+		logging.WebhookLogger(logging.WarningType, deliveryErr)
+		return deliveryErr
 	}
 
 	return nil
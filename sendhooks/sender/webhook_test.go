@@ -27,7 +27,7 @@ func TestSendWebhook(t *testing.T) {
 	t.Run("Successful sendhooks sending", func(t *testing.T) {
 		resetMocks() // Reset all mocks to original functions
 
-		err := SendWebhook(nil, "http://dummy.com", "webhookId", "secretHash", adapter.Configuration{})
+		err := SendWebhook(nil, "http://dummy.com", "webhookId", "idempotencyKey", "secretHash", adapter.Configuration{})
 
 		assert.NoError(t, err)
 	})
@@ -38,7 +38,7 @@ func TestSendWebhook(t *testing.T) {
 			return nil, errors.New("marshaling error")
 		}
 
-		err := SendWebhook(nil, "http://dummy.com", "webhookId", "secretHash", adapter.Configuration{})
+		err := SendWebhook(nil, "http://dummy.com", "webhookId", "idempotencyKey", "secretHash", adapter.Configuration{})
 
 		assert.EqualError(t, err, "marshaling error")
 	})
@@ -49,7 +49,7 @@ func TestSendWebhook(t *testing.T) {
 			return nil, errors.New("request preparation error")
 		}
 
-		err := SendWebhook(nil, "http://dummy.com", "webhookId", "secretHash", adapter.Configuration{})
+		err := SendWebhook(nil, "http://dummy.com", "webhookId", "idempotencyKey", "secretHash", adapter.Configuration{})
 
 		assert.EqualError(t, err, "request preparation error")
 	})
@@ -60,7 +60,7 @@ func TestSendWebhook(t *testing.T) {
 			return "failed", nil, 0, errors.New("response processing error")
 		}
 
-		err := SendWebhook(nil, "http://dummy.com", "webhookId", "secretHash", adapter.Configuration{})
+		err := SendWebhook(nil, "http://dummy.com", "webhookId", "idempotencyKey", "secretHash", adapter.Configuration{})
 
 		assert.EqualError(t, err, "response processing error")
 	})
@@ -71,7 +71,7 @@ func TestSendWebhook(t *testing.T) {
 			return "failed", []byte("error body"), 0, nil
 		}
 
-		SendWebhook(nil, "http://dummy\t\tassert.EqualError(t, err, \"failed\")\n.com", "webhookId", "secretHash", adapter.Configuration{})
+		SendWebhook(nil, "http://dummy\t\tassert.EqualError(t, err, \"failed\")\n.com", "webhookId", "idempotencyKey", "secretHash", adapter.Configuration{})
 		if !webhookLoggerInvoked {
 			assert.Fail(t, "Expected WebhookLogger to be invoked")
 		}
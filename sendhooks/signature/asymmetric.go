@@ -0,0 +1,189 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	// Ed25519Version identifies the Ed25519 signatures, as in the Standard Webhooks specification.
+	Ed25519Version = "v1a"
+	// RSAPSSVersion identifies the RSA-PSS signatures with SHA-256. They are not part of the
+	// specification.
+	RSAPSSVersion = "v1r"
+)
+
+// JWK is a public key in the JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKS is a set of public keys in the JSON Web Key Set format.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// ParsePrivateKey parses an Ed25519 or RSA private key in the PEM format, either PKCS #8 or
+// PKCS #1 for RSA.
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := key.(type) {
+	case ed25519.PrivateKey:
+		return key, nil
+	case *rsa.PrivateKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+}
+
+// SignAsymmetric returns the signature of a webhook with an Ed25519 or RSA private key, in the
+// "<version>,<base64>" format.
+func SignAsymmetric(key crypto.Signer, webhookID string, timestamp int64, body []byte) (string, error) {
+	content := Content(webhookID, timestamp, body)
+
+	switch key := key.(type) {
+	case ed25519.PrivateKey:
+		return Ed25519Version + "," + base64.StdEncoding.EncodeToString(ed25519.Sign(key, content)), nil
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256(content)
+		signature, err := rsa.SignPSS(rand.Reader, key, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		if err != nil {
+			return "", err
+		}
+		return RSAPSSVersion + "," + base64.StdEncoding.EncodeToString(signature), nil
+	default:
+		return "", fmt.Errorf("unsupported private key type %T", key)
+	}
+}
+
+// VerifyAsymmetric checks a "<version>,<base64>" signature of a webhook with an Ed25519 or RSA
+// public key.
+func VerifyAsymmetric(key crypto.PublicKey, webhookID string, timestamp int64, body []byte, signature string) bool {
+	version, encoded, ok := strings.Cut(signature, ",")
+	if !ok {
+		return false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return false
+	}
+
+	content := Content(webhookID, timestamp, body)
+
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		return version == Ed25519Version && ed25519.Verify(key, content, decoded)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(content)
+		return version == RSAPSSVersion && rsa.VerifyPSS(key, crypto.SHA256, digest[:], decoded, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+	default:
+		return false
+	}
+}
+
+// PublicJWK returns the public key as a JWK. The key ID defaults to the JWK thumbprint of the key
+// (RFC 7638).
+func PublicJWK(kid string, key crypto.PublicKey) (JWK, error) {
+	var jwk JWK
+
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		jwk = JWK{Kty: "OKP", Alg: "EdDSA", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(key)}
+	case *rsa.PublicKey:
+		jwk = JWK{
+			Kty: "RSA",
+			Alg: "PS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}
+	default:
+		return jwk, fmt.Errorf("unsupported public key type %T", key)
+	}
+
+	jwk.Use = "sig"
+	jwk.Kid = kid
+	if jwk.Kid == "" {
+		jwk.Kid = thumbprint(jwk)
+	}
+
+	return jwk, nil
+}
+
+// PublicKey returns the Ed25519 or RSA public key of the JWK.
+func (j JWK) PublicKey() (crypto.PublicKey, error) {
+	switch j.Kty {
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || j.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key %s", j.Kid)
+		}
+		return ed25519.PublicKey(x), nil
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA key %s: %w", j.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid RSA key %s", j.Kid)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", j.Kty)
+	}
+}
+
+// thumbprint computes the JWK thumbprint from the required members, in lexicographic order.
+func thumbprint(jwk JWK) string {
+	var members interface{}
+	if jwk.Kty == "OKP" {
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	} else {
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	}
+
+	data, _ := json.Marshal(members)
+	digest := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
@@ -0,0 +1,100 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodePrivateKey(t *testing.T, key crypto.Signer) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func decodeSignature(t *testing.T, signature, version string) []byte {
+	encoded, ok := strings.CutPrefix(signature, version+",")
+	assert.True(t, ok, signature)
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	assert.NoError(t, err)
+	return decoded
+}
+
+func TestSignEd25519(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	key, err := ParsePrivateKey(encodePrivateKey(t, privateKey))
+	assert.NoError(t, err)
+
+	signature, err := SignAsymmetric(key, "msg_1", 1614265330, []byte(`{"test": 1}`))
+	assert.NoError(t, err)
+
+	content := Content("msg_1", 1614265330, []byte(`{"test": 1}`))
+	assert.True(t, ed25519.Verify(privateKey.Public().(ed25519.PublicKey), content, decodeSignature(t, signature, Ed25519Version)))
+}
+
+func TestSignRSAPSS(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	// PKCS #1 keys are accepted too.
+	pkcs1 := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	key, err := ParsePrivateKey(pkcs1)
+	assert.NoError(t, err)
+
+	signature, err := SignAsymmetric(key, "msg_1", 1614265330, []byte(`{"test": 1}`))
+	assert.NoError(t, err)
+
+	digest := sha256.Sum256(Content("msg_1", 1614265330, []byte(`{"test": 1}`)))
+	err = rsa.VerifyPSS(&privateKey.PublicKey, crypto.SHA256, digest[:], decodeSignature(t, signature, RSAPSSVersion), &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	assert.NoError(t, err)
+}
+
+// The thumbprint comes from the example of RFC 8037.
+func TestPublicJWK(t *testing.T) {
+	x, err := base64.RawURLEncoding.DecodeString("11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo")
+	assert.NoError(t, err)
+
+	jwk, err := PublicJWK("", ed25519.PublicKey(x))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "OKP", jwk.Kty)
+	assert.Equal(t, "EdDSA", jwk.Alg)
+	assert.Equal(t, "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k", jwk.Kid)
+
+	jwk, err = PublicJWK("key-1", ed25519.PublicKey(x))
+	assert.NoError(t, err)
+	assert.Equal(t, "key-1", jwk.Kid)
+}
+
+func TestVerifyAsymmetric(t *testing.T) {
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	for _, privateKey := range []crypto.Signer{ed25519Key, rsaKey} {
+		signature, err := SignAsymmetric(privateKey, "msg_1", 1614265330, []byte(`{"test": 1}`))
+		assert.NoError(t, err)
+
+		// The public key goes through the JWKS, as receivers get it.
+		jwk, err := PublicJWK("", privateKey.Public())
+		assert.NoError(t, err)
+		publicKey, err := jwk.PublicKey()
+		assert.NoError(t, err)
+
+		assert.True(t, VerifyAsymmetric(publicKey, "msg_1", 1614265330, []byte(`{"test": 1}`), signature))
+		assert.False(t, VerifyAsymmetric(publicKey, "msg_1", 1614265330, []byte(`{"test": 2}`), signature))
+	}
+}
@@ -0,0 +1,61 @@
+package signature
+
+/*
+This package holds the signing scheme shared by the sender and the receivers. It follows the Standard Webhooks
+specification (https://www.standardwebhooks.com): the signed content is "<webhook-id>.<webhook-timestamp>.<body>"
+and signatures are sent in the webhook-signature header as space-separated "<version>,<base64 signature>" pairs.
+*/
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	IDHeader        = "webhook-id"
+	TimestampHeader = "webhook-timestamp"
+	SignatureHeader = "webhook-signature"
+
+	// SymmetricVersion identifies the HMAC-SHA256 signatures.
+	SymmetricVersion = "v1"
+
+	secretPrefix = "whsec_"
+)
+
+// DecodeSecret returns the HMAC key of a secret. Secrets in the "whsec_<base64>" format are
+// decoded, other secrets are used as they are.
+func DecodeSecret(secret string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(secret, secretPrefix)
+	if !ok {
+		return []byte(secret), nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s secret: %w", secretPrefix, err)
+	}
+
+	return key, nil
+}
+
+// Content returns the signed content of a webhook.
+func Content(webhookID string, timestamp int64, body []byte) []byte {
+	content := make([]byte, 0, len(webhookID)+len(body)+22)
+	content = append(content, webhookID...)
+	content = append(content, '.')
+	content = strconv.AppendInt(content, timestamp, 10)
+	content = append(content, '.')
+	return append(content, body...)
+}
+
+// Sign returns the HMAC-SHA256 signature of a webhook, in the "v1,<base64>" format.
+func Sign(key []byte, webhookID string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(Content(webhookID, timestamp, body))
+
+	return SymmetricVersion + "," + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
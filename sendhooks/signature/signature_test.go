@@ -0,0 +1,26 @@
+package signature
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The test vector comes from the Standard Webhooks reference implementations.
+func TestSign(t *testing.T) {
+	key, err := DecodeSecret("whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw")
+	assert.NoError(t, err)
+
+	signature := Sign(key, "msg_p5jXN8AQM9LWM0D4loKWxJek", 1614265330, []byte(`{"test": 2432232314}`))
+
+	assert.Equal(t, "v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE=", signature)
+}
+
+func TestDecodeSecret(t *testing.T) {
+	key, err := DecodeSecret("raw-secret")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("raw-secret"), key)
+
+	_, err = DecodeSecret("whsec_not base64")
+	assert.Error(t, err)
+}
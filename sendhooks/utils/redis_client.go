@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"crypto/tls"
+	"strconv"
+	"strings"
+
+	"sendhooks/adapter"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// NewRedisClient creates a client for the Redis of the redis section.
+func NewRedisClient(config adapter.RedisConfig, poolSize int) (*redis.Client, error) {
+	redisAddress := config.RedisAddress
+	if redisAddress == "" {
+		redisAddress = "localhost:6379" // Default address
+	}
+
+	redisDB := config.RedisDb
+	if redisDB == "" {
+		redisDB = "0" // Default database
+	}
+
+	redisDBInt, _ := strconv.Atoi(redisDB)
+
+	var tlsConfig *tls.Config
+	if strings.ToLower(config.RedisSsl) == "true" {
+		var err error
+		tlsConfig, err = CreateTLSConfig(config.RedisCaCert, config.RedisClientCert, config.RedisClientKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return redis.NewClient(&redis.Options{
+		Addr:      redisAddress,
+		Password:  config.RedisPassword,
+		DB:        redisDBInt,
+		TLSConfig: tlsConfig,
+		PoolSize:  poolSize,
+	}), nil
+}
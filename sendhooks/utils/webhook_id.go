@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// NewWebhookID returns a random version 4 UUID.
+func NewWebhookID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+
+	return formatUUID(id), nil
+}
+
+// WebhookIDForKey returns the webhook ID of an idempotency key, a version 8 UUID made of the
+// SHA-256 of the key. The same key always gives the same ID.
+func WebhookIDForKey(idempotencyKey string) string {
+	digest := sha256.Sum256([]byte(idempotencyKey))
+	id := digest[:16]
+
+	id[6] = (id[6] & 0x0f) | 0x80
+	id[8] = (id[8] & 0x3f) | 0x80
+
+	return formatUUID(id)
+}
+
+func formatUUID(id []byte) string {
+	encoded := hex.EncodeToString(id)
+	return encoded[0:8] + "-" + encoded[8:12] + "-" + encoded[12:16] + "-" + encoded[16:20] + "-" + encoded[20:]
+}
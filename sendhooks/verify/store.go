@@ -0,0 +1,91 @@
+package verify
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// SeenStore remembers the IDs of the webhooks already received.
+type SeenStore interface {
+	// Seen records a webhook ID until expiresAt and tells if it was already recorded. Recording
+	// must be atomic, so concurrent deliveries of the same webhook are only accepted once.
+	Seen(ctx context.Context, webhookID string, expiresAt time.Time) (bool, error)
+	// Forget removes a webhook ID, so the webhook is accepted again.
+	Forget(ctx context.Context, webhookID string) error
+}
+
+// MemoryStore keeps the webhook IDs in memory. It suits a single receiver instance; use a shared
+// store such as RedisStore when several instances receive the webhooks.
+type MemoryStore struct {
+	mu        sync.Mutex
+	expiries  map[string]time.Time
+	nextPrune time.Time
+
+	now func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{expiries: map[string]time.Time{}, now: time.Now}
+}
+
+func (m *MemoryStore) Seen(ctx context.Context, webhookID string, expiresAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.After(m.nextPrune) {
+		for id, expiry := range m.expiries {
+			if now.After(expiry) {
+				delete(m.expiries, id)
+			}
+		}
+		m.nextPrune = now.Add(time.Minute)
+	}
+
+	if expiry, ok := m.expiries[webhookID]; ok && !now.After(expiry) {
+		return true, nil
+	}
+
+	m.expiries[webhookID] = expiresAt
+	return false, nil
+}
+
+func (m *MemoryStore) Forget(ctx context.Context, webhookID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.expiries, webhookID)
+	return nil
+}
+
+// RedisStore keeps the webhook IDs in Redis, shared by all the receiver instances.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore creates a store keeping the webhook IDs in keys starting with the prefix.
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (r *RedisStore) Seen(ctx context.Context, webhookID string, expiresAt time.Time) (bool, error) {
+	ttl := time.Until(expiresAt)
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+
+	recorded, err := r.client.SetNX(ctx, r.prefix+webhookID, 1, ttl).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return !recorded, nil
+}
+
+func (r *RedisStore) Forget(ctx context.Context, webhookID string) error {
+	return r.client.Del(ctx, r.prefix+webhookID).Err()
+}
@@ -0,0 +1,226 @@
+package verify
+
+/*
+This package verifies the webhooks sent by sendhooks on the receiver side. It checks the Standard Webhooks headers
+set by the sender: the signature against the endpoint secrets or the public keys, the timestamp against a tolerance,
+and the webhook ID against a store of the IDs already seen, so a captured request can't be replayed.
+
+It only depends on the signature package of the engine, so receivers can import it without setting up the engine
+logging.
+*/
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sendhooks/signature"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTolerance is how far the webhook timestamp may be from the receiver clock.
+const DefaultTolerance = 5 * time.Minute
+
+var (
+	ErrMissingHeaders    = errors.New("missing webhook headers")
+	ErrInvalidTimestamp  = errors.New("invalid webhook timestamp")
+	ErrTimestampTooOld   = errors.New("webhook timestamp too old")
+	ErrTimestampTooNew   = errors.New("webhook timestamp too new")
+	ErrInvalidSignature  = errors.New("no matching webhook signature")
+	ErrReplayed          = errors.New("webhook already received")
+	errNoVerificationKey = errors.New("a secret or a public key is required")
+)
+
+// defaultStore remembers the webhook IDs seen by Verify and Middleware.
+var defaultStore SeenStore = NewMemoryStore()
+
+// Verifier checks the webhooks signed with any of its secrets or public keys. Several secrets or
+// keys can be set while they are rotated.
+type Verifier struct {
+	// Secrets are the endpoint secrets, either in the "whsec_<base64>" format or as raw strings.
+	Secrets []string
+	// PublicKeys are the Ed25519 or RSA public keys of the asymmetric signing mode, for example
+	// from the JWKS of the sender.
+	PublicKeys []crypto.PublicKey
+	// Tolerance defaults to DefaultTolerance.
+	Tolerance time.Duration
+	// Store remembers the webhook IDs to reject the replays. Replays are not checked when it's nil.
+	Store SeenStore
+
+	now func() time.Time
+}
+
+// Verify checks a webhook signed with an endpoint secret, remembering its ID in memory. The body
+// is read and restored, so the request can be handled afterwards. When the webhook can't be
+// handled, call Forget so the retry of the sender isn't rejected as a replay.
+func Verify(req *http.Request, secret string) error {
+	verifier := &Verifier{Secrets: []string{secret}, Store: defaultStore}
+	return verifier.Verify(req)
+}
+
+// Forget removes the ID of a webhook checked with Verify, so it's accepted again when the sender
+// retries it.
+func Forget(req *http.Request) error {
+	verifier := &Verifier{Store: defaultStore}
+	return verifier.Forget(req)
+}
+
+// Middleware rejects the requests that are not webhooks signed with the endpoint secret, see
+// Verifier.Middleware.
+func Middleware(secret string, next http.Handler) http.Handler {
+	verifier := &Verifier{Secrets: []string{secret}, Store: defaultStore}
+	return verifier.Middleware(next)
+}
+
+// Verify checks a webhook. The body is read and restored, so the request can be handled afterwards.
+func (v *Verifier) Verify(req *http.Request) error {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return fmt.Errorf("error reading the webhook body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	return v.VerifyBody(req.Context(), req.Header, body)
+}
+
+// Forget removes the ID of a verified webhook from the store, so it's accepted again when the
+// sender retries it. It's meant for the webhooks the receiver failed to handle.
+func (v *Verifier) Forget(req *http.Request) error {
+	if v.Store == nil {
+		return nil
+	}
+
+	webhookID := req.Header.Get(signature.IDHeader)
+	if webhookID == "" {
+		return ErrMissingHeaders
+	}
+
+	if err := v.Store.Forget(req.Context(), webhookID); err != nil {
+		return fmt.Errorf("error forgetting the webhook ID: %w", err)
+	}
+	return nil
+}
+
+// VerifyBody checks a webhook from its headers and raw body.
+func (v *Verifier) VerifyBody(ctx context.Context, header http.Header, body []byte) error {
+	webhookID := header.Get(signature.IDHeader)
+	rawTimestamp := header.Get(signature.TimestampHeader)
+	signatures := header.Get(signature.SignatureHeader)
+	if webhookID == "" || rawTimestamp == "" || signatures == "" {
+		return ErrMissingHeaders
+	}
+
+	timestamp, err := strconv.ParseInt(rawTimestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+
+	tolerance := v.Tolerance
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+
+	now := time.Now()
+	if v.now != nil {
+		now = v.now()
+	}
+
+	sentAt := time.Unix(timestamp, 0)
+	if now.Sub(sentAt) > tolerance {
+		return ErrTimestampTooOld
+	}
+	if sentAt.Sub(now) > tolerance {
+		return ErrTimestampTooNew
+	}
+
+	if err := v.verifySignatures(webhookID, timestamp, body, strings.Fields(signatures)); err != nil {
+		return err
+	}
+
+	if v.Store == nil {
+		return nil
+	}
+
+	// Older timestamps are rejected anyway, so the ID only needs to be remembered until then.
+	seen, err := v.Store.Seen(ctx, webhookID, sentAt.Add(tolerance))
+	if err != nil {
+		return fmt.Errorf("error checking the webhook ID: %w", err)
+	}
+	if seen {
+		return ErrReplayed
+	}
+
+	return nil
+}
+
+// verifySignatures succeeds when one of the signatures matches one of the keys.
+func (v *Verifier) verifySignatures(webhookID string, timestamp int64, body []byte, signatures []string) error {
+	if len(v.Secrets) == 0 && len(v.PublicKeys) == 0 {
+		return errNoVerificationKey
+	}
+
+	for _, secret := range v.Secrets {
+		key, err := signature.DecodeSecret(secret)
+		if err != nil {
+			return err
+		}
+
+		expected := signature.Sign(key, webhookID, timestamp, body)
+		for _, sig := range signatures {
+			if hmac.Equal([]byte(sig), []byte(expected)) {
+				return nil
+			}
+		}
+	}
+
+	for _, key := range v.PublicKeys {
+		for _, sig := range signatures {
+			if signature.VerifyAsymmetric(key, webhookID, timestamp, body, sig) {
+				return nil
+			}
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+// Middleware rejects the requests that are not valid webhooks with 401 Unauthorized. A replayed
+// webhook is acknowledged without reaching the handler, so the sender doesn't retry it; when the
+// handler fails, its ID is forgotten so the retry goes through.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := v.Verify(r)
+		if errors.Is(err, ErrReplayed) {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		if recorder.status < 200 || recorder.status > 299 {
+			v.Forget(r)
+		}
+	})
+}
+
+// statusRecorder keeps the status code written by the handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,174 @@
+package verify
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"sendhooks/signature"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testSecret = "whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw"
+	testID     = "msg_p5jXN8AQM9LWM0D4loKWxJek"
+	testBody   = `{"test": 2432232314}`
+)
+
+// newWebhook builds a webhook the way the sender signs it, with the Standard Webhooks test vector.
+func newWebhook(signatures string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(testBody))
+	req.Header.Set(signature.IDHeader, testID)
+	req.Header.Set(signature.TimestampHeader, "1614265330")
+	req.Header.Set(signature.SignatureHeader, signatures)
+	return req
+}
+
+func newVerifier(store *MemoryStore) *Verifier {
+	verifier := &Verifier{
+		Secrets: []string{testSecret},
+		now:     func() time.Time { return time.Unix(1614265330, 0) },
+	}
+
+	if store != nil {
+		store.now = verifier.now
+		verifier.Store = store
+	}
+
+	return verifier
+}
+
+func TestVerify(t *testing.T) {
+	verifier := newVerifier(nil)
+
+	t.Run("A valid signature is accepted", func(t *testing.T) {
+		req := newWebhook("v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE=")
+		assert.NoError(t, verifier.Verify(req))
+
+		// The body can still be read by the handler.
+		body := make([]byte, len(testBody))
+		req.Body.Read(body)
+		assert.Equal(t, testBody, string(body))
+	})
+
+	t.Run("One valid signature among several is enough", func(t *testing.T) {
+		req := newWebhook("v1,Ceo5qEr07ixe2NLpvHk3FH9bwy/WavXrAFQ/9tdO6mc= v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE=")
+		assert.NoError(t, verifier.Verify(req))
+	})
+
+	t.Run("Invalid webhooks are rejected", func(t *testing.T) {
+		req := newWebhook("v1,Ceo5qEr07ixe2NLpvHk3FH9bwy/WavXrAFQ/9tdO6mc=")
+		assert.ErrorIs(t, verifier.Verify(req), ErrInvalidSignature)
+
+		req = newWebhook("")
+		assert.ErrorIs(t, verifier.Verify(req), ErrMissingHeaders)
+
+		req = newWebhook("v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE=")
+		req.Header.Set(signature.TimestampHeader, "yesterday")
+		assert.ErrorIs(t, verifier.Verify(req), ErrInvalidTimestamp)
+	})
+
+	t.Run("Timestamps outside the tolerance are rejected", func(t *testing.T) {
+		late := newVerifier(nil)
+		late.now = func() time.Time { return time.Unix(1614265330, 0).Add(DefaultTolerance + time.Second) }
+		assert.ErrorIs(t, late.Verify(newWebhook("v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE=")), ErrTimestampTooOld)
+
+		early := newVerifier(nil)
+		early.now = func() time.Time { return time.Unix(1614265330, 0).Add(-DefaultTolerance - time.Second) }
+		assert.ErrorIs(t, early.Verify(newWebhook("v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE=")), ErrTimestampTooNew)
+	})
+
+	t.Run("Replays are rejected", func(t *testing.T) {
+		verifier := newVerifier(NewMemoryStore())
+
+		assert.NoError(t, verifier.Verify(newWebhook("v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE=")))
+		assert.ErrorIs(t, verifier.Verify(newWebhook("v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE=")), ErrReplayed)
+	})
+
+	t.Run("A forgotten webhook is accepted again", func(t *testing.T) {
+		verifier := newVerifier(NewMemoryStore())
+
+		req := newWebhook("v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE=")
+		assert.NoError(t, verifier.Verify(req))
+		assert.NoError(t, verifier.Forget(req))
+		assert.NoError(t, verifier.Verify(newWebhook("v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE=")))
+	})
+}
+
+func TestVerifyAsymmetric(t *testing.T) {
+	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	timestamp := time.Now().Unix()
+
+	sig, err := signature.SignAsymmetric(privateKey, testID, timestamp, []byte(testBody))
+	assert.NoError(t, err)
+
+	req := newWebhook(sig)
+	req.Header.Set(signature.TimestampHeader, strconv.FormatInt(timestamp, 10))
+
+	verifier := &Verifier{PublicKeys: []crypto.PublicKey{privateKey.Public()}}
+	assert.NoError(t, verifier.Verify(req))
+}
+
+func TestMiddleware(t *testing.T) {
+	status := http.StatusOK
+	calls := 0
+	handler := newVerifier(NewMemoryStore()).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(status)
+	}))
+
+	serve := func(signatures string) int {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, newWebhook(signatures))
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve("v1,Ceo5qEr07ixe2NLpvHk3FH9bwy/WavXrAFQ/9tdO6mc="))
+	assert.Equal(t, 0, calls)
+
+	// A failed webhook is accepted again when the sender retries it.
+	status = http.StatusInternalServerError
+	assert.Equal(t, http.StatusInternalServerError, serve("v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE="))
+	status = http.StatusOK
+	assert.Equal(t, http.StatusOK, serve("v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE="))
+	assert.Equal(t, 2, calls)
+
+	// A replay is acknowledged without reaching the handler.
+	assert.Equal(t, http.StatusOK, serve("v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE="))
+	assert.Equal(t, 2, calls)
+}
+
+func TestRedisStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), "sendhooks:seen:")
+	ctx := context.Background()
+
+	seen, err := store.Seen(ctx, testID, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.False(t, seen)
+
+	seen, err = store.Seen(ctx, testID, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, seen)
+
+	// The ID expires with the tolerance window.
+	server.FastForward(2 * time.Minute)
+	seen, err = store.Seen(ctx, testID, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.False(t, seen)
+
+	assert.NoError(t, store.Forget(ctx, testID))
+	seen, err = store.Seen(ctx, testID, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.False(t, seen)
+}